@@ -1,63 +1,162 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/omniflare/campus-lostandfound/internal/config"
+	"github.com/omniflare/campus-lostandfound/internal/controller"
 	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/email"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/idempotency"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/middleware"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/ratelimit"
+	"github.com/omniflare/campus-lostandfound/internal/realtime"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
 	"github.com/omniflare/campus-lostandfound/internal/routes"
+	"github.com/omniflare/campus-lostandfound/internal/tracing"
+	"github.com/omniflare/campus-lostandfound/internal/webhooks"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
 )
 
 func main() {
+	// Print or check the OpenAPI document, e.g. "api openapi check". It needs
+	// no settings, so it runs before they are validated, and before anything
+	// logs so that the printed document is clean.
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		runOpenAPI(os.Args[2:])
+		return
+	}
+
+	// Load and validate settings before anything uses them
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal("Invalid configuration", err)
+	}
+	if err := logging.Setup(cfg.Logging); err != nil {
+		logging.Fatal("Invalid logging configuration", err)
+	}
+
+	stopTracing, err := tracing.Setup(cfg.Tracing, cfg.Env)
+	if err != nil {
+		logging.Fatal("Error setting up tracing", err)
+	}
+	if cfg.UsesDefaultJWTSecret() {
+		slog.Warn("JWT_SECRET is not set, tokens are signed with the insecure development secret")
+	}
+
+	// Run schema migrations instead of the server, e.g. "api migrate status"
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	// Create uploads directory if it doesn't exist
-	err := os.MkdirAll("./uploads", 0755)
+	err = os.MkdirAll(cfg.Uploads.ImageDir, 0755)
 	if err != nil {
-		log.Fatalf("Error creating uploads directory: %v", err)
+		logging.Fatal("Error creating uploads directory", err)
 	}
 
+	// Create private attachments directory, which is not served statically
+	err = os.MkdirAll(cfg.Uploads.AttachmentDir, 0750)
+	if err != nil {
+		logging.Fatal("Error creating attachments directory", err)
+	}
+
+	controller.ConfigureUploads(cfg.Uploads)
+
 	// Connect to database
 	database.ConnectDB()
 	database.InitDB()
+	metrics.RegisterDB()
 
-	// Create a new Fiber app
-	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			// Default 500 status code
-			code := fiber.StatusInternalServerError
+	// Handlers read and write through the SQL repositories
+	repos := repository.NewPostgres(database.DB)
+	controller.UseRepositories(repos)
+	middleware.UseAPIKeys(repos.APIKeys)
 
-			// Check if it's a fiber error
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
+	// Seed the permission catalog and load the role mapping
+	if err := permissions.Seed(context.Background()); err != nil {
+		logging.Fatal("Error seeding permissions", err)
+	}
 
-			// Return JSON response
-			return c.Status(code).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		},
-		// Set more lenient JSON parsing
-		JSONEncoder: json.Marshal,
-		JSONDecoder: json.Unmarshal,
-		// Increase request body limit
-		BodyLimit: 10 * 1024 * 1024, // 10MB
+	// Background workers and listeners run until shutdown
+	workers := worker.NewSupervisor()
+	controller.UseWorkers(workers)
+
+	// Keep responses to requests with an Idempotency-Key in the database
+	idempotencyStore := idempotency.NewPostgres(database.DB)
+	idempotency.Use(idempotencyStore)
+	workers.Go("idempotency-cleanup", idempotencyStore.RunCleanup)
+
+	// Share rate limit buckets between instances through the database if configured
+	if cfg.RateLimit.Store == "database" {
+		store := ratelimit.NewPostgres(database.DB)
+		ratelimit.Use(store)
+		workers.Go("rate-limit-cleanup", store.RunCleanup)
+	}
+
+	// Receive realtime events published by every API instance
+	if err := realtime.Listen(workers.Context()); err != nil {
+		slog.Warn("Realtime listener unavailable, events will only reach this instance", "error", err)
+	}
+
+	// Share item events between API instances
+	if err := events.Listen(workers.Context()); err != nil {
+		slog.Warn("Event listener unavailable, events will only reach this instance", "error", err)
+	}
+
+	// Turn outbox events into notifications and webhook deliveries, then publish them
+	controller.RegisterEventHandlers()
+	webhooks.RegisterHandler()
+	workers.Go("outbox-dispatcher", events.RunDispatcher)
+	workers.Go("outbox-retention", events.RunRetention)
+	workers.Go("webhook-deliveries", webhooks.RunDeliveries)
+
+	// Send queued emails and daily digests
+	mailer := email.New()
+	workers.Go("email", func(ctx context.Context) {
+		email.RunWorker(ctx, mailer)
 	})
 
-	// Use middlewares
-	app.Use(recover.New())
-	app.Use(logger.New())
+	// Create a new Fiber app
+	app := fiber.New(appConfig(cfg))
+
+	// Use middlewares. Recover runs inside AccessLog so that panics are logged
+	// as 500 responses with the request ID.
+	app.Use(middleware.RequestID())
+	app.Use(middleware.AccessLog())
+	app.Use(metrics.Middleware())
+	app.Use(tracing.Middleware())
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, e interface{}) {
+			logging.Ctx(c).Error("Panic while handling request", "panic", e, "stack", string(debug.Stack()))
+		},
+	}))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*", // Allow all origins
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE",
+		AllowOrigins:  strings.Join(cfg.CORS.AllowOrigins, ", "),
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-API-Key, X-Request-ID, Idempotency-Key",
+		ExposeHeaders: "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, Idempotent-Replayed",
+		AllowMethods:  "GET, POST, PUT, DELETE",
 	}))
 
 	// Serve static files from uploads directory
-	app.Static("/uploads", "./uploads")
+	app.Static("/uploads", cfg.Uploads.ImageDir)
 
 	//dont know the shint I am doing here
 
@@ -65,16 +164,87 @@ func main() {
 	routes.SetupRoutes(app)
 
 	// Start server
-	port := getEnv("PORT", "3000")
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	slog.Info("Server starting", "port", cfg.Port, "env", cfg.Env)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- app.Listen(":" + cfg.Port)
+	}()
+
+	// Serve until SIGINT or SIGTERM, then shut down in order
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	exitCode := 0
+	select {
+	case sig := <-stop:
+		slog.Info("Shutting down", "signal", sig.String())
+	case err := <-serverErr:
+		slog.Error("Server stopped", "error", err)
+		exitCode = 1
+	}
+	shutdown(app, workers, stopTracing, cfg.ShutdownTimeout)
+	os.Exit(exitCode)
+}
+
+// shutdown ends event streams and WebSockets and waits for other in-flight
+// requests such as uploads to finish, then stops the background workers,
+// flushes pending spans and closes the database. Each of the first three steps is given at most timeout.
+func shutdown(app *fiber.App, workers *worker.Supervisor, stopTracing func(context.Context) error, timeout time.Duration) {
+	workers.Drain()
+	if err := app.ShutdownWithTimeout(timeout); err != nil {
+		slog.Error("Error draining requests", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := workers.Stop(ctx); err != nil {
+		slog.Error("Background workers did not stop in time", "error", err)
+	}
+
+	traceCtx, cancelTrace := context.WithTimeout(context.Background(), timeout)
+	defer cancelTrace()
+	if err := stopTracing(traceCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+
+	if err := database.DB.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
+	}
+	slog.Info("Shutdown complete")
 }
 
-// getEnv gets the environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// appConfig returns the settings of the Fiber app serving the API
+func appConfig(cfg *config.Config) fiber.Config {
+	return fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			// Default 500 status code
+			code := fiber.StatusInternalServerError
+
+			// Check if it's a fiber error
+			message := err.Error()
+			if e, ok := err.(*fiber.Error); ok {
+				code = e.Code
+			} else {
+				// Keep unexpected errors out of the response
+				logging.Ctx(c).Error("Unhandled error", "error", err)
+				message = "Internal server error"
+			}
+
+			// Return JSON response
+			return c.Status(code).JSON(fiber.Map{
+				"error": message,
+			})
+		},
+		// Set more lenient JSON parsing
+		JSONEncoder: json.Marshal,
+		JSONDecoder: json.Unmarshal,
+		// Allow bodies as large as the largest upload
+		BodyLimit: cfg.Uploads.BodyLimit,
+		// The banner would break JSON log parsing
+		DisableStartupMessage: cfg.Logging.Format == "json",
+		// Take the client IP from X-Forwarded-For only on requests from trusted proxies
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		ProxyHeader:             fiber.HeaderXForwardedFor,
+		EnableIPValidation:      true,
 	}
-	return value
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/config"
+	"github.com/omniflare/campus-lostandfound/internal/middleware"
+	"github.com/omniflare/campus-lostandfound/internal/ratelimit"
+)
+
+// serve runs app on a loopback port, so that requests come from 127.0.0.1,
+// and returns its URL
+func serve(t *testing.T, app *fiber.App) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+// get sends a GET request with an X-Forwarded-For header, unless it is empty
+func get(t *testing.T, url, forwardedFor string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forwardedFor != "" {
+		req.Header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func testConfig(trustedProxies ...string) *config.Config {
+	cfg := config.Defaults()
+	cfg.Logging.Format = "json"
+	cfg.TrustedProxies = trustedProxies
+	return &cfg
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		trusted      []string
+		forwardedFor string
+		want         string
+	}{
+		{"no proxy", nil, "", "127.0.0.1"},
+		{"trusted proxy", []string{"127.0.0.1"}, "203.0.113.7", "203.0.113.7"},
+		{"trusted range", []string{"127.0.0.0/8"}, "203.0.113.7", "203.0.113.7"},
+		{"first of several addresses", []string{"127.0.0.1"}, "203.0.113.7, 10.0.0.2", "203.0.113.7"},
+		{"trusted proxy without header", []string{"127.0.0.1"}, "", "127.0.0.1"},
+		{"invalid address from trusted proxy", []string{"127.0.0.1"}, "not-an-ip", "127.0.0.1"},
+		{"spoofed by untrusted peer", []string{"10.0.0.0/8"}, "203.0.113.7", "127.0.0.1"},
+		{"spoofed with no trusted proxies", nil, "203.0.113.7", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(appConfig(testConfig(tt.trusted...)))
+			app.Get("/ip", func(c *fiber.Ctx) error {
+				return c.SendString(c.IP())
+			})
+
+			if _, ip := get(t, serve(t, app)+"/ip", tt.forwardedFor); ip != tt.want {
+				t.Errorf("client IP = %q, want %q", ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpoofedForwardedForSharesRateLimit(t *testing.T) {
+	ratelimit.Use(ratelimit.NewMemory())
+	t.Cleanup(func() { ratelimit.Use(ratelimit.NewMemory()) })
+
+	app := fiber.New(appConfig(testConfig("10.0.0.0/8")))
+	app.Get("/limited", middleware.RateLimit("test", ratelimit.PerMinute(1, 1), nil), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	url := serve(t, app) + "/limited"
+
+	// A client that is not a trusted proxy cannot get a new bucket by changing the header
+	if status, _ := get(t, url, "203.0.113.1"); status != http.StatusOK {
+		t.Fatalf("first request: status %d", status)
+	}
+	if status, _ := get(t, url, "203.0.113.2"); status != http.StatusTooManyRequests {
+		t.Errorf("request with another X-Forwarded-For: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
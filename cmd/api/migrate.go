@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  up        Apply all pending migrations
+  down [n]  Revert the last n applied migrations (default 1)
+  status    List migrations and when they were applied`
+
+// runMigrate handles the "migrate" subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "up":
+		database.ConnectDB()
+		applied, err := database.MigrateUp()
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			logging.Fatal("Migration failed", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Fprintf(os.Stderr, "Invalid number of migrations to revert: %s\n", args[1])
+				os.Exit(2)
+			}
+			steps = n
+		}
+
+		database.ConnectDB()
+		reverted, err := database.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			logging.Fatal("Migration failed", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		}
+
+	case "status":
+		database.ConnectDB()
+		statuses, err := database.MigrationStatuses()
+		if err != nil {
+			logging.Fatal("Error reading migration status", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/openapi"
+	"github.com/omniflare/campus-lostandfound/internal/routes"
+)
+
+const openAPIUsage = `Usage: api openapi <command>
+
+Commands:
+  print     Write the OpenAPI document to stdout
+  check     Fail unless every registered route is documented, and every
+            documented operation is registered`
+
+// runOpenAPI handles the "openapi" subcommand
+func runOpenAPI(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, openAPIUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "print":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(openapi.Spec()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+	case "check":
+		// Register the routes on an app that is never started
+		app := fiber.New()
+		routes.SetupRoutes(app)
+		if err := openapi.Check(app.GetRoutes(true)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("All routes are documented")
+
+	default:
+		fmt.Fprintln(os.Stderr, openAPIUsage)
+		os.Exit(2)
+	}
+}
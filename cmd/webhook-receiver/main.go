@@ -0,0 +1,59 @@
+// Command webhook-receiver is a local endpoint for trying out webhooks. It
+// verifies each delivery's signature and prints the payload.
+//
+//	WEBHOOK_SECRET=whsec_... go run ./cmd/webhook-receiver
+//
+// Register http://localhost:4000/webhook as the webhook URL.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/webhooks"
+)
+
+func main() {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		log.Fatal("WEBHOOK_SECRET is required")
+	}
+
+	http.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "error reading body", http.StatusBadRequest)
+			return
+		}
+
+		err = webhooks.Verify(secret, r.Header.Get(webhooks.HeaderSignature), r.Header.Get(webhooks.HeaderTimestamp), body, 5*time.Minute)
+		if err != nil {
+			log.Printf("Rejected %s delivery: %v", r.Header.Get(webhooks.HeaderEvent), err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var pretty bytes.Buffer
+		json.Indent(&pretty, body, "", "  ")
+		log.Printf("Received %s (%s)\n%s", r.Header.Get(webhooks.HeaderEvent), r.Header.Get(webhooks.HeaderID), pretty.String())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	addr := ":" + getEnv("PORT", "4000")
+	log.Printf("Webhook receiver listening on %s/webhook", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// getEnv gets the environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
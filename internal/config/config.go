@@ -0,0 +1,342 @@
+// Package config loads the API's settings from defaults, an optional YAML or
+// TOML file and environment variables, in increasing order of precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environments the API runs in
+const (
+	Development = "development"
+	Test        = "test"
+	Production  = "production"
+)
+
+// defaultJWTSecret and defaultDatabaseURL are only used in development and
+// test. Other environments must set JWT_SECRET and DATABASE_URL.
+const (
+	defaultJWTSecret   = "your_default_secret_key"
+	defaultDatabaseURL = "sqlite://lostandfound.db"
+)
+
+// Config holds every setting of the API. The env tag names the environment
+// variable that overrides a field.
+type Config struct {
+	Env         string `yaml:"env" toml:"env" env:"APP_ENV"`
+	Port        string `yaml:"port" toml:"port" env:"PORT"`
+	PublicURL   string `yaml:"public_url" toml:"public_url" env:"PUBLIC_URL"`
+	FrontendURL string `yaml:"frontend_url" toml:"frontend_url" env:"FRONTEND_URL"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header gives the client IP
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// ShutdownTimeout bounds each shutdown step: draining requests and stopping workers
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	Database        Database      `yaml:"database" toml:"database"`
+	Auth            Auth          `yaml:"auth" toml:"auth"`
+	CORS            CORS          `yaml:"cors" toml:"cors"`
+	Uploads         Uploads       `yaml:"uploads" toml:"uploads"`
+	Mail            Mail          `yaml:"mail" toml:"mail"`
+	Logging         Logging       `yaml:"logging" toml:"logging"`
+	Metrics         Metrics       `yaml:"metrics" toml:"metrics"`
+	Tracing         Tracing       `yaml:"tracing" toml:"tracing"`
+	RateLimit       RateLimit     `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// Database configures the connection pool
+type Database struct {
+	URL             string        `yaml:"url" toml:"url" env:"DATABASE_URL"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+// Auth configures token signing
+type Auth struct {
+	JWTSecret string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET"`
+	TokenTTL  time.Duration `yaml:"token_ttl" toml:"token_ttl" env:"JWT_TTL"`
+	// UnsubscribeSecret signs email unsubscribe links and defaults to JWTSecret
+	UnsubscribeSecret string `yaml:"unsubscribe_secret" toml:"unsubscribe_secret" env:"UNSUBSCRIBE_SECRET"`
+}
+
+// CORS configures which browser origins may call the API
+type CORS struct {
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins" env:"CORS_ALLOW_ORIGINS"`
+}
+
+// Uploads configures where files are stored and how large they may be
+type Uploads struct {
+	ImageDir          string `yaml:"image_dir" toml:"image_dir" env:"UPLOAD_DIR"`
+	AttachmentDir     string `yaml:"attachment_dir" toml:"attachment_dir" env:"ATTACHMENT_DIR"`
+	MaxImageSize      int64  `yaml:"max_image_size" toml:"max_image_size" env:"MAX_IMAGE_SIZE"`
+	MaxAttachmentSize int64  `yaml:"max_attachment_size" toml:"max_attachment_size" env:"MAX_ATTACHMENT_SIZE"`
+	BodyLimit         int    `yaml:"body_limit" toml:"body_limit" env:"BODY_LIMIT"`
+}
+
+// Logging configures the structured log output
+type Logging struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`    // debug, info, warn or error
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"` // json or text
+}
+
+// Metrics configures the Prometheus endpoint
+type Metrics struct {
+	// Token, when set, must be sent as a bearer token to read /metrics
+	Token string `yaml:"token" toml:"token" env:"METRICS_TOKEN"`
+}
+
+// Tracing configures OpenTelemetry tracing
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"` // none, otlp or stdout
+	// Endpoint is the OTLP/HTTP collector URL. When empty the exporter reads
+	// the standard OTEL_EXPORTER_OTLP_* variables.
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"` // Share of new traces recorded, from 0 to 1
+}
+
+// RateLimit configures request throttling. Limits are requests a minute, with
+// bursts of up to the burst size; 0 requests disables a limit.
+type RateLimit struct {
+	Store       string   `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`    // memory or database
+	Public      int      `yaml:"public" toml:"public" env:"RATE_LIMIT_PUBLIC"` // Per IP, on public routes
+	PublicBurst int      `yaml:"public_burst" toml:"public_burst" env:"RATE_LIMIT_PUBLIC_BURST"`
+	Writes      int      `yaml:"writes" toml:"writes" env:"RATE_LIMIT_WRITES"` // Per user, on item, message and report creation
+	WritesBurst int      `yaml:"writes_burst" toml:"writes_burst" env:"RATE_LIMIT_WRITES_BURST"`
+	ExemptRoles []string `yaml:"exempt_roles" toml:"exempt_roles" env:"RATE_LIMIT_EXEMPT_ROLES"` // Not limited on writes
+}
+
+// Mail configures how emails are sent
+type Mail struct {
+	Driver       string `yaml:"driver" toml:"driver" env:"MAIL_DRIVER"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM"`
+	LogFile      string `yaml:"log_file" toml:"log_file" env:"MAIL_LOG_FILE"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD"`
+}
+
+var (
+	mu      sync.Mutex
+	current *Config
+)
+
+// Defaults returns the settings used when nothing overrides them. They are
+// those of production; development and test add a JWT secret and an SQLite
+// database when none is set.
+func Defaults() Config {
+	return Config{
+		Env:             Production,
+		Port:            "3000",
+		PublicURL:       "http://localhost:3000",
+		ShutdownTimeout: 30 * time.Second,
+		Database: Database{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Auth: Auth{
+			TokenTTL: 24 * time.Hour,
+		},
+		CORS: CORS{AllowOrigins: []string{"*"}},
+		Uploads: Uploads{
+			ImageDir:          "./uploads",
+			AttachmentDir:     "./attachments",
+			MaxImageSize:      5 * 1024 * 1024,
+			MaxAttachmentSize: 10 * 1024 * 1024,
+			BodyLimit:         10 * 1024 * 1024,
+		},
+		Mail: Mail{
+			Driver:   "log",
+			From:     "Campus Lost & Found <no-reply@localhost>",
+			SMTPHost: "localhost",
+			SMTPPort: "587",
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "campus-lostandfound",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimit{
+			Store:       "memory",
+			Public:      120,
+			PublicBurst: 60,
+			Writes:      20,
+			WritesBurst: 10,
+			ExemptRoles: []string{"admin"},
+		},
+	}
+}
+
+// Load reads the file named by CONFIG_FILE, if set, and the environment over
+// the defaults, validates the result and makes it the configuration Get returns
+func Load() (*Config, error) {
+	cfg, err := read(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	current = cfg
+	mu.Unlock()
+	return cfg, nil
+}
+
+// Get returns the configuration from Load. Before Load is called it returns
+// the defaults and environment without validating them, which suits tools.
+func Get() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		cfg, err := read("")
+		if err != nil {
+			defaults := Defaults()
+			cfg = &defaults
+		}
+		current = cfg
+	}
+	return current
+}
+
+// IsDevelopment reports whether the API runs in development or test
+func (c *Config) IsDevelopment() bool {
+	return c.Env == Development || c.Env == Test
+}
+
+// UsesDefaultJWTSecret reports whether tokens are signed with the built-in
+// development secret
+func (c *Config) UsesDefaultJWTSecret() bool {
+	return c.Auth.JWTSecret == defaultJWTSecret
+}
+
+// Validate reports every setting that is missing or out of range
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == Development || c.Env == Test || c.Env == Production,
+		"APP_ENV must be %s, %s or %s, got %q", Development, Test, Production, c.Env)
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT must be a port number, got %q", c.Port)
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	for _, proxy := range c.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "TRUSTED_PROXIES must hold IP addresses or CIDR ranges, got %q", proxy)
+	}
+	check(c.Database.URL != "", "DATABASE_URL is required outside development")
+	check(c.Database.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be positive")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	check(c.Database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+
+	check(c.Auth.JWTSecret != "", "JWT_SECRET is required outside development")
+	if !c.IsDevelopment() {
+		check(!c.UsesDefaultJWTSecret(), "JWT_SECRET must be changed from the default outside development")
+		check(len(c.Auth.JWTSecret) >= 32, "JWT_SECRET must be at least 32 characters outside development")
+	}
+	check(c.Auth.TokenTTL > 0, "JWT_TTL must be positive")
+
+	check(len(c.CORS.AllowOrigins) > 0, "CORS_ALLOW_ORIGINS is required")
+	check(c.Uploads.ImageDir != "", "UPLOAD_DIR is required")
+	check(c.Uploads.AttachmentDir != "", "ATTACHMENT_DIR is required")
+	check(c.Uploads.MaxImageSize > 0, "MAX_IMAGE_SIZE must be positive")
+	check(c.Uploads.MaxAttachmentSize > 0, "MAX_ATTACHMENT_SIZE must be positive")
+	check(int64(c.Uploads.BodyLimit) >= c.Uploads.MaxImageSize && int64(c.Uploads.BodyLimit) >= c.Uploads.MaxAttachmentSize,
+		"BODY_LIMIT must be at least MAX_IMAGE_SIZE and MAX_ATTACHMENT_SIZE")
+
+	check(c.Mail.Driver == "log" || c.Mail.Driver == "smtp", "MAIL_DRIVER must be log or smtp, got %q", c.Mail.Driver)
+	if c.Mail.Driver == "smtp" {
+		check(c.Mail.SMTPHost != "", "SMTP_HOST is required with the smtp mail driver")
+	}
+
+	level := strings.ToLower(c.Logging.Level)
+	check(level == "debug" || level == "info" || level == "warn" || level == "error",
+		"LOG_LEVEL must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(c.Logging.Format == "json" || c.Logging.Format == "text", "LOG_FORMAT must be json or text, got %q", c.Logging.Format)
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout",
+		"TRACING_EXPORTER must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "database",
+		"RATE_LIMIT_STORE must be memory or database, got %q", c.RateLimit.Store)
+	check(c.RateLimit.Public >= 0 && c.RateLimit.PublicBurst >= 0, "RATE_LIMIT_PUBLIC and RATE_LIMIT_PUBLIC_BURST must not be negative")
+	check(c.RateLimit.Writes >= 0 && c.RateLimit.WritesBurst >= 0, "RATE_LIMIT_WRITES and RATE_LIMIT_WRITES_BURST must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// read loads the defaults, the file at path if any and then the environment
+func read(path string) (*Config, error) {
+	cfg := Defaults()
+	if path != "" {
+		if err := readFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	// Derived defaults
+	if cfg.IsDevelopment() {
+		if cfg.Database.URL == "" {
+			cfg.Database.URL = defaultDatabaseURL
+		}
+		if cfg.Auth.JWTSecret == "" {
+			cfg.Auth.JWTSecret = defaultJWTSecret
+		}
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	if cfg.FrontendURL == "" {
+		cfg.FrontendURL = cfg.PublicURL
+	}
+	if cfg.Auth.UnsubscribeSecret == "" {
+		cfg.Auth.UnsubscribeSecret = cfg.Auth.JWTSecret
+	}
+	return &cfg, nil
+}
+
+// readFile decodes a YAML or TOML file, chosen by its extension, over cfg
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable the config reads for the rest of the test.
+// Empty variables are ignored like unset ones.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+
+	var clear func(v reflect.Type)
+	clear = func(v reflect.Type) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				clear(field.Type)
+			} else if name := field.Tag.Get("env"); name != "" {
+				t.Setenv(name, "")
+			}
+		}
+	}
+	clear(reflect.TypeOf(Config{}))
+}
+
+// productionConfig returns valid production settings
+func productionConfig() Config {
+	cfg := Defaults()
+	cfg.Database.URL = "postgres://localhost/lostandfound"
+	cfg.Auth.JWTSecret = strings.Repeat("s", 32)
+	return cfg
+}
+
+func TestDefaultsAreProduction(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Env != Production || cfg.IsDevelopment() {
+		t.Errorf("default environment %q, want %q", cfg.Env, Production)
+	}
+	// Production has no fallback database or secret, so it refuses to start without them
+	if cfg.Database.URL != "" || cfg.Auth.JWTSecret != "" {
+		t.Errorf("production defaults to database %q and secret %q", cfg.Database.URL, cfg.Auth.JWTSecret)
+	}
+	err = cfg.Validate()
+	for _, name := range []string{"DATABASE_URL", "JWT_SECRET"} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Validate() = %v, want an error about %s", err, name)
+		}
+	}
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() succeeded without DATABASE_URL and JWT_SECRET")
+	}
+}
+
+func TestDevelopmentDefaults(t *testing.T) {
+	for _, env := range []string{Development, Test} {
+		t.Run(env, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("APP_ENV", env)
+
+			cfg, err := read("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Database.URL != defaultDatabaseURL || !cfg.UsesDefaultJWTSecret() {
+				t.Errorf("database %q, default secret %v", cfg.Database.URL, cfg.UsesDefaultJWTSecret())
+			}
+			if cfg.Auth.UnsubscribeSecret != cfg.Auth.JWTSecret {
+				t.Error("the unsubscribe secret does not default to the JWT secret")
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("APP_ENV", Development)
+	t.Setenv("PORT", "8080")
+	t.Setenv("PUBLIC_URL", "https://lost.example.edu/")
+	t.Setenv("DATABASE_URL", "postgres://db/lostandfound")
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("JWT_TTL", "90m")
+	t.Setenv("CORS_ALLOW_ORIGINS", "https://a.example.edu, https://b.example.edu,")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, err := read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "8080" || cfg.Database.URL != "postgres://db/lostandfound" || cfg.Database.MaxOpenConns != 50 {
+		t.Errorf("port %q, database %q, max open conns %d", cfg.Port, cfg.Database.URL, cfg.Database.MaxOpenConns)
+	}
+	if cfg.Auth.TokenTTL != 90*time.Minute || cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("token TTL %s, sample ratio %v", cfg.Auth.TokenTTL, cfg.Tracing.SampleRatio)
+	}
+	if want := []string{"https://a.example.edu", "https://b.example.edu"}; !reflect.DeepEqual(cfg.CORS.AllowOrigins, want) {
+		t.Errorf("allowed origins %q, want %q", cfg.CORS.AllowOrigins, want)
+	}
+	// The public URL has its trailing slash removed and is the default frontend URL
+	if cfg.PublicURL != "https://lost.example.edu" || cfg.FrontendURL != cfg.PublicURL {
+		t.Errorf("public URL %q, frontend URL %q", cfg.PublicURL, cfg.FrontendURL)
+	}
+
+	for name, value := range map[string]string{"DB_MAX_OPEN_CONNS": "many", "JWT_TTL": "a day", "TRACING_SAMPLE_RATIO": "half"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := read(""); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("read() = %v, want an error about %s", err, name)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "env: development\nport: \"4000\"\ndatabase:\n  max_open_conns: 10\nrate_limit:\n  exempt_roles: [admin, staff]\n",
+		"config.toml": "env = \"development\"\nport = \"4000\"\n[database]\nmax_open_conns = 10\n[rate_limit]\nexempt_roles = [\"admin\", \"staff\"]\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := read(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Env != Development || cfg.Port != "4000" || cfg.Database.MaxOpenConns != 10 {
+				t.Errorf("env %q, port %q, max open conns %d", cfg.Env, cfg.Port, cfg.Database.MaxOpenConns)
+			}
+			if want := []string{"admin", "staff"}; !reflect.DeepEqual(cfg.RateLimit.ExemptRoles, want) {
+				t.Errorf("exempt roles %q, want %q", cfg.RateLimit.ExemptRoles, want)
+			}
+			// Settings the file leaves out keep their defaults
+			if cfg.Database.MaxIdleConns != Defaults().Database.MaxIdleConns {
+				t.Errorf("max idle conns %d", cfg.Database.MaxIdleConns)
+			}
+
+			// The environment takes precedence over the file
+			t.Setenv("PORT", "5000")
+			if cfg, err := read(path); err != nil || cfg.Port != "5000" {
+				t.Errorf("with PORT set: %v, %v", cfg, err)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		clearEnv(t)
+		dir := t.TempDir()
+		for name, content := range map[string]string{"config.json": "{}", "broken.yaml": "port: [", "broken.toml": "port ="} {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := read(path); err == nil {
+				t.Errorf("read(%s) succeeded", name)
+			}
+		}
+		if _, err := read(filepath.Join(dir, "missing.yaml")); err == nil {
+			t.Error("read() succeeded for a missing file")
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string // Part of the error, or empty for a valid config
+	}{
+		{"valid production", func(c *Config) {}, ""},
+		{"missing database URL", func(c *Config) { c.Database.URL = "" }, "DATABASE_URL"},
+		{"missing JWT secret", func(c *Config) { c.Auth.JWTSecret = "" }, "JWT_SECRET"},
+		{"default JWT secret", func(c *Config) { c.Auth.JWTSecret = defaultJWTSecret }, "changed from the default"},
+		{"short JWT secret", func(c *Config) { c.Auth.JWTSecret = "short" }, "at least 32 characters"},
+		{"short JWT secret in development", func(c *Config) { c.Env = Development; c.Auth.JWTSecret = "short" }, ""},
+		{"unknown environment", func(c *Config) { c.Env = "staging" }, "APP_ENV"},
+		{"bad port", func(c *Config) { c.Port = "70000" }, "PORT"},
+		{"bad trusted proxy", func(c *Config) { c.TrustedProxies = []string{"10.0.0.0/8", "proxy"} }, "TRUSTED_PROXIES"},
+		{"idle above open conns", func(c *Config) { c.Database.MaxIdleConns = 30 }, "DB_MAX_IDLE_CONNS"},
+		{"body limit below uploads", func(c *Config) { c.Uploads.BodyLimit = 1024 }, "BODY_LIMIT"},
+		{"smtp without host", func(c *Config) { c.Mail.Driver = "smtp"; c.Mail.SMTPHost = "" }, "SMTP_HOST"},
+		{"unknown log level", func(c *Config) { c.Logging.Level = "verbose" }, "LOG_LEVEL"},
+		{"sample ratio above 1", func(c *Config) { c.Tracing.SampleRatio = 2 }, "TRACING_SAMPLE_RATIO"},
+		{"unknown rate limit store", func(c *Config) { c.RateLimit.Store = "redis" }, "RATE_LIMIT_STORE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := productionConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate() = %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate() = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	cfg := productionConfig()
+	cfg.Port, cfg.Logging.Format = "", "xml"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "PORT") || !strings.Contains(err.Error(), "LOG_FORMAT") {
+		t.Errorf("Validate() = %v, want errors about PORT and LOG_FORMAT", err)
+	}
+}
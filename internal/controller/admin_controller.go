@@ -1,11 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
 	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
 )
 
 // GetUsers gets a list of users (admin only)
@@ -13,80 +16,41 @@ func GetUsers(c *fiber.Ctx) error {
 	// Parse query parameters
 	role := c.Query("role", "all")
 	search := c.Query("search", "")
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 20)
-	offset := (page - 1) * limit
-
-	// Build the query
-	query := "SELECT id, username, email, role, first_name, last_name, phone, created_at, updated_at FROM users WHERE 1=1"
-	countQuery := "SELECT COUNT(*) FROM users WHERE 1=1"
-	args := []interface{}{}
-	argCount := 1
-
-	// Add role filter if provided
-	if role != "all" {
-		query += " AND role = $" + string(rune('0'+argCount))
-		countQuery += " AND role = $" + string(rune('0'+argCount))
-		args = append(args, role)
-		argCount++
-	}
-
-	// Add search filter if provided
-	if search != "" {
-		query += " AND (username ILIKE $" + string(rune('0'+argCount)) + " OR email ILIKE $" + string(rune('0'+argCount))
-		query += " OR first_name ILIKE $" + string(rune('0'+argCount)) + " OR last_name ILIKE $" + string(rune('0'+argCount)) + ")"
-		countQuery += " AND (username ILIKE $" + string(rune('0'+argCount)) + " OR email ILIKE $" + string(rune('0'+argCount))
-		countQuery += " OR first_name ILIKE $" + string(rune('0'+argCount)) + " OR last_name ILIKE $" + string(rune('0'+argCount)) + ")"
-		args = append(args, "%"+search+"%")
-		argCount++
-	}
-
-	// Add pagination
-	query += " ORDER BY created_at DESC LIMIT $" + string(rune('0'+argCount)) + " OFFSET $" + string(rune('0'+argCount+1))
-	args = append(args, limit, offset)
+	page, limit, offset := pagination(c, 20)
 
 	// Get users from database
-	var users []models.User
-	err := database.DB.Select(&users, query, args...)
+	users, total, err := userRepo.List(c.UserContext(), repository.UserFilter{
+		Role:   allToEmpty(role),
+		Search: search,
+		Limit:  limit,
+		Offset: offset,
+	})
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving users", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error retrieving users",
 		})
 	}
 
-	// Get total count for pagination
-	var total int
-	err = database.DB.Get(&total, countQuery, args[:argCount-1]...)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving user count",
-		})
-	}
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"users": users,
-		"meta": fiber.Map{
-			"total": total,
-			"page":  page,
-			"limit": limit,
-			"pages": (total + limit - 1) / limit,
-		},
+		"meta":  pageMeta(total, page, limit),
 	})
 }
 
 // UpdateUserRole updates a user's role (admin only)
 func UpdateUserRole(c *fiber.Ctx) error {
 	// Get user ID from URL parameter
-	userID := c.Params("id")
-	if userID == "" {
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "User ID is required",
+			"error": "Invalid user ID",
 		})
 	}
 
 	// Get admin ID to ensure they're not changing their own role
 	adminID := c.Locals("user_id").(int)
-	if userID == string(rune('0'+adminID)) { // Convert userID string to match adminID for comparison
+	if userID == adminID {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Cannot change your own role",
 		})
@@ -102,18 +66,22 @@ func UpdateUserRole(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate role
-	validRoles := map[string]bool{"student": true, "guard": true, "admin": true}
-	if !validRoles[roleUpdate.Role] {
+	// Validate role against the roles defined in the permission mapping
+	if !permissions.RoleExists(c.UserContext(), roleUpdate.Role) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid role. Must be one of: student, guard, admin",
+			"error": "Invalid role. Must be a role with at least one permission",
 		})
 	}
 
 	// Update user role in database
-	_, err := database.DB.Exec("UPDATE users SET role = $1, updated_at = $2 WHERE id = $3",
-		roleUpdate.Role, time.Now(), userID)
+	err = userRepo.SetRole(c.UserContext(), userID, roleUpdate.Role)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
 	if err != nil {
+		logging.Ctx(c).Error("Error updating user role", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error updating user role",
 		})
@@ -124,80 +92,97 @@ func UpdateUserRole(c *fiber.Ctx) error {
 	})
 }
 
-// GetReports gets a list of reports (admin only)
-func GetReports(c *fiber.Ctx) error {
-	// Parse query parameters
-	status := c.Query("status", "all")
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 20)
-	offset := (page - 1) * limit
-
-	// Build the query
-	query := `
-		SELECT r.*, 
-		   reporter.username as reporter_username,
-		   reported.username as reported_username
-		FROM reports r
-		JOIN users reporter ON r.reporter_id = reporter.id
-		JOIN users reported ON r.reported_id = reported.id
-		WHERE 1=1
-	`
-	countQuery := "SELECT COUNT(*) FROM reports WHERE 1=1"
-	args := []interface{}{}
-	argCount := 1
-
-	// Add status filter if provided
-	if status != "all" {
-		query += " AND r.status = $" + string(rune('0'+argCount))
-		countQuery += " AND status = $" + string(rune('0'+argCount))
-		args = append(args, status)
-		argCount++
+// UnlockUser clears a user's failed login count and lockout (admin only)
+func UnlockUser(c *fiber.Ctx) error {
+	// Get user ID from URL parameter
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	// Reset lockout state in database
+	err = userRepo.Unlock(c.UserContext(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error unlocking user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error unlocking user",
+		})
 	}
 
-	// Add pagination
-	query += " ORDER BY r.created_at DESC LIMIT $" + string(rune('0'+argCount)) + " OFFSET $" + string(rune('0'+argCount+1))
-	args = append(args, limit, offset)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unlocked successfully",
+	})
+}
 
-	// Get reports from database
-	var reports []struct {
-		models.Report
-		ReporterUsername string `db:"reporter_username" json:"reporter_username"`
-		ReportedUsername string `db:"reported_username" json:"reported_username"`
+// GetLoginAttempts gets the login attempt audit log (admin only)
+func GetLoginAttempts(c *fiber.Ctx) error {
+	// Parse query parameters
+	username := c.Query("username", "")
+	ip := c.Query("ip", "")
+	success := c.Query("success", "all") // true, false, or all
+	page, limit, offset := pagination(c, 50)
+
+	filter := repository.LoginAttemptFilter{
+		Username: username,
+		IP:       ip,
+		Limit:    limit,
+		Offset:   offset,
+	}
+	if success == "true" || success == "false" {
+		ok := success == "true"
+		filter.Success = &ok
 	}
-	err := database.DB.Select(&reports, query, args...)
+
+	// Get login attempts from database
+	attempts, total, err := loginAttemptRepo.List(c.UserContext(), filter)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving login attempts", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving reports",
+			"error": "Error retrieving login attempts",
 		})
 	}
 
-	// Get total count for pagination
-	var total int
-	err = database.DB.Get(&total, countQuery, args[:argCount-1]...)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"login_attempts": attempts,
+		"meta":           pageMeta(total, page, limit),
+	})
+}
+
+// GetReports gets a list of reports (admin only)
+func GetReports(c *fiber.Ctx) error {
+	// Parse query parameters
+	status := c.Query("status", "all")
+	page, limit, offset := pagination(c, 20)
+
+	// Get reports from database
+	reports, total, err := reportRepo.List(c.UserContext(), allToEmpty(status), limit, offset)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving reports", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving report count",
+			"error": "Error retrieving reports",
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"reports": reports,
-		"meta": fiber.Map{
-			"total": total,
-			"page":  page,
-			"limit": limit,
-			"pages": (total + limit - 1) / limit,
-		},
+		"meta":    pageMeta(total, page, limit),
 	})
 }
 
 // UpdateReportStatus updates a report's status (admin only)
 func UpdateReportStatus(c *fiber.Ctx) error {
 	// Get report ID from URL parameter
-	reportID := c.Params("id")
-	if reportID == "" {
+	reportID, err := c.ParamsInt("id")
+	if err != nil || reportID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Report ID is required",
+			"error": "Invalid report ID",
 		})
 	}
 
@@ -220,13 +205,15 @@ func UpdateReportStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update report status in database
-	_, err := database.DB.Exec(`
-		UPDATE reports 
-		SET status = $1, updated_at = $2, admin_comment = $3 
-		WHERE id = $4
-	`, statusUpdate.Status, time.Now(), statusUpdate.Comment, reportID)
+	// Update report status, which also records the outcome for the reporter
+	err = reportRepo.UpdateStatus(c.UserContext(), reportID, statusUpdate.Status, statusUpdate.Comment)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Report not found",
+		})
+	}
 	if err != nil {
+		logging.Ctx(c).Error("Error updating report status", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error updating report status",
 		})
@@ -240,89 +227,11 @@ func UpdateReportStatus(c *fiber.Ctx) error {
 // GetStats gets statistics for the admin dashboard
 func GetStats(c *fiber.Ctx) error {
 	// Get statistics from database
-	stats := struct {
-		TotalUsers     int `json:"total_users"`
-		StudentCount   int `json:"student_count"`
-		GuardCount     int `json:"guard_count"`
-		AdminCount     int `json:"admin_count"`
-		TotalItems     int `json:"total_items"`
-		LostItems      int `json:"lost_items"`
-		FoundItems     int `json:"found_items"`
-		ClaimedItems   int `json:"claimed_items"`
-		ReturnedItems  int `json:"returned_items"`
-		PendingReports int `json:"pending_reports"`
-	}{}
-
-	// Get user counts
-	err := database.DB.Get(&stats.TotalUsers, "SELECT COUNT(*) FROM users")
+	stats, err := statsRepo.Get(c.UserContext())
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving statistics", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving user statistics",
-		})
-	}
-
-	err = database.DB.Get(&stats.StudentCount, "SELECT COUNT(*) FROM users WHERE role = 'student'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving student count",
-		})
-	}
-
-	err = database.DB.Get(&stats.GuardCount, "SELECT COUNT(*) FROM users WHERE role = 'guard'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving guard count",
-		})
-	}
-
-	err = database.DB.Get(&stats.AdminCount, "SELECT COUNT(*) FROM users WHERE role = 'admin'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving admin count",
-		})
-	}
-
-	// Get item counts
-	err = database.DB.Get(&stats.TotalItems, "SELECT COUNT(*) FROM items")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving item statistics",
-		})
-	}
-
-	err = database.DB.Get(&stats.LostItems, "SELECT COUNT(*) FROM items WHERE status = 'lost'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving lost items count",
-		})
-	}
-
-	err = database.DB.Get(&stats.FoundItems, "SELECT COUNT(*) FROM items WHERE status = 'found'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving found items count",
-		})
-	}
-
-	err = database.DB.Get(&stats.ClaimedItems, "SELECT COUNT(*) FROM items WHERE status = 'claimed'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving claimed items count",
-		})
-	}
-
-	err = database.DB.Get(&stats.ReturnedItems, "SELECT COUNT(*) FROM items WHERE status = 'returned'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving returned items count",
-		})
-	}
-
-	// Get report counts
-	err = database.DB.Get(&stats.PendingReports, "SELECT COUNT(*) FROM reports WHERE status = 'pending'")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving pending reports count",
+			"error": "Error retrieving statistics",
 		})
 	}
 
@@ -350,8 +259,7 @@ func CreateReport(c *fiber.Ctx) error {
 	}
 
 	// Validate that reported user exists
-	var exists bool
-	err := database.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", reportReq.ReportedID)
+	exists, err := userRepo.Exists(c.UserContext(), reportReq.ReportedID)
 	if err != nil || !exists {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Reported user not found",
@@ -360,7 +268,7 @@ func CreateReport(c *fiber.Ctx) error {
 
 	// Validate that item exists if provided
 	if reportReq.ItemID != nil {
-		err := database.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM items WHERE id = $1)", *reportReq.ItemID)
+		exists, err := itemRepo.Exists(c.UserContext(), *reportReq.ItemID)
 		if err != nil || !exists {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Item not found",
@@ -368,16 +276,19 @@ func CreateReport(c *fiber.Ctx) error {
 		}
 	}
 
-	// Insert the report into the database
+	// Insert the report, which also records its event
 	now := time.Now()
-	var reportID int
-	err = database.DB.QueryRow(`
-		INSERT INTO reports (reporter_id, reported_id, item_id, reason, status, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id
-	`, userID, reportReq.ReportedID, reportReq.ItemID, reportReq.Reason, "pending", now, now).Scan(&reportID)
-
-	if err != nil {
+	report := models.Report{
+		ReporterID: &userID,
+		ReportedID: reportReq.ReportedID,
+		ItemID:     reportReq.ItemID,
+		Reason:     reportReq.Reason,
+		Status:     "pending",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := reportRepo.Create(c.UserContext(), &report); err != nil {
+		logging.Ctx(c).Error("Error creating report", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error creating report",
 		})
@@ -385,6 +296,6 @@ func CreateReport(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message":   "Report submitted successfully",
-		"report_id": reportID,
+		"report_id": report.ID,
 	})
 }
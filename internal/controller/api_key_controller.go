@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+	"github.com/omniflare/campus-lostandfound/internal/utils/apikey"
+)
+
+// CreateAPIKey creates an API key for the current user
+func CreateAPIKey(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	return createAPIKey(c, userID, userID)
+}
+
+// GetAPIKeys gets the current user's API keys
+func GetAPIKeys(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get API keys from database
+	keys, err := apiKeyRepo.ListForUser(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving API keys", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving API keys",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"api_keys": keys,
+	})
+}
+
+// RevokeAPIKey revokes one of the current user's API keys
+func RevokeAPIKey(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// API keys cannot be used to manage API keys
+	if c.Locals("api_key_id") != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys cannot be managed with an API key",
+		})
+	}
+
+	// Get key ID from URL parameter
+	keyID, err := c.ParamsInt("id")
+	if err != nil || keyID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid API key ID",
+		})
+	}
+
+	// Revoke the key in database
+	err = apiKeyRepo.Revoke(c.UserContext(), keyID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error revoking API key", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error revoking API key",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
+
+// AdminCreateAPIKey creates an API key for any user (admin only)
+func AdminCreateAPIKey(c *fiber.Ctx) error {
+	// Get admin ID from JWT context
+	adminID := c.Locals("user_id").(int)
+
+	// Get user ID from URL parameter
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	return createAPIKey(c, userID, adminID)
+}
+
+// AdminGetAPIKeys gets API keys for all users (admin only)
+func AdminGetAPIKeys(c *fiber.Ctx) error {
+	// Parse query parameters
+	userID := c.QueryInt("user_id", 0)
+	page, limit, offset := pagination(c, 20)
+
+	// Get API keys from database
+	keys, total, err := apiKeyRepo.List(c.UserContext(), userID, limit, offset)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving API keys", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving API keys",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"api_keys": keys,
+		"meta":     pageMeta(total, page, limit),
+	})
+}
+
+// AdminRevokeAPIKey revokes any API key (admin only)
+func AdminRevokeAPIKey(c *fiber.Ctx) error {
+	// API keys cannot be used to manage API keys
+	if c.Locals("api_key_id") != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys cannot be managed with an API key",
+		})
+	}
+
+	// Get key ID from URL parameter
+	keyID, err := c.ParamsInt("id")
+	if err != nil || keyID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid API key ID",
+		})
+	}
+
+	// Revoke the key in database
+	err = apiKeyRepo.Revoke(c.UserContext(), keyID, 0)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error revoking API key", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error revoking API key",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
+
+// createAPIKey validates an API key request and stores a new key owned by userID
+func createAPIKey(c *fiber.Ctx, userID, createdBy int) error {
+	// API keys cannot be used to mint other keys
+	if c.Locals("api_key_id") != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys cannot be managed with an API key",
+		})
+	}
+
+	// Parse request body
+	var keyReq models.APIKeyRequest
+	if err := c.BodyParser(&keyReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate required fields
+	if keyReq.Name == "" || len(keyReq.Permissions) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name and at least one permission are required",
+		})
+	}
+	if keyReq.ExpiresAt != nil && keyReq.ExpiresAt.Before(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Expiry time must be in the future",
+		})
+	}
+
+	// Get the owner's role so the key cannot exceed it
+	owner, err := userRepo.Get(c.UserContext(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving user",
+		})
+	}
+	role := owner.Role
+
+	// Validate permissions
+	for _, perm := range keyReq.Permissions {
+		if !permissions.Valid(perm) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown permission: " + perm,
+			})
+		}
+		if !permissions.Has(c.UserContext(), role, perm) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The key owner's role does not grant permission: " + perm,
+			})
+		}
+	}
+
+	// Generate the key
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		logging.Ctx(c).Error("Error generating API key", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error generating API key",
+		})
+	}
+
+	// Insert the key into the database
+	apiKey := models.APIKey{
+		UserID:      userID,
+		Name:        keyReq.Name,
+		Prefix:      prefix,
+		KeyHash:     hash,
+		Permissions: keyReq.Permissions,
+		CreatedBy:   &createdBy,
+		ExpiresAt:   keyReq.ExpiresAt,
+		CreatedAt:   time.Now(),
+	}
+	if err := apiKeyRepo.Create(c.UserContext(), &apiKey); err != nil {
+		logging.Ctx(c).Error("Error creating API key", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error creating API key",
+		})
+	}
+
+	// The full key is only ever returned here
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":     "API key created successfully. Store it now, it will not be shown again",
+		"api_key_id":  apiKey.ID,
+		"key":         key,
+		"prefix":      prefix,
+		"permissions": keyReq.Permissions,
+		"expires_at":  keyReq.ExpiresAt,
+	})
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+)
+
+type apiKeyCreatedBody struct {
+	ID    int    `json:"api_key_id"`
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// Key scopes are checked against role permissions, which only the database store has
+func TestCreateAPIKeyScopes(t *testing.T) {
+	store := sqliteStore(t)
+	app := testApp(store)
+	alice := createUser(t, store, "alice", "student")
+	admin := createUser(t, store, "root", "admin")
+
+	tests := []struct {
+		name        string
+		path        string
+		userID      int
+		permissions []string
+		want        int
+	}{
+		{"own role's permission", "/user/api-keys", alice, []string{permissions.ItemsCreate, permissions.MessagesSend}, http.StatusCreated},
+		{"permission outside the role", "/user/api-keys", alice, []string{permissions.ItemsCreate, permissions.ItemsUpdateAny}, http.StatusBadRequest},
+		{"unknown permission", "/user/api-keys", alice, []string{"items:destroy"}, http.StatusBadRequest},
+		{"no permissions", "/user/api-keys", alice, nil, http.StatusBadRequest},
+		{"admin for a student", "/admin/users/" + strconv.Itoa(alice) + "/api-keys", admin, []string{permissions.ItemsCreate}, http.StatusCreated},
+		// Keys are limited by their owner's role, not by the admin creating them
+		{"admin permission for a student", "/admin/users/" + strconv.Itoa(alice) + "/api-keys", admin, []string{permissions.UsersView}, http.StatusBadRequest},
+		{"admin for a missing user", "/admin/users/999/api-keys", admin, []string{permissions.ItemsCreate}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body apiKeyCreatedBody
+			req := models.APIKeyRequest{Name: "kiosk", Permissions: tt.permissions}
+			if status := request(t, app, http.MethodPost, tt.path, tt.userID, req, &body); status != tt.want {
+				t.Fatalf("status %d (%s), want %d", status, body.Error, tt.want)
+			}
+			if tt.want == http.StatusCreated && !strings.HasPrefix(body.Key, "lfk_") {
+				t.Errorf("created key %q", body.Key)
+			}
+		})
+	}
+
+	past := time.Now().Add(-time.Hour)
+	req := models.APIKeyRequest{Name: "kiosk", Permissions: []string{permissions.ItemsCreate}, ExpiresAt: &past}
+	if status := request(t, app, http.MethodPost, "/user/api-keys", alice, req, nil); status != http.StatusBadRequest {
+		t.Errorf("expiry in the past: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestRevokedAPIKey(t *testing.T) {
+	store := sqliteStore(t)
+	app := testApp(store)
+	alice := createUser(t, store, "alice", "student")
+	bob := createUser(t, store, "bob", "student")
+
+	var created apiKeyCreatedBody
+	req := models.APIKeyRequest{Name: "kiosk", Permissions: []string{permissions.ItemsCreate}}
+	if status := request(t, app, http.MethodPost, "/user/api-keys", alice, req, &created); status != http.StatusCreated {
+		t.Fatalf("create key: status %d (%s)", status, created.Error)
+	}
+
+	// The key authenticates as its owner but cannot manage keys
+	if status, _ := requestWithKey(t, app, http.MethodGet, "/user/items", created.Key, nil); status != http.StatusOK {
+		t.Fatalf("request with key: status %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := requestWithKey(t, app, http.MethodPost, "/user/api-keys", created.Key, req); status != http.StatusForbidden {
+		t.Errorf("create key with a key: status %d, want %d", status, http.StatusForbidden)
+	}
+
+	// Only the owner can revoke it
+	path := "/user/api-keys/" + strconv.Itoa(created.ID)
+	if status := request(t, app, http.MethodDelete, path, bob, nil, nil); status != http.StatusNotFound {
+		t.Errorf("revoke another user's key: status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := request(t, app, http.MethodDelete, path, alice, nil, nil); status != http.StatusOK {
+		t.Fatalf("revoke key: status %d, want %d", status, http.StatusOK)
+	}
+
+	status, body := requestWithKey(t, app, http.MethodGet, "/user/items", created.Key, nil)
+	if status != http.StatusUnauthorized || !strings.Contains(body, "revoked") {
+		t.Errorf("request with revoked key: status %d, body %s", status, body)
+	}
+
+	// Keys that were never issued or were altered are rejected as well
+	for _, key := range []string{"lfk_00000000_" + strings.Repeat("0", 48), created.Key + "0", "not-a-key"} {
+		if status, _ := requestWithKey(t, app, http.MethodGet, "/user/items", key, nil); status != http.StatusUnauthorized {
+			t.Errorf("key %q: status %d, want %d", key, status, http.StatusUnauthorized)
+		}
+	}
+}
+
+// requestWithKey sends a JSON request authenticated with an API key and returns the response body
+func requestWithKey(t *testing.T, app *fiber.App, method, path, key string, body interface{}) (int, string) {
+	t.Helper()
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(string(raw)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(out)
+}
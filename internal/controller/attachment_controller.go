@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/realtime"
+)
+
+// UploadMessageAttachment sends an image or PDF, with optional text, to a conversation
+func UploadMessageAttachment(c *fiber.Ctx) error {
+	// Get sender ID from JWT context
+	senderID := c.Locals("user_id").(int)
+
+	// Get conversation ID from URL parameter
+	conversationID, err := c.ParamsInt("id")
+	if err != nil || conversationID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	// Only participants can post
+	if _, ok := participantRole(c.UserContext(), conversationID, senderID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	conversation, err := conversationRepo.Get(c.UserContext(), conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	participants, err := conversationRepo.Participants(c.UserContext(), conversationID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving participants", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving participants",
+		})
+	}
+
+	// Respect blocks between the participants
+	if err := checkConversationBlocks(c.UserContext(), participants, senderID); err != nil {
+		return messagingErrorResponse(c, err)
+	}
+
+	// Get the file from form data
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No file provided",
+		})
+	}
+
+	// Validate and save the file outside the public uploads directory
+	saved, err := saveUpload(c, file, attachmentUploads)
+	if err != nil {
+		return uploadErrorResponse(c, err)
+	}
+
+	// Insert the message and its attachment together. The file is removed if
+	// they are not saved, and nobody is notified.
+	message, err := insertMessage(c.UserContext(), conversationID, senderID, conversationReceiver(participants, senderID), conversation.ItemID, c.FormValue("content"),
+		models.MessageAttachment{
+			ConversationID: conversationID,
+			UploaderID:     senderID,
+			Filename:       truncate(filepath.Base(file.Filename), 255),
+			ContentType:    saved.ContentType,
+			SizeBytes:      saved.Size,
+			StorageName:    saved.Filename,
+			CreatedAt:      time.Now(),
+		})
+	if err != nil {
+		logging.Ctx(c).Error("Error sending attachment", "error", err)
+		if err := os.Remove(filepath.Join(attachmentUploads.Dir, saved.Filename)); err != nil {
+			logging.Ctx(c).Error("Error removing unsaved attachment", "error", err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error sending message",
+		})
+	}
+	attachment := message.Attachments[0]
+	attachment.URL = attachmentURL(attachment.ID)
+	message.Attachments[0] = attachment
+
+	// Push the message to the participants' open connections
+	publishToConversation(c.UserContext(), conversationID, realtime.MessageNew, message)
+
+	return messageSentResponse(c, message, fiber.Map{
+		"message":    "Attachment sent successfully",
+		"attachment": attachment,
+	})
+}
+
+// GetMessageAttachment serves an attachment to the participants of its conversation
+func GetMessageAttachment(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get attachment ID from URL parameter
+	attachmentID, err := c.ParamsInt("id")
+	if err != nil || attachmentID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	// Get attachment from database
+	attachment, err := messageRepo.Attachment(c.UserContext(), attachmentID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	}
+
+	// Only participants of the conversation may download it
+	if _, ok := participantRole(c.UserContext(), attachment.ConversationID, userID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, "inline; filename="+strconv.Quote(attachment.Filename))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Set("X-Content-Type-Options", "nosniff")
+	return c.SendFile(filepath.Join(attachmentUploads.Dir, attachment.StorageName))
+}
+
+// attachmentURL returns the authenticated download URL for an attachment
+func attachmentURL(id int) string {
+	return "/api/v1/user/attachments/" + strconv.Itoa(id)
+}
+
+// messageAttachments returns the attachments of the given messages keyed by message ID
+func messageAttachments(ctx context.Context, messageIDs []int) (map[int][]models.MessageAttachment, error) {
+	attachments, err := messageRepo.Attachments(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[int][]models.MessageAttachment{}
+	for _, attachment := range attachments {
+		attachment.URL = attachmentURL(attachment.ID)
+		result[attachment.MessageID] = append(result[attachment.MessageID], attachment)
+	}
+	return result, nil
+}
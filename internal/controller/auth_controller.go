@@ -1,25 +1,25 @@
 package controller
 
 import (
-	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
 	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
 	"github.com/omniflare/campus-lostandfound/internal/utils/jwt"
+	"github.com/omniflare/campus-lostandfound/internal/utils/lockout"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // RegisterUser handles user registration
 func RegisterUser(c *fiber.Ctx) error {
-	// Log the content type to debug
-	fmt.Println("Content-Type:", c.Get("Content-Type"))
-
 	// Parse request body
 	var register models.Register
 	if err := c.BodyParser(&register); err != nil {
-		fmt.Println("Error parsing request body:", err)
+		logging.Ctx(c).Debug("Error parsing registration body", "content_type", c.Get("Content-Type"), "error", err)
 		// Return more detailed error message
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request format: " + err.Error(),
@@ -34,27 +34,28 @@ func RegisterUser(c *fiber.Ctx) error {
 	}
 
 	// Check if username already exists
-	var count int
-	err := database.DB.Get(&count, "SELECT COUNT(*) FROM users WHERE username = $1", register.Username)
+	taken, err := userRepo.UsernameTaken(c.UserContext(), register.Username)
 	if err != nil {
+		logging.Ctx(c).Error("Database error", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
-	if count > 0 {
+	if taken {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "Username already exists",
 		})
 	}
 
 	// Check if email already exists
-	err = database.DB.Get(&count, "SELECT COUNT(*) FROM users WHERE email = $1", register.Email)
+	taken, err = userRepo.EmailTaken(c.UserContext(), register.Email)
 	if err != nil {
+		logging.Ctx(c).Error("Database error", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
-	if count > 0 {
+	if taken {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "Email already exists",
 		})
@@ -63,6 +64,7 @@ func RegisterUser(c *fiber.Ctx) error {
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(register.Password), bcrypt.DefaultCost)
 	if err != nil {
+		logging.Ctx(c).Error("Error hashing password", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error hashing password",
 		})
@@ -70,14 +72,19 @@ func RegisterUser(c *fiber.Ctx) error {
 
 	// Create new user
 	now := time.Now()
-	var userID int
-	err = database.DB.QueryRow(`
-		INSERT INTO users (username, email, password_hash, role, first_name, last_name, phone, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
-	`, register.Username, register.Email, string(hashedPassword), "student", register.FirstName, register.LastName, register.Phone, now, now).Scan(&userID)
-
-	if err != nil {
+	user := models.User{
+		Username:     register.Username,
+		Email:        register.Email,
+		PasswordHash: string(hashedPassword),
+		Role:         "student",
+		FirstName:    register.FirstName,
+		LastName:     register.LastName,
+		Phone:        register.Phone,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := userRepo.Create(c.UserContext(), &user); err != nil {
+		logging.Ctx(c).Error("Error creating user", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error creating user",
 		})
@@ -86,7 +93,7 @@ func RegisterUser(c *fiber.Ctx) error {
 	// Return success message
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "User registered successfully",
-		"user_id": userID,
+		"user_id": user.ID,
 	})
 }
 
@@ -107,26 +114,82 @@ func LoginUser(c *fiber.Ctx) error {
 		})
 	}
 
+	ctx := c.UserContext()
+	now := time.Now()
+
+	// Record the attempt before counting recent failures, so that concurrent
+	// attempts from the same IP count each other. It stays pending until its
+	// outcome is known.
+	attemptID, err := beginLoginAttempt(c, login.Username, now)
+	if err != nil {
+		logging.Ctx(c).Error("Error recording login attempt", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	// Throttle IP addresses with too many recent failures
+	ipFailures, lastFailure, err := loginAttemptRepo.RecentFailures(ctx, c.IP(), now.Add(-lockout.IPWindow), attemptID)
+	if err != nil {
+		logging.Ctx(c).Error("Error counting failed logins", "error", err)
+		finishLoginAttempt(c, attemptID, nil, "throttled")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if lastFailure != nil {
+		if wait := lockout.IPRetryAfter(ipFailures, *lastFailure, now); wait > 0 {
+			finishLoginAttempt(c, attemptID, nil, "throttled")
+			return tooManyLoginAttempts(c, wait)
+		}
+	}
+
 	// Get user from database
-	var user models.User
-	err := database.DB.Get(&user, "SELECT * FROM users WHERE username = $1", login.Username)
+	user, err := userRepo.GetByUsername(ctx, login.Username)
 	if err != nil {
+		finishLoginAttempt(c, attemptID, nil, "unknown_user")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid username or password",
 		})
 	}
 
+	// Reject locked accounts without checking the password
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		finishLoginAttempt(c, attemptID, &user.ID, "locked")
+		return tooManyLoginAttempts(c, user.LockedUntil.Sub(now))
+	}
+
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(login.Password))
 	if err != nil {
+		// Count the failure in the database, so concurrent failures all count,
+		// and lock the account once the new count reaches the limit
+		failures, err := userRepo.AddLoginFailure(ctx, user.ID)
+		if err != nil {
+			logging.Ctx(c).Error("Error updating failed login count", "error", err)
+		} else if until := lockout.AccountLockedUntil(failures, now); until != nil {
+			if err := userRepo.LockUntil(ctx, user.ID, *until); err != nil {
+				logging.Ctx(c).Error("Error locking account", "error", err)
+			}
+		}
+		finishLoginAttempt(c, attemptID, &user.ID, "invalid_password")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid username or password",
 		})
 	}
 
+	// Reset the failure counter after a successful login
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		if err := userRepo.ResetLoginFailures(ctx, user.ID); err != nil {
+			logging.Ctx(c).Error("Error resetting failed login count", "error", err)
+		}
+	}
+	finishLoginAttempt(c, attemptID, &user.ID, "success")
+
 	// Generate JWT token
 	token, err := jwt.Generate(user)
 	if err != nil {
+		logging.Ctx(c).Error("Error generating token", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error generating token",
 		})
@@ -138,20 +201,61 @@ func LoginUser(c *fiber.Ctx) error {
 	})
 }
 
+// beginLoginAttempt stores a pending login attempt in the audit table and
+// returns its ID. Pending attempts count as failures until they are finished.
+func beginLoginAttempt(c *fiber.Ctx, username string, now time.Time) (int, error) {
+	attempt := models.LoginAttempt{
+		Username:  username,
+		IPAddress: c.IP(),
+		UserAgent: truncate(c.Get("User-Agent"), 255),
+		Reason:    "pending",
+		CreatedAt: now,
+	}
+	err := loginAttemptRepo.Create(c.UserContext(), &attempt)
+	return attempt.ID, err
+}
+
+// finishLoginAttempt records the outcome of a pending login attempt
+func finishLoginAttempt(c *fiber.Ctx, id int, userID *int, reason string) {
+	if err := loginAttemptRepo.Finish(c.UserContext(), id, userID, reason); err != nil {
+		logging.Ctx(c).Error("Error recording login attempt", "error", err)
+	}
+}
+
+// tooManyLoginAttempts responds with 429 and a Retry-After header
+func tooManyLoginAttempts(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       "Too many failed login attempts. Please try again later",
+		"retry_after": seconds,
+	})
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
 // GetUserProfile gets the current user's profile
 func GetUserProfile(c *fiber.Ctx) error {
 	// Get user ID from JWT context
 	userID := c.Locals("user_id").(int)
 
 	// Get user from database
-	var user models.User
-	err := database.DB.Get(&user, "SELECT id, username, email, role, first_name, last_name, phone, created_at, updated_at FROM users WHERE id = $1", userID)
+	user, err := userRepo.Get(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
+	// Lockout state is only shown to admins
+	user.FailedLoginCount, user.LockedUntil = 0, nil
+
 	return c.Status(fiber.StatusOK).JSON(user)
 }
 
@@ -175,13 +279,14 @@ func UpdateUserProfile(c *fiber.Ctx) error {
 	}
 
 	// Update user in database
-	_, err := database.DB.Exec(`
-		UPDATE users 
-		SET first_name = $1, last_name = $2, phone = $3, email = $4, updated_at = $5 
-		WHERE id = $6
-	`, updateData.FirstName, updateData.LastName, updateData.Phone, updateData.Email, time.Now(), userID)
-
+	err := userRepo.UpdateProfile(c.UserContext(), userID, repository.ProfileUpdate{
+		FirstName: updateData.FirstName,
+		LastName:  updateData.LastName,
+		Phone:     updateData.Phone,
+		Email:     updateData.Email,
+	})
 	if err != nil {
+		logging.Ctx(c).Error("Error updating user profile", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error updating user profile",
 		})
@@ -197,6 +302,13 @@ func ChangePassword(c *fiber.Ctx) error {
 	// Get user ID from JWT context
 	userID := c.Locals("user_id").(int)
 
+	// A leaked API key must not be enough to take over the account
+	if c.Locals("api_key_id") != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Passwords cannot be changed with an API key",
+		})
+	}
+
 	// Parse request body
 	var passwordData struct {
 		CurrentPassword string `json:"current_password"`
@@ -210,16 +322,16 @@ func ChangePassword(c *fiber.Ctx) error {
 	}
 
 	// Get current password hash from database
-	var passwordHash string
-	err := database.DB.Get(&passwordHash, "SELECT password_hash FROM users WHERE id = $1", userID)
+	user, err := userRepo.Get(c.UserContext(), userID)
 	if err != nil {
+		logging.Ctx(c).Error("Database error", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
 
 	// Verify current password
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(passwordData.CurrentPassword))
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(passwordData.CurrentPassword))
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Current password is incorrect",
@@ -229,15 +341,16 @@ func ChangePassword(c *fiber.Ctx) error {
 	// Hash new password
 	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordData.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
+		logging.Ctx(c).Error("Error hashing password", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error hashing password",
 		})
 	}
 
 	// Update password in database
-	_, err = database.DB.Exec("UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3",
-		string(newHashedPassword), time.Now(), userID)
+	err = userRepo.SetPassword(c.UserContext(), userID, string(newHashedPassword))
 	if err != nil {
+		logging.Ctx(c).Error("Error updating password", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error updating password",
 		})
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/utils/lockout"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse"
+
+func TestLoginAccountLockout(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		createUserWithPassword(t, store, "alice")
+		createUserWithPassword(t, store, "bob")
+
+		// Every failure up to the limit is rejected as a wrong password
+		for i := 1; i <= lockout.MaxAccountFailures; i++ {
+			if status, _ := login(t, app, "alice", "wrong"); status != http.StatusUnauthorized {
+				t.Fatalf("failure %d: status %d, want %d", i, status, http.StatusUnauthorized)
+			}
+		}
+
+		// The account is then locked, even for the right password
+		status, retryAfter := login(t, app, "alice", testPassword)
+		if status != http.StatusTooManyRequests {
+			t.Fatalf("locked account: status %d, want %d", status, http.StatusTooManyRequests)
+		}
+		if want := int(lockout.BaseDelay.Seconds()); retryAfter < want-1 || retryAfter > want {
+			t.Errorf("Retry-After = %d, want about %d", retryAfter, want)
+		}
+
+		// Other accounts from the same IP are not affected
+		if status, _ := login(t, app, "bob", testPassword); status != http.StatusOK {
+			t.Errorf("other account: status %d, want %d", status, http.StatusOK)
+		}
+	})
+}
+
+func TestLoginIPThrottle(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		createUserWithPassword(t, store, "alice")
+
+		// Failures for unknown users count toward the IP limit only
+		for i := 1; i <= lockout.MaxIPFailures; i++ {
+			if status, _ := login(t, app, "nobody"+strconv.Itoa(i), "wrong"); status != http.StatusUnauthorized {
+				t.Fatalf("failure %d: status %d, want %d", i, status, http.StatusUnauthorized)
+			}
+		}
+
+		status, retryAfter := login(t, app, "alice", testPassword)
+		if status != http.StatusTooManyRequests {
+			t.Fatalf("throttled IP: status %d, want %d", status, http.StatusTooManyRequests)
+		}
+		if want := int(lockout.BaseDelay.Seconds()); retryAfter < want-1 || retryAfter > want {
+			t.Errorf("Retry-After = %d, want about %d", retryAfter, want)
+		}
+
+		// The throttled attempt did not count against the account
+		user, err := store.repos.Users.GetByUsername(context.Background(), "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.FailedLoginCount != 0 || user.LockedUntil != nil {
+			t.Errorf("account has %d failures, locked until %v", user.FailedLoginCount, user.LockedUntil)
+		}
+	})
+}
+
+// createUserWithPassword adds a student whose password is testPassword
+func createUserWithPassword(t *testing.T, store testStore, username string) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{
+		Username:     username,
+		Email:        username + "@example.edu",
+		PasswordHash: string(hash),
+		Role:         "student",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := store.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+}
+
+// login posts credentials and returns the status and the Retry-After header
+// in seconds, checking that it matches retry_after in the body
+func login(t *testing.T, app *fiber.App, username, password string) (status, retryAfter int) {
+	t.Helper()
+
+	raw, _ := json.Marshal(models.Login{Username: username, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("logging in as %s: %v", username, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return resp.StatusCode, 0
+	}
+	var body struct {
+		RetryAfter int `json:"retry_after"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding 429 response: %v", err)
+	}
+	retryAfter, err = strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	if err != nil || retryAfter != body.RetryAfter {
+		t.Errorf("Retry-After header %q does not match retry_after %d", resp.Header.Get(fiber.HeaderRetryAfter), body.RetryAfter)
+	}
+	return resp.StatusCode, retryAfter
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/middleware"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+)
+
+// testStore is a backend the handlers under test read and write through
+type testStore struct {
+	repos repository.Repositories
+	// events returns the outbox events recorded so far, oldest first
+	events func(t *testing.T) []events.Event
+}
+
+// memoryStore keeps records in memory. Handlers that check role permissions
+// need sqliteStore, because permissions are read from the database.
+func memoryStore(t *testing.T) testStore {
+	store := repository.NewMemory()
+	return testStore{
+		repos:  store.Repositories(),
+		events: func(t *testing.T) []events.Event { return store.Events() },
+	}
+}
+
+// sqliteStore uses the Postgres repositories on a migrated in-memory SQLite database
+func sqliteStore(t *testing.T) testStore {
+	t.Helper()
+
+	db := databasetest.Open(t)
+	if err := permissions.Seed(context.Background()); err != nil {
+		t.Fatalf("seeding permissions: %v", err)
+	}
+	return testStore{
+		repos: repository.NewPostgres(db),
+		events: func(t *testing.T) []events.Event {
+			t.Helper()
+			var rows []struct {
+				ID        string    `db:"event_id"`
+				Type      string    `db:"event_type"`
+				Payload   string    `db:"payload"`
+				CreatedAt time.Time `db:"created_at"`
+			}
+			if err := db.Select(&rows, "SELECT event_id, event_type, payload, created_at FROM outbox ORDER BY id"); err != nil {
+				t.Fatalf("reading outbox: %v", err)
+			}
+			recorded := make([]events.Event, len(rows))
+			for i, row := range rows {
+				recorded[i] = events.Event{ID: row.ID, Type: row.Type, Time: row.CreatedAt, Data: json.RawMessage(row.Payload)}
+			}
+			return recorded
+		},
+	}
+}
+
+// forEachStore runs a handler test against every backend
+func forEachStore(t *testing.T, test func(t *testing.T, app *fiber.App, store testStore)) {
+	for _, backend := range []struct {
+		name string
+		open func(t *testing.T) testStore
+	}{
+		{"memory", memoryStore},
+		{"sqlite", sqliteStore},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			test(t, testApp(store), store)
+		})
+	}
+}
+
+// testApp serves the handlers under test from a store. Requests act as the
+// user whose ID is in the X-User-ID header, with their role, like after JWT
+// auth. Requests with an X-API-Key header are authenticated by middleware.Auth.
+func testApp(store testStore) *fiber.App {
+	UseRepositories(store.repos)
+	middleware.UseAPIKeys(store.repos.APIKeys)
+	auth := middleware.Auth()
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-API-Key") != "" {
+			return auth(c)
+		}
+		if id, err := strconv.Atoi(c.Get("X-User-ID")); err == nil {
+			user, err := store.repos.Users.Get(c.UserContext(), id)
+			if err != nil {
+				return err
+			}
+			c.Locals("user_id", user.ID)
+			c.Locals("role", user.Role)
+		}
+		return c.Next()
+	})
+	app.Post("/auth/login", LoginUser)
+	app.Post("/items/lost", ReportLostItem)
+	app.Post("/items/found", ReportFoundItem)
+	app.Get("/items", GetItems)
+	app.Get("/items/search", SearchItems)
+	app.Get("/items/:id", GetItemDetails)
+	app.Put("/items/:id/status", UpdateItemStatus)
+	app.Get("/user/items", GetUserItems)
+	app.Post("/messages", SendMessage)
+	app.Get("/messages/conversations", GetConversations)
+	app.Get("/messages/unread", GetUnreadMessageCount)
+	app.Get("/messages/:id", GetMessages)
+	app.Get("/conversations/:id/messages", GetConversationMessages)
+	app.Get("/user/api-keys", GetAPIKeys)
+	app.Post("/user/api-keys", CreateAPIKey)
+	app.Delete("/user/api-keys/:id", RevokeAPIKey)
+	app.Post("/admin/users/:id/api-keys", AdminCreateAPIKey)
+	app.Put("/admin/roles/:role/permissions", UpdateRolePermissions)
+	app.Get("/user/notification-preferences", GetNotificationPreferences)
+	app.Put("/user/notification-preferences", UpdateNotificationPreferences)
+	app.Get("/unsubscribe", UnsubscribePage)
+	app.Post("/unsubscribe", Unsubscribe)
+	return app
+}
+
+// createUser adds a user with a role to the store and returns its ID
+func createUser(t *testing.T, store testStore, username, role string) int {
+	t.Helper()
+
+	user := models.User{
+		Username:     username,
+		Email:        username + "@example.edu",
+		PasswordHash: "unused",
+		Role:         role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := store.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user.ID
+}
+
+// request sends a JSON request as userID and decodes the JSON response into out
+func request(t *testing.T, app *fiber.App, method, path string, userID int, body, out interface{}) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req.Header.Set("X-User-ID", strconv.Itoa(userID))
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decoding %s %s response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/middleware"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/realtime"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+)
+
+// GetConversationMessages gets the messages of a conversation the user takes part in
+func GetConversationMessages(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get conversation ID from URL parameter
+	conversationID, err := c.ParamsInt("id")
+	if err != nil || conversationID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	// Only participants can read a conversation
+	if _, ok := participantRole(c.UserContext(), conversationID, userID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	// Parse pagination parameters
+	page, limit, offset := pagination(c, 50)
+
+	// Get messages from database
+	messages, total, err := messageRepo.ListInConversation(c.UserContext(), conversationID, limit, offset)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving messages", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving messages",
+		})
+	}
+
+	// Attach files sent with the messages
+	messageIDs := make([]int, len(messages))
+	for i := range messages {
+		messageIDs[i] = messages[i].ID
+	}
+	attachments, err := messageAttachments(c.UserContext(), messageIDs)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving attachments", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving attachments",
+		})
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+
+	// Get participants
+	participants, err := conversationRepo.Participants(c.UserContext(), conversationID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving participants", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving participants",
+		})
+	}
+
+	// Mark messages as read and notify the other participants
+	markConversationRead(c.UserContext(), conversationID, userID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"messages":     messages,
+		"participants": participants,
+		"meta":         pageMeta(total, page, limit),
+	})
+}
+
+// SendConversationMessage sends a message to every participant of a conversation
+func SendConversationMessage(c *fiber.Ctx) error {
+	// Get sender ID from JWT context
+	senderID := c.Locals("user_id").(int)
+
+	// Get conversation ID from URL parameter
+	conversationID, err := c.ParamsInt("id")
+	if err != nil || conversationID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	// Parse request body
+	var messageReq models.MessageRequest
+	if err := c.BodyParser(&messageReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate required fields
+	if messageReq.Content == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Message content is required",
+		})
+	}
+
+	return sendConversationMessage(c, senderID, conversationID, messageReq.Content)
+}
+
+// AddConversationParticipant adds a mediator such as a guard to a conversation
+func AddConversationParticipant(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get conversation ID from URL parameter
+	conversationID, err := c.ParamsInt("id")
+	if err != nil || conversationID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	// Parse request body, defaulting to the current user joining
+	var addReq struct {
+		UserID int `json:"user_id"`
+	}
+	if err := c.BodyParser(&addReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+	if addReq.UserID == 0 {
+		addReq.UserID = userID
+	}
+
+	// Participants may invite a mediator, mediators may join any conversation
+	_, isParticipant := participantRole(c.UserContext(), conversationID, userID)
+	if !isParticipant && !middleware.HasPermission(c, permissions.ConversationsMediate) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	// Check the conversation exists
+	if _, err := conversationRepo.Get(c.UserContext(), conversationID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	// Only users whose role allows mediation can be added
+	user, err := userRepo.Get(c.UserContext(), addReq.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if !permissions.Has(c.UserContext(), user.Role, permissions.ConversationsMediate) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Only guards can be added to mediate a conversation",
+		})
+	}
+
+	// Add the mediator
+	if err := conversationRepo.AddParticipant(c.UserContext(), conversationID, addReq.UserID, "mediator"); err != nil {
+		logging.Ctx(c).Error("Error adding participant", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error adding participant",
+		})
+	}
+
+	participants, err := conversationRepo.Participants(c.UserContext(), conversationID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving participants", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving participants",
+		})
+	}
+
+	// Let everyone in the conversation know who joined
+	publishToConversation(c.UserContext(), conversationID, realtime.ConversationParticipantAdded, fiber.Map{
+		"conversation_id": conversationID,
+		"user_id":         addReq.UserID,
+		"participants":    participants,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Participant added successfully",
+		"participants": participants,
+	})
+}
+
+// GetItemConversations lists the conversations about an item. Participants see
+// their own conversations, mediators see all of them.
+func GetItemConversations(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get item ID from URL parameter
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid item ID",
+		})
+	}
+
+	conversations, err := listConversations(c.UserContext(), userID, &itemID, middleware.HasPermission(c, permissions.ConversationsMediate))
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving conversations", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving conversations",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(conversations)
+}
+
+// sendConversationMessage inserts a message into an existing conversation and pushes it to the participants
+func sendConversationMessage(c *fiber.Ctx, senderID, conversationID int, content string) error {
+	// Only participants can post
+	if _, ok := participantRole(c.UserContext(), conversationID, senderID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	conversation, err := conversationRepo.Get(c.UserContext(), conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	participants, err := conversationRepo.Participants(c.UserContext(), conversationID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving participants", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving participants",
+		})
+	}
+
+	// Respect blocks between the participants
+	if err := checkConversationBlocks(c.UserContext(), participants, senderID); err != nil {
+		return messagingErrorResponse(c, err)
+	}
+
+	// Insert message into database
+	message, err := insertMessage(c.UserContext(), conversationID, senderID, conversationReceiver(participants, senderID), conversation.ItemID, content)
+	if err != nil {
+		logging.Ctx(c).Error("Error sending message", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error sending message",
+		})
+	}
+
+	// Push the message to the participants' open connections
+	publishToConversation(c.UserContext(), conversationID, realtime.MessageNew, message)
+
+	return messageSentResponse(c, message, nil)
+}
+
+// conversationReceiver returns the other user when a conversation has only two
+// participants, and nil when a message is addressed to a mediated group
+func conversationReceiver(participants []models.ConversationParticipant, senderID int) *int {
+	if len(participants) != 2 {
+		return nil
+	}
+	for _, p := range participants {
+		if p.UserID != senderID {
+			id := p.UserID
+			return &id
+		}
+	}
+	return nil
+}
+
+// insertMessage stores a message and its attachments in a conversation and
+// bumps the conversation's activity time. The other participants are notified
+// by the message.created event once they are saved.
+func insertMessage(ctx context.Context, conversationID, senderID int, receiverID, itemID *int, content string, attachments ...models.MessageAttachment) (models.Message, error) {
+	// Detect, and in masked contact mode hide, phone numbers and emails
+	content, detected, redacted, err := applyContactPolicy(ctx, conversationID, content)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	now := time.Now()
+	message := models.Message{
+		ConversationID:      &conversationID,
+		SenderID:            senderID,
+		ReceiverID:          receiverID,
+		ItemID:              itemID,
+		Content:             content,
+		CreatedAt:           now,
+		ContainsContactInfo: detected,
+		ContactInfoRedacted: redacted,
+		Attachments:         attachments,
+	}
+
+	err = messageRepo.Create(ctx, &message)
+	return message, err
+}
+
+// participantRole returns the user's role in a conversation and whether they take part in it
+func participantRole(ctx context.Context, conversationID, userID int) (string, bool) {
+	role, err := conversationRepo.ParticipantRole(ctx, conversationID, userID)
+	if err != nil {
+		return "", false
+	}
+	return role, true
+}
+
+// publishToConversation pushes a realtime event to every participant of a conversation
+func publishToConversation(ctx context.Context, conversationID int, eventType string, data interface{}) {
+	participants, err := conversationRepo.Participants(ctx, conversationID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error retrieving conversation participants", "conversation_id", conversationID, "error", err)
+		return
+	}
+	userIDs := make([]int, len(participants))
+	for i, p := range participants {
+		userIDs[i] = p.UserID
+	}
+	realtime.Publish(eventType, data, userIDs...)
+}
+
+// markConversationRead advances the user's read position and sends a read receipt to the other participants
+func markConversationRead(ctx context.Context, conversationID, userID int) {
+	marked, err := conversationRepo.MarkRead(ctx, conversationID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating conversation read position", "conversation_id", conversationID, "error", err)
+		return
+	}
+
+	if marked > 0 {
+		publishToConversation(ctx, conversationID, realtime.MessageRead, fiber.Map{
+			"conversation_id": conversationID,
+			"reader_id":       userID,
+			"read_at":         time.Now(),
+		})
+	}
+}
+
+// listConversations returns the conversations the user takes part in, optionally
+// limited to one item. With all set, every conversation about the item is returned.
+func listConversations(ctx context.Context, userID int, itemID *int, all bool) ([]models.ConversationSummary, error) {
+	conversations, err := conversationRepo.List(ctx, repository.ConversationFilter{UserID: userID, ItemID: itemID, All: all})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attach participants and work out the other party for direct conversations
+	for i := range conversations {
+		participants, err := conversationRepo.Participants(ctx, conversations[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		conversations[i].Participants = participants
+		for _, p := range participants {
+			if p.UserID != userID && p.Role == "participant" {
+				id := p.UserID
+				conversations[i].OtherUserID = &id
+				conversations[i].OtherUsername = p.Username
+				break
+			}
+		}
+	}
+
+	return conversations, nil
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/notifications"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+)
+
+// matchWindow limits matching to recently reported items
+const matchWindow = 30 * 24 * time.Hour
+
+// RegisterEventHandlers subscribes the notification center to outbox events
+func RegisterEventHandlers() {
+	events.Handle(notifyItemMatches, events.ItemCreated)
+	events.Handle(notifyItemStatusChanged, events.ItemStatusChanged)
+	events.Handle(notifyReportResolved, events.ReportResolved)
+	events.Handle(notifyNewMessage, events.MessageCreated)
+}
+
+// notifyItemMatches looks for recent items of the opposite status in the same
+// category that share a word of a new item's title, and notifies the owners of the lost items.
+// Only items created before the new one are matched, so each pair is reported
+// once, by the event of its later item.
+func notifyItemMatches(tx *events.Tx, event events.Event) error {
+	var item models.Item
+	if err := json.Unmarshal(event.Data, &item); err != nil {
+		return err
+	}
+
+	patterns := titlePatterns(item.Title)
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	// The user who reported the item never matches their own items
+	userID := 0
+	matchStatus := "found"
+	if item.Status == "found" {
+		matchStatus = "lost"
+		if item.FinderID != nil {
+			userID = *item.FinderID
+		}
+	} else if item.ReporterID != nil {
+		userID = *item.ReporterID
+	}
+
+	// The title must contain at least one of the words
+	args := []interface{}{matchStatus, item.Category, item.CreatedAt.Add(-matchWindow), item.ID, userID}
+	titleMatches := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		args = append(args, pattern)
+		titleMatches[i] = fmt.Sprintf("title ILIKE $%d", len(args))
+	}
+
+	var matches []models.Item
+	err := tx.Select(&matches, `
+		SELECT * FROM items
+		WHERE status = $1 AND category = $2 AND created_at > $3 AND id < $4
+			AND COALESCE(reporter_id, 0) <> $5 AND COALESCE(finder_id, 0) <> $5
+			AND (`+strings.Join(titleMatches, " OR ")+`)
+		ORDER BY created_at DESC
+		LIMIT 20
+	`, args...)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// A new lost item notifies its reporter once about all of its matches
+	if item.Status == "lost" {
+		if item.ReporterID == nil {
+			return nil
+		}
+		matchIDs := make([]int, len(matches))
+		for i, match := range matches {
+			matchIDs[i] = match.ID
+		}
+		return notifications.NotifyTx(tx, notifications.MatchNew, "Possible match for your lost item",
+			fmt.Sprintf("%d found item(s) may match \"%s\"", len(matches), item.Title), fiber.Map{
+				"item_id": item.ID,
+				"matches": matchIDs,
+			}, *item.ReporterID)
+	}
+
+	// A new found item notifies the reporter of each lost item it may match
+	for _, match := range matches {
+		if match.ReporterID == nil {
+			continue
+		}
+		err := notifications.NotifyTx(tx, notifications.MatchNew, "Possible match for your lost item",
+			fmt.Sprintf("A found item \"%s\" may match \"%s\"", item.Title, match.Title), fiber.Map{
+				"item_id": match.ID,
+				"matches": []int{item.ID},
+			}, *match.ReporterID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// titlePatterns returns ILIKE patterns for the significant words of a title
+func titlePatterns(title string) []string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := map[string]bool{}
+	var patterns []string
+	for _, word := range words {
+		if len(word) < 3 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		patterns = append(patterns, "%"+word+"%")
+	}
+	return patterns
+}
+
+// notifyItemStatusChanged notifies the item's reporter and finder, other than
+// the user making the change, about a new status
+func notifyItemStatusChanged(tx *events.Tx, event events.Event) error {
+	var change repository.ItemStatusChange
+	if err := json.Unmarshal(event.Data, &change); err != nil {
+		return err
+	}
+	item, previous, userID := change.Item, change.PreviousStatus, change.ChangedBy
+
+	data := fiber.Map{
+		"item_id":         item.ID,
+		"previous_status": previous,
+		"status":          item.Status,
+	}
+
+	if item.ReporterID != nil && *item.ReporterID != userID {
+		var err error
+		switch {
+		case repository.IsClaimed(item.Status) && !repository.IsClaimed(previous):
+			err = notifications.NotifyTx(tx, notifications.ClaimApproved, "Your claim was approved",
+				fmt.Sprintf("\"%s\" has been marked as %s", item.Title, item.Status), data, *item.ReporterID)
+		case previous == "claimed" && !repository.IsClaimed(item.Status):
+			err = notifications.NotifyTx(tx, notifications.ClaimRejected, "Your claim was rejected",
+				fmt.Sprintf("\"%s\" is no longer marked as claimed", item.Title), data, *item.ReporterID)
+		default:
+			err = notifications.NotifyTx(tx, notifications.ItemStatusChanged, "Item status changed",
+				fmt.Sprintf("\"%s\" is now %s", item.Title, item.Status), data, *item.ReporterID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if item.FinderID != nil && *item.FinderID != userID && (item.ReporterID == nil || *item.FinderID != *item.ReporterID) {
+		return notifications.NotifyTx(tx, notifications.ItemStatusChanged, "Item status changed",
+			fmt.Sprintf("\"%s\" is now %s", item.Title, item.Status), data, *item.FinderID)
+	}
+	return nil
+}
+
+// notifyReportResolved lets the user who filed a report know its outcome
+func notifyReportResolved(tx *events.Tx, event events.Event) error {
+	var resolution repository.ReportResolution
+	if err := json.Unmarshal(event.Data, &resolution); err != nil {
+		return err
+	}
+	if resolution.ReporterID == nil {
+		return nil
+	}
+
+	return notifications.NotifyTx(tx, notifications.ReportResolved, "Your report was "+resolution.Status, resolution.Comment, fiber.Map{
+		"report_id": resolution.ReportID,
+		"status":    resolution.Status,
+	}, *resolution.ReporterID)
+}
+
+// notifyNewMessage notifies the other participants of a message's
+// conversation, except those who have blocked its sender
+func notifyNewMessage(tx *events.Tx, event events.Event) error {
+	var message models.Message
+	if err := json.Unmarshal(event.Data, &message); err != nil {
+		return err
+	}
+	if message.ConversationID == nil {
+		return nil
+	}
+
+	var recipients []int
+	err := tx.Select(&recipients, `
+		SELECT p.user_id FROM conversation_participants p
+		WHERE p.conversation_id = $1 AND p.user_id <> $2
+			AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = p.user_id AND b.blocked_id = $2)
+	`, *message.ConversationID, message.SenderID)
+	if err != nil {
+		return err
+	}
+
+	var senderUsername string
+	if err := tx.Get(&senderUsername, "SELECT username FROM users WHERE id = $1", message.SenderID); err != nil {
+		return err
+	}
+
+	return notifications.NotifyTx(tx, notifications.MessageNew, "New message from "+senderUsername, message.Content, fiber.Map{
+		"conversation_id": message.ConversationID,
+		"message_id":      message.ID,
+		"sender_id":       message.SenderID,
+	}, recipients...)
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+)
+
+// readinessTimeout bounds all readiness checks together, so that a hung
+// database fails the probe instead of stalling it
+const readinessTimeout = 2 * time.Second
+
+// workers are the background workers reported by Ready, set with UseWorkers
+var workers *worker.Supervisor
+
+// UseWorkers sets the supervisor whose worker heartbeats Ready reports
+func UseWorkers(s *worker.Supervisor) {
+	workers = s
+}
+
+// storageCheckTTL is how long the upload storage check is reused, so that
+// frequent probes do not create a file on every call
+const storageCheckTTL = 5 * time.Second
+
+// storageCheck caches the latest upload storage check
+var storageCheck struct {
+	sync.Mutex
+	checkedAt           time.Time
+	images, attachments error
+}
+
+// componentStatus is the outcome of one readiness check
+type componentStatus struct {
+	Status string `json:"status"` // ok, degraded or unhealthy
+	Error  string `json:"error,omitempty"`
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies so that an orchestrator does not restart the API during a
+// database outage.
+func Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// Ready reports whether the API can serve traffic: the database answers, the
+// upload directories are writable and the schema is up to date. It responds
+// 503 with each component's status otherwise. Background workers that are
+// restarting after a panic or have stopped beating, and failed outbox events,
+// are reported as degraded without failing the probe, since the API still
+// serves requests and a restart would not fix them. Whenever a component is
+// not ok the body includes each component's status and error. Requests that
+// send metricsToken, when it is set, also get the database, migration and
+// worker details.
+func Ready(metricsToken string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+		defer cancel()
+
+		healthy := true
+		check := func(component string, err error) componentStatus {
+			if err != nil {
+				healthy = false
+				logging.Ctx(c).Warn("Readiness check failed", "component", component, "error", err)
+				return componentStatus{Status: "unhealthy", Error: err.Error()}
+			}
+			return componentStatus{Status: "ok"}
+		}
+		// warn reports a problem that needs attention but does not stop serving traffic
+		warn := func(component string, err error) componentStatus {
+			if err != nil {
+				logging.Ctx(c).Warn("Readiness check degraded", "component", component, "error", err)
+				return componentStatus{Status: "degraded", Error: err.Error()}
+			}
+			return componentStatus{Status: "ok"}
+		}
+
+		// Database
+		start := time.Now()
+		dbStatus := check("database", database.DB.PingContext(ctx))
+		dbLatency := float64(time.Since(start).Microseconds()) / 1000
+
+		// Upload storage
+		imagesErr, attachmentsErr := checkStorage()
+		images, attachments := check("images", imagesErr), check("attachments", attachmentsErr)
+		storageStatus := componentStatus{Status: "ok"}
+		if imagesErr != nil || attachmentsErr != nil {
+			storageStatus.Status = "unhealthy"
+		}
+
+		// Migrations
+		current, latest, err := database.SchemaVersion(ctx)
+		if err == nil && current < latest {
+			err = errors.New("migrations are pending")
+		}
+		migrations := check("migrations", err)
+
+		// Background workers
+		statuses := []worker.Status{}
+		if workers != nil {
+			statuses = workers.Statuses()
+		}
+		var stale []string
+		for _, s := range statuses {
+			if !s.Healthy {
+				stale = append(stale, s.Name)
+			}
+		}
+		var workerErr error
+		if len(stale) > 0 {
+			workerErr = fmt.Errorf("workers not running or not beating: %s", strings.Join(stale, ", "))
+		}
+		workerStatus := warn("workers", workerErr)
+
+		// Outbox events given up on, which an operator has to look at
+		failedEvents, err := events.FailedCount(ctx)
+		if err == nil && failedEvents > 0 {
+			err = fmt.Errorf("%d outbox events failed and are no longer retried", failedEvents)
+		}
+		outbox := warn("outbox", err)
+
+		status, code := "ok", fiber.StatusOK
+		if !healthy {
+			status, code = "unavailable", fiber.StatusServiceUnavailable
+		}
+		body := fiber.Map{
+			"status": status,
+			"checks": fiber.Map{
+				"database":   dbStatus.Status,
+				"storage":    storageStatus.Status,
+				"migrations": migrations.Status,
+				"workers":    workerStatus.Status,
+				"outbox":     outbox.Status,
+			},
+		}
+		degraded := workerStatus.Status != "ok" || outbox.Status != "ok"
+		switch {
+		case metricsToken != "" && metrics.HasToken(c, metricsToken):
+			body["details"] = fiber.Map{
+				"database": struct {
+					componentStatus
+					Driver    string  `json:"driver"`
+					LatencyMS float64 `json:"latency_ms"`
+				}{dbStatus, database.Driver, dbLatency},
+				"storage": fiber.Map{"images": images, "attachments": attachments},
+				"migrations": struct {
+					componentStatus
+					Version int `json:"version"`
+					Latest  int `json:"latest"`
+				}{migrations, current, latest},
+				"workers": struct {
+					componentStatus
+					Workers []worker.Status `json:"workers"`
+				}{workerStatus, statuses},
+				"outbox": struct {
+					componentStatus
+					Failed int `json:"failed"`
+				}{outbox, failedEvents},
+			}
+		case !healthy || degraded:
+			// Say what is wrong without the token, so that a failing probe can be diagnosed
+			body["details"] = fiber.Map{
+				"database":   dbStatus,
+				"storage":    fiber.Map{"images": images, "attachments": attachments},
+				"migrations": migrations,
+				"workers":    workerStatus,
+				"outbox":     outbox,
+			}
+		}
+		return c.Status(code).JSON(body)
+	}
+}
+
+// checkStorage checks that the upload directories are writable, reusing the
+// previous result for storageCheckTTL
+func checkStorage() (images, attachments error) {
+	storageCheck.Lock()
+	defer storageCheck.Unlock()
+	if time.Since(storageCheck.checkedAt) >= storageCheckTTL {
+		storageCheck.images = checkWritable(imageUploads.Dir)
+		storageCheck.attachments = checkWritable(attachmentUploads.Dir)
+		storageCheck.checkedAt = time.Now()
+	}
+	return storageCheck.images, storageCheck.attachments
+}
+
+// checkWritable creates and removes a file in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
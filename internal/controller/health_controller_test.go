@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+)
+
+type readyBody struct {
+	Status  string                     `json:"status"`
+	Checks  map[string]string          `json:"checks"`
+	Details map[string]json.RawMessage `json:"details"`
+}
+
+// readyApp serves Ready with the metrics token "secret" and upload
+// directories in a temporary directory, which it returns
+func readyApp(t *testing.T) (*fiber.App, string) {
+	t.Helper()
+	databasetest.Open(t)
+
+	dir := t.TempDir()
+	images, attachments := imageUploads.Dir, attachmentUploads.Dir
+	imageUploads.Dir, attachmentUploads.Dir = filepath.Join(dir, "images"), filepath.Join(dir, "attachments")
+	for _, d := range []string{imageUploads.Dir, attachmentUploads.Dir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storageCheck.checkedAt = time.Time{}
+	t.Cleanup(func() {
+		imageUploads.Dir, attachmentUploads.Dir = images, attachments
+		storageCheck.checkedAt = time.Time{}
+	})
+
+	app := fiber.New()
+	app.Get("/health/ready", Ready("secret"))
+	return app, dir
+}
+
+// ready requests the readiness probe, with the metrics token if withToken is set
+func ready(t *testing.T, app *fiber.App, withToken bool) (int, readyBody) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	if withToken {
+		req.Header.Set("Authorization", "Bearer secret")
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body readyBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("decoding %s: %v", raw, err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestReadyShowsErrorsWithoutToken(t *testing.T) {
+	app, dir := readyApp(t)
+
+	status, body := ready(t, app, false)
+	if status != http.StatusOK || body.Status != "ok" || body.Details != nil {
+		t.Fatalf("healthy: status %d, body %+v", status, body)
+	}
+
+	// A missing upload directory fails the probe and says why
+	if err := os.RemoveAll(filepath.Join(dir, "attachments")); err != nil {
+		t.Fatal(err)
+	}
+	storageCheck.checkedAt = time.Time{}
+	status, body = ready(t, app, false)
+	if status != http.StatusServiceUnavailable || body.Checks["storage"] != "unhealthy" {
+		t.Fatalf("status %d, checks %v", status, body.Checks)
+	}
+	if storage := string(body.Details["storage"]); !strings.Contains(storage, `"unhealthy"`) || !strings.Contains(storage, `"error"`) {
+		t.Errorf("storage details %s", storage)
+	}
+	// Driver, latency and worker details still need the token
+	if strings.Contains(string(body.Details["database"]), "driver") {
+		t.Errorf("database details without the token: %s", body.Details["database"])
+	}
+	if _, body = ready(t, app, true); !strings.Contains(string(body.Details["database"]), "driver") {
+		t.Errorf("database details with the token: %s", body.Details["database"])
+	}
+}
+
+func TestReadyReportsStaleWorkersAsDegraded(t *testing.T) {
+	app, _ := readyApp(t)
+
+	supervisor := worker.NewSupervisor()
+	supervisor.Go("broken", func(ctx context.Context) { panic("worker failed") })
+	supervisor.Go("steady", func(ctx context.Context) {
+		worker.Beat(ctx, time.Minute)
+		<-ctx.Done()
+	})
+	UseWorkers(supervisor)
+	t.Cleanup(func() {
+		UseWorkers(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		supervisor.Stop(ctx)
+	})
+
+	// Wait for the broken worker to be restarted and panic again, which takes
+	// the first backoff of a second
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		statuses := supervisor.Statuses()
+		if !statuses[0].Running && statuses[0].Restarts > 0 && statuses[1].Healthy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("worker statuses %+v", statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status, body := ready(t, app, false)
+	if status != http.StatusOK || body.Checks["workers"] != "degraded" {
+		t.Fatalf("status %d, checks %v", status, body.Checks)
+	}
+	workers := string(body.Details["workers"])
+	if !strings.Contains(workers, "broken") || strings.Contains(workers, "steady") {
+		t.Errorf("worker details %s", workers)
+	}
+}
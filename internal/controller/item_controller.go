@@ -1,12 +1,17 @@
 package controller
 
 import (
-	"fmt"
+	"errors"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/middleware"
 	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
 )
 
 // ReportLostItem creates a new lost item report
@@ -29,19 +34,22 @@ func ReportLostItem(c *fiber.Ctx) error {
 		})
 	}
 
-	// Set default status to "lost"
-	status := "lost"
-
-	// Insert the lost item into the database
+	// Insert the lost item, which also records its event
 	now := time.Now()
-	var itemID int
-	err := database.DB.QueryRow(`
-		INSERT INTO items (title, description, category, status, location, lost_time, report_time, reporter_id, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id
-	`, itemReq.Title, itemReq.Description, itemReq.Category, status, itemReq.Location, itemReq.LostTime, now, userID, now, now).Scan(&itemID)
-
-	if err != nil {
+	item := models.Item{
+		Title:       itemReq.Title,
+		Description: itemReq.Description,
+		Category:    itemReq.Category,
+		Status:      "lost",
+		Location:    itemReq.Location,
+		LostTime:    itemReq.LostTime,
+		ReportTime:  now,
+		ReporterID:  &userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := itemRepo.Create(c.UserContext(), &item); err != nil {
+		logging.Ctx(c).Error("Error creating lost item report", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error creating lost item report",
 		})
@@ -49,7 +57,7 @@ func ReportLostItem(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Lost item reported successfully",
-		"item_id": itemID,
+		"item_id": item.ID,
 	})
 }
 
@@ -73,19 +81,21 @@ func ReportFoundItem(c *fiber.Ctx) error {
 		})
 	}
 
-	// Set status to "found"
-	status := "found"
-
-	// Insert the found item into the database
+	// Insert the found item, which also records its event
 	now := time.Now()
-	var itemID int
-	err := database.DB.QueryRow(`
-		INSERT INTO items (title, description, category, status, location, report_time, finder_id, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
-	`, itemReq.Title, itemReq.Description, itemReq.Category, status, itemReq.Location, now, userID, now, now).Scan(&itemID)
-
-	if err != nil {
+	item := models.Item{
+		Title:       itemReq.Title,
+		Description: itemReq.Description,
+		Category:    itemReq.Category,
+		Status:      "found",
+		Location:    itemReq.Location,
+		ReportTime:  now,
+		FinderID:    &userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := itemRepo.Create(c.UserContext(), &item); err != nil {
+		logging.Ctx(c).Error("Error creating found item report", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error creating found item report",
 		})
@@ -93,23 +103,22 @@ func ReportFoundItem(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Found item reported successfully",
-		"item_id": itemID,
+		"item_id": item.ID,
 	})
 }
 
 // GetItemDetails retrieves details of a specific item
 func GetItemDetails(c *fiber.Ctx) error {
 	// Get item ID from URL parameter
-	itemID := c.Params("id")
-	if itemID == "" {
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Item ID is required",
+			"error": "Invalid item ID",
 		})
 	}
 
 	// Get item from database
-	var item models.Item
-	err := database.DB.Get(&item, "SELECT * FROM items WHERE id = $1", itemID)
+	item, err := itemRepo.Get(c.UserContext(), itemID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Item not found",
@@ -124,63 +133,14 @@ func GetItems(c *fiber.Ctx) error {
 	// Parse query parameters
 	status := c.Query("status", "all")     // Filter by status: lost, found, claimed, returned, or all
 	category := c.Query("category", "all") // Filter by category
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 10)
-	offset := (page - 1) * limit
-
-	// Build the query based on filters
-	query := "SELECT * FROM items WHERE 1=1"
-	countQuery := "SELECT COUNT(*) FROM items WHERE 1=1"
-	args := []interface{}{}
-	argCount := 1
-
-	if status != "all" {
-		query += " AND status = $" + string(rune('0'+argCount))
-		countQuery += " AND status = $" + string(rune('0'+argCount))
-		args = append(args, status)
-		argCount++
-	}
-
-	if category != "all" {
-		query += " AND category = $" + string(rune('0'+argCount))
-		countQuery += " AND category = $" + string(rune('0'+argCount))
-		args = append(args, category)
-		argCount++
-	}
-
-	// Add pagination
-	query += " ORDER BY created_at DESC LIMIT $" + string(rune('0'+argCount)) + " OFFSET $" + string(rune('0'+argCount+1))
-	args = append(args, limit, offset)
-
-	// Get items from database
-	var items []models.Item
-	err := database.DB.Select(&items, query, args...)
-	if err != nil {
-		// Log the actual error for debugging
-		fmt.Printf("Database error retrieving items: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving items: " + err.Error(),
-		})
-	}
-
-	// Get total count for pagination
-	var total int
-	err = database.DB.Get(&total, countQuery, args[:argCount-1]...)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving item count",
-		})
-	}
-
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"items": items,
-		"meta": fiber.Map{
-			"total": total,
-			"page":  page,
-			"limit": limit,
-			"pages": (total + limit - 1) / limit,
-		},
-	})
+	page, limit, offset := pagination(c, 10)
+
+	return itemListResponse(c, repository.ItemFilter{
+		Status:   allToEmpty(status),
+		Category: allToEmpty(category),
+		Limit:    limit,
+		Offset:   offset,
+	}, page, limit)
 }
 
 // SearchItems searches for items by title or description
@@ -194,69 +154,26 @@ func SearchItems(c *fiber.Ctx) error {
 	}
 
 	status := c.Query("status", "all")
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 10)
-	offset := (page - 1) * limit
-
-	// Build the search query
-	searchSQL := "SELECT * FROM items WHERE (title ILIKE $1 OR description ILIKE $1)"
-	countSQL := "SELECT COUNT(*) FROM items WHERE (title ILIKE $1 OR description ILIKE $1)"
-	args := []interface{}{"%" + query + "%"}
-	argCount := 2
-
-	if status != "all" {
-		searchSQL += " AND status = $" + string(rune('0'+argCount))
-		countSQL += " AND status = $" + string(rune('0'+argCount))
-		args = append(args, status)
-		argCount++
-	}
-
-	// Add pagination
-	searchSQL += " ORDER BY created_at DESC LIMIT $" + string(rune('0'+argCount)) + " OFFSET $" + string(rune('0'+argCount+1))
-	args = append(args, limit, offset)
-
-	// Get items from database
-	var items []models.Item
-	err := database.DB.Select(&items, searchSQL, args...)
-	if err != nil {
-		// Log the actual error for debugging
-		fmt.Printf("Database error searching items: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error searching items: " + err.Error(),
-		})
-	}
-
-	// Get total count for pagination
-	var total int
-	err = database.DB.Get(&total, countSQL, args[:argCount-1]...)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving item count",
-		})
-	}
-
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"items": items,
-		"meta": fiber.Map{
-			"total": total,
-			"page":  page,
-			"limit": limit,
-			"pages": (total + limit - 1) / limit,
-		},
-	})
+	page, limit, offset := pagination(c, 10)
+
+	return itemListResponse(c, repository.ItemFilter{
+		Status: allToEmpty(status),
+		Search: query,
+		Limit:  limit,
+		Offset: offset,
+	}, page, limit)
 }
 
 // UpdateItemStatus updates the status of an item
 func UpdateItemStatus(c *fiber.Ctx) error {
-	// Get user ID and role from JWT context
+	// Get user ID from JWT context
 	userID := c.Locals("user_id").(int)
-	role := c.Locals("role").(string)
 
 	// Get item ID from URL parameter
-	itemID := c.Params("id")
-	if itemID == "" {
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Item ID is required",
+			"error": "Invalid item ID",
 		})
 	}
 
@@ -278,48 +195,39 @@ func UpdateItemStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get the item to check ownership
-	var item models.Item
-	err := database.DB.Get(&item, "SELECT * FROM items WHERE id = $1", itemID)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Item not found",
-		})
-	}
-
-	// Check if user has permission to update this item
-	// Guards and admins can update any item, users can only update their own items
-	if role != "admin" && role != "guard" {
+	// Check if user has permission to update this item while it is locked
+	// Users can update their own items, items:update_any allows updating any item
+	// and claims:approve allows marking any item as claimed or returned
+	canApprove := (statusReq.Status == "claimed" || statusReq.Status == "returned") && middleware.HasPermission(c, permissions.ClaimsApprove)
+	_, err = itemRepo.UpdateStatus(c.UserContext(), itemID, statusReq.Status, userID, func(item models.Item) error {
+		if middleware.HasPermission(c, permissions.ItemsUpdateAny) || canApprove {
+			return nil
+		}
 		isReporter := item.ReporterID != nil && *item.ReporterID == userID
 		isFinder := item.FinderID != nil && *item.FinderID == userID
 
-		if !isReporter && !isFinder {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "You do not have permission to update this item",
-			})
+		// Owners also need items:create, which keeps API keys within their scope
+		if (!isReporter && !isFinder) || !middleware.HasPermission(c, permissions.ItemsCreate) {
+			return errItemForbidden
 		}
-	}
-
-	// Update the status
-	now := time.Now()
-	_, err = database.DB.Exec("UPDATE items SET status = $1, updated_at = $2 WHERE id = $3",
-		statusReq.Status, now, itemID)
-	if err != nil {
+		return nil
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Item not found",
+		})
+	case errors.Is(err, errItemForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You do not have permission to update this item",
+		})
+	case err != nil:
+		logging.Ctx(c).Error("Error updating item status", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error updating item status",
 		})
 	}
 
-	// If status is "claimed", update the claimed time
-	if statusReq.Status == "claimed" {
-		_, err = database.DB.Exec("UPDATE items SET claimed_time = $1 WHERE id = $2", now, itemID)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error updating claimed time",
-			})
-		}
-	}
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Item status updated successfully",
 	})
@@ -328,16 +236,15 @@ func UpdateItemStatus(c *fiber.Ctx) error {
 // UploadItemImage handles image upload for an item
 func UploadItemImage(c *fiber.Ctx) error {
 	// Get item ID from URL parameter
-	itemID := c.Params("id")
-	if itemID == "" {
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Item ID is required",
+			"error": "Invalid item ID",
 		})
 	}
 
 	// Check if item exists
-	var exists bool
-	err := database.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM items WHERE id = $1)", itemID)
+	exists, err := itemRepo.Exists(c.UserContext(), itemID)
 	if err != nil || !exists {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Item not found",
@@ -352,37 +259,21 @@ func UploadItemImage(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate a unique filename
-	filename := time.Now().Format("20060102150405") + "_" + file.Filename
-
-	// Save the file to a directory
-	err = c.SaveFile(file, "./uploads/"+filename)
+	// Validate and save the file
+	saved, err := saveUpload(c, file, imageUploads)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error saving image file",
-		})
+		return uploadErrorResponse(c, err)
 	}
 
 	// Create image URL
-	imageURL := "/uploads/" + filename
-
-	// Extract metadata from the image (this would require additional libraries)
-	// For now, we'll just save the image URL
-	_, err = database.DB.Exec(`
-		INSERT INTO images (item_id, image_url, timestamp, created_at) 
-		VALUES ($1, $2, $3, $4)
-	`, itemID, imageURL, time.Now(), time.Now())
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error saving image information",
-		})
-	}
+	imageURL := "/uploads/" + saved.Filename
 
-	// Update item with image URL
-	_, err = database.DB.Exec("UPDATE items SET image_url = $1 WHERE id = $2", imageURL, itemID)
-	if err != nil {
+	// Save the image and point the item at it
+	if _, err := itemRepo.SetImage(c.UserContext(), itemID, imageURL); err != nil {
+		logging.Ctx(c).Error("Error saving image information", "error", err)
+		os.Remove(filepath.Join(imageUploads.Dir, saved.Filename))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error updating item with image URL",
+			"error": "Error saving image information",
 		})
 	}
 
@@ -399,53 +290,40 @@ func GetUserItems(c *fiber.Ctx) error {
 
 	// Parse query parameters
 	status := c.Query("status", "all")
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 10)
-	offset := (page - 1) * limit
-
-	// Build the query that correctly handles NULL reporter_id and finder_id values
-	query := "SELECT * FROM items WHERE ((reporter_id IS NOT NULL AND reporter_id = $1) OR (finder_id IS NOT NULL AND finder_id = $1))"
-	countQuery := "SELECT COUNT(*) FROM items WHERE ((reporter_id IS NOT NULL AND reporter_id = $1) OR (finder_id IS NOT NULL AND finder_id = $1))"
-	args := []interface{}{userID}
-	argCount := 2
-
-	if status != "all" {
-		query += " AND status = $" + string(rune('0'+argCount))
-		countQuery += " AND status = $" + string(rune('0'+argCount))
-		args = append(args, status)
-		argCount++
-	}
+	page, limit, offset := pagination(c, 10)
+
+	return itemListResponse(c, repository.ItemFilter{
+		Status:  allToEmpty(status),
+		OwnerID: userID,
+		Limit:   limit,
+		Offset:  offset,
+	}, page, limit)
+}
 
-	// Add pagination
-	query += " ORDER BY created_at DESC LIMIT $" + string(rune('0'+argCount)) + " OFFSET $" + string(rune('0'+argCount+1))
-	args = append(args, limit, offset)
+// itemListResponse responds with a page of items matching the filter
+func itemListResponse(c *fiber.Ctx, filter repository.ItemFilter, page, limit int) error {
 	// Get items from database
-	var items []models.Item
-	err := database.DB.Select(&items, query, args...)
-	if err != nil {
-		// Log the actual error for debugging
-		fmt.Printf("Database error retrieving items: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving items: " + err.Error(),
-		})
-	}
-
-	// Get total count for pagination
-	var total int
-	err = database.DB.Get(&total, countQuery, args[:argCount-1]...)
+	items, total, err := itemRepo.List(c.UserContext(), filter)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving items", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving item count",
+			"error": "Error retrieving items",
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"items": items,
-		"meta": fiber.Map{
-			"total": total,
-			"page":  page,
-			"limit": limit,
-			"pages": (total + limit - 1) / limit,
-		},
+		"meta":  pageMeta(total, page, limit),
 	})
 }
+
+// errItemForbidden is returned when the user may not change an item
+var errItemForbidden = errors.New("not allowed to update item")
+
+// allToEmpty turns the "all" filter value into an empty filter
+func allToEmpty(value string) string {
+	if value == "all" {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+type itemListBody struct {
+	Items []models.Item `json:"items"`
+	Meta  struct {
+		Total int `json:"total"`
+		Pages int `json:"pages"`
+	} `json:"meta"`
+}
+
+func TestReportAndGetItem(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+
+		var created struct {
+			ItemID int `json:"item_id"`
+		}
+		status := request(t, app, http.MethodPost, "/items/lost", alice, models.ItemRequest{
+			Title:    "Blue umbrella",
+			Category: "accessories",
+			Location: "Library",
+		}, &created)
+		if status != http.StatusCreated {
+			t.Fatalf("report lost item: status %d, want %d", status, http.StatusCreated)
+		}
+
+		var item models.Item
+		status = request(t, app, http.MethodGet, "/items/"+strconv.Itoa(created.ItemID), alice, nil, &item)
+		if status != http.StatusOK {
+			t.Fatalf("get item: status %d, want %d", status, http.StatusOK)
+		}
+		if item.Title != "Blue umbrella" || item.Status != "lost" {
+			t.Errorf("got item %q with status %q", item.Title, item.Status)
+		}
+		if item.ReporterID == nil || *item.ReporterID != alice {
+			t.Errorf("reporter = %v, want %d", item.ReporterID, alice)
+		}
+
+		recorded := store.events(t)
+		if len(recorded) != 1 || recorded[0].Type != events.ItemCreated {
+			t.Errorf("recorded events %+v, want one %s", recorded, events.ItemCreated)
+		}
+	})
+}
+
+func TestReportItemValidation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+
+		var body map[string]string
+		status := request(t, app, http.MethodPost, "/items/found", alice, models.ItemRequest{Title: "Keys"}, &body)
+		if status != http.StatusBadRequest {
+			t.Fatalf("status %d, want %d", status, http.StatusBadRequest)
+		}
+		if body["error"] == "" {
+			t.Error("expected an error message")
+		}
+		if len(store.events(t)) != 0 {
+			t.Error("rejected report recorded an event")
+		}
+	})
+}
+
+func TestGetItemNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+
+		for path, want := range map[string]int{
+			"/items/42":  http.StatusNotFound,
+			"/items/abc": http.StatusBadRequest,
+		} {
+			if status := request(t, app, http.MethodGet, path, 0, nil, nil); status != want {
+				t.Errorf("GET %s: status %d, want %d", path, status, want)
+			}
+		}
+	})
+}
+
+func TestListItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+		bob := createUser(t, store, "bob", "student")
+
+		reports := []struct {
+			path   string
+			userID int
+			req    models.ItemRequest
+		}{
+			{"/items/lost", alice, models.ItemRequest{Title: "Blue umbrella", Category: "accessories", Location: "Library"}},
+			{"/items/found", bob, models.ItemRequest{Title: "Student card", Category: "documents", Location: "Canteen"}},
+			{"/items/found", bob, models.ItemRequest{Title: "Red umbrella", Category: "accessories", Location: "Gym"}},
+		}
+		for _, r := range reports {
+			if status := request(t, app, http.MethodPost, r.path, r.userID, r.req, nil); status != http.StatusCreated {
+				t.Fatalf("POST %s: status %d", r.path, status)
+			}
+		}
+
+		tests := []struct {
+			name   string
+			path   string
+			userID int
+			total  int
+		}{
+			{"all", "/items", 0, 3},
+			{"by status", "/items?status=found", 0, 2},
+			{"by category", "/items?category=accessories", 0, 2},
+			{"search", "/items/search?q=UMBRELLA", 0, 2},
+			{"search with status", "/items/search?q=umbrella&status=lost", 0, 1},
+			{"own items", "/user/items", bob, 2},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var body itemListBody
+				if status := request(t, app, http.MethodGet, tt.path, tt.userID, nil, &body); status != http.StatusOK {
+					t.Fatalf("status %d, want %d", status, http.StatusOK)
+				}
+				if body.Meta.Total != tt.total || len(body.Items) != tt.total {
+					t.Errorf("got %d items of %d, want %d", len(body.Items), body.Meta.Total, tt.total)
+				}
+			})
+		}
+
+		var body itemListBody
+		request(t, app, http.MethodGet, "/items?limit=2&page=2", 0, nil, &body)
+		if len(body.Items) != 1 || body.Meta.Total != 3 || body.Meta.Pages != 2 {
+			t.Errorf("second page: %d items, total %d, %d pages", len(body.Items), body.Meta.Total, body.Meta.Pages)
+		}
+
+		// Out of range pagination is clamped instead of failing
+		for path, pages := range map[string]int{
+			"/items?limit=0":             3,
+			"/items?limit=-1&page=-1":    3,
+			"/items?limit=1000&page=0":   1,
+			"/user/items?limit=0&page=2": 2,
+		} {
+			var body itemListBody
+			if status := request(t, app, http.MethodGet, path, bob, nil, &body); status != http.StatusOK {
+				t.Errorf("GET %s: status %d, want %d", path, status, http.StatusOK)
+			}
+			if body.Meta.Pages != pages {
+				t.Errorf("GET %s: %d pages, want %d", path, body.Meta.Pages, pages)
+			}
+		}
+
+		if status := request(t, app, http.MethodGet, "/items/search", 0, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("search without a query: status %d, want %d", status, http.StatusBadRequest)
+		}
+	})
+}
+
+// Status changes check role permissions, which only the database store has
+func TestUpdateItemStatus(t *testing.T) {
+	store := sqliteStore(t)
+	app := testApp(store)
+	alice := createUser(t, store, "alice", "student")
+	bob := createUser(t, store, "bob", "student")
+	guard := createUser(t, store, "guard", "guard")
+
+	var created struct {
+		ItemID int `json:"item_id"`
+	}
+	request(t, app, http.MethodPost, "/items/lost", alice, models.ItemRequest{Title: "Wallet", Category: "accessories", Location: "Gym"}, &created)
+	path := "/items/" + strconv.Itoa(created.ItemID) + "/status"
+
+	tests := []struct {
+		name   string
+		userID int
+		status string
+		want   int
+	}{
+		{"invalid status", alice, "gone", http.StatusBadRequest},
+		{"other student", bob, "found", http.StatusForbidden},
+		{"reporter", alice, "found", http.StatusOK},
+		{"guard approves claim", guard, "claimed", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]string{"status": tt.status}
+			if status := request(t, app, http.MethodPut, path, tt.userID, body, nil); status != tt.want {
+				t.Errorf("status %d, want %d", status, tt.want)
+			}
+		})
+	}
+	if status := request(t, app, http.MethodPut, "/items/99/status", guard, map[string]string{"status": "claimed"}, nil); status != http.StatusNotFound {
+		t.Errorf("missing item: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	var item models.Item
+	request(t, app, http.MethodGet, "/items/"+strconv.Itoa(created.ItemID), alice, nil, &item)
+	if item.Status != "claimed" {
+		t.Errorf("item status = %q, want claimed", item.Status)
+	}
+
+	var changes int
+	for _, event := range store.events(t) {
+		if event.Type == events.ItemStatusChanged {
+			changes++
+		}
+	}
+	if changes != 2 {
+		t.Errorf("recorded %d %s events, want 2", changes, events.ItemStatusChanged)
+	}
+}
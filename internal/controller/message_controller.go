@@ -1,11 +1,14 @@
 package controller
 
 import (
+	"context"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
 	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/realtime"
 )
 
 // SendMessage handles sending a message between users
@@ -28,9 +31,13 @@ func SendMessage(c *fiber.Ctx) error {
 		})
 	}
 
+	// Messages to an existing conversation go to all of its participants
+	if messageReq.ConversationID != 0 {
+		return sendConversationMessage(c, senderID, messageReq.ConversationID, messageReq.Content)
+	}
+
 	// Check if receiver exists
-	var receiverExists bool
-	err := database.DB.Get(&receiverExists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", messageReq.ReceiverID)
+	receiverExists, err := userRepo.Exists(c.UserContext(), messageReq.ReceiverID)
 	if err != nil || !receiverExists {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Receiver not found",
@@ -38,34 +45,44 @@ func SendMessage(c *fiber.Ctx) error {
 	}
 
 	// Check if item exists (if item_id is provided)
+	var itemID *int
 	if messageReq.ItemID != 0 {
-		var itemExists bool
-		err := database.DB.Get(&itemExists, "SELECT EXISTS(SELECT 1 FROM items WHERE id = $1)", messageReq.ItemID)
+		itemExists, err := itemRepo.Exists(c.UserContext(), messageReq.ItemID)
 		if err != nil || !itemExists {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Item not found",
 			})
 		}
+		itemID = &messageReq.ItemID
 	}
 
-	// Insert message into database
-	var messageID int
-	err = database.DB.QueryRow(`
-		INSERT INTO messages (sender_id, receiver_id, item_id, content, created_at) 
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
-	`, senderID, messageReq.ReceiverID, messageReq.ItemID, messageReq.Content, time.Now()).Scan(&messageID)
+	// Respect blocks and the receiver's message policy
+	if err := checkCanMessage(c.UserContext(), senderID, messageReq.ReceiverID, itemID); err != nil {
+		return messagingErrorResponse(c, err)
+	}
+
+	// Find the conversation about this item between the two users
+	conversationID, err := conversationRepo.FindOrCreate(c.UserContext(), itemID, senderID, messageReq.ReceiverID)
+	if err != nil {
+		logging.Ctx(c).Error("Error starting conversation", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error starting conversation",
+		})
+	}
 
+	// Insert message into database
+	message, err := insertMessage(c.UserContext(), conversationID, senderID, &messageReq.ReceiverID, itemID, messageReq.Content)
 	if err != nil {
+		logging.Ctx(c).Error("Error sending message", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error sending message",
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":    "Message sent successfully",
-		"message_id": messageID,
-	})
+	// Push the message to the participants' open connections
+	publishToConversation(c.UserContext(), conversationID, realtime.MessageNew, message)
+
+	return messageSentResponse(c, message, nil)
 }
 
 // GetConversations gets all conversations for the current user
@@ -73,48 +90,15 @@ func GetConversations(c *fiber.Ctx) error {
 	// Get user ID from JWT context
 	userID := c.Locals("user_id").(int)
 
-	// This query groups messages by the other user involved and returns the latest message
-	query := `
-	WITH conversations AS (
-		SELECT 
-			CASE 
-				WHEN sender_id = $1 THEN receiver_id 
-				ELSE sender_id 
-			END AS other_user_id,
-			MAX(created_at) as latest_time
-		FROM messages
-		WHERE sender_id = $1 OR receiver_id = $1
-		GROUP BY other_user_id
-	)
-	SELECT 
-		c.other_user_id, 
-		u.username as other_username, 
-		m.id as latest_message_id, 
-		m.content as latest_message, 
-		m.created_at as latest_message_time,
-		(SELECT COUNT(*) FROM messages WHERE receiver_id = $1 AND sender_id = c.other_user_id AND read = false) as unread_count
-	FROM conversations c
-	JOIN users u ON c.other_user_id = u.id
-	JOIN messages m ON (
-		(m.sender_id = $1 AND m.receiver_id = c.other_user_id) OR 
-		(m.sender_id = c.other_user_id AND m.receiver_id = $1)
-	)
-	WHERE m.created_at = c.latest_time
-	ORDER BY m.created_at DESC
-	`
-
-	// Get conversations from database
-	var conversations []struct {
-		OtherUserID       int       `db:"other_user_id" json:"other_user_id"`
-		OtherUsername     string    `db:"other_username" json:"other_username"`
-		LatestMessageID   int       `db:"latest_message_id" json:"latest_message_id"`
-		LatestMessage     string    `db:"latest_message" json:"latest_message"`
-		LatestMessageTime time.Time `db:"latest_message_time" json:"latest_message_time"`
-		UnreadCount       int       `db:"unread_count" json:"unread_count"`
-	}
-
-	err := database.DB.Select(&conversations, query, userID)
+	// Optional item ID for filtering
+	var itemID *int
+	if id := c.QueryInt("item_id", 0); id != 0 {
+		itemID = &id
+	}
+
+	conversations, err := listConversations(c.UserContext(), userID, itemID, false)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving conversations", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error retrieving conversations",
 		})
@@ -129,89 +113,53 @@ func GetMessages(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(int)
 
 	// Get other user ID from URL parameter
-	otherUserID := c.Params("id")
-	if otherUserID == "" {
+	otherUserID, err := c.ParamsInt("id")
+	if err != nil || otherUserID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Other user ID is required",
+			"error": "Invalid user ID",
 		})
 	}
 
 	// Optional item ID for filtering
-	itemID := c.Query("item_id", "")
+	var itemID *int
+	if id := c.QueryInt("item_id", 0); id != 0 {
+		itemID = &id
+	}
 
 	// Parse pagination parameters
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 50)
-	offset := (page - 1) * limit
-
-	// Build the query
-	query := `
-		SELECT m.*, u.username as sender_username 
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE (m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1)
-	`
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM messages
-		WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)
-	`
-	args := []interface{}{userID, otherUserID}
-	argCount := 3
-
-	// Add item filter if provided
-	if itemID != "" {
-		query += " AND m.item_id = $" + string(rune('0'+argCount))
-		countQuery += " AND item_id = $" + string(rune('0'+argCount))
-		args = append(args, itemID)
-		argCount++
-	}
-
-	// Add ordering and pagination
-	query += " ORDER BY m.created_at DESC LIMIT $" + string(rune('0'+argCount)) + " OFFSET $" + string(rune('0'+argCount+1))
-	args = append(args, limit, offset)
+	page, limit, offset := pagination(c, 50)
 
 	// Get messages from database
-	var messages []struct {
-		models.Message
-		SenderUsername string `db:"sender_username" json:"sender_username"`
-	}
-	err := database.DB.Select(&messages, query, args...)
+	messages, total, err := messageRepo.ListBetween(c.UserContext(), userID, otherUserID, itemID, limit, offset)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving messages", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error retrieving messages",
 		})
 	}
 
-	// Get total count for pagination
-	var total int
-	err = database.DB.Get(&total, countQuery, args[:argCount-1]...)
+	// Attach files sent with the messages
+	messageIDs := make([]int, len(messages))
+	for i := range messages {
+		messageIDs[i] = messages[i].ID
+	}
+	attachments, err := messageAttachments(c.UserContext(), messageIDs)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving attachments", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error retrieving message count",
+			"error": "Error retrieving attachments",
 		})
 	}
-
-	// Mark messages as read
-	_, err = database.DB.Exec(`
-		UPDATE messages 
-		SET read = true 
-		WHERE receiver_id = $1 AND sender_id = $2 AND read = false
-	`, userID, otherUserID)
-	if err != nil {
-		// Log the error but don't fail the request
-		// Ideally, we'd use a logger here
-		// log.Printf("Error marking messages as read: %v", err)
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
 	}
 
+	// Mark messages as read and notify the sender
+	markMessagesRead(c.UserContext(), userID, otherUserID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"messages": messages,
-		"meta": fiber.Map{
-			"total": total,
-			"page":  page,
-			"limit": limit,
-			"pages": (total + limit - 1) / limit,
-		},
+		"meta":     pageMeta(total, page, limit),
 	})
 }
 
@@ -220,10 +168,9 @@ func GetUnreadMessageCount(c *fiber.Ctx) error {
 	// Get user ID from JWT context
 	userID := c.Locals("user_id").(int)
 
-	// Get unread count from database
-	var unreadCount int
-	err := database.DB.Get(&unreadCount, "SELECT COUNT(*) FROM messages WHERE receiver_id = $1 AND read = false", userID)
+	unreadCount, err := messageRepo.UnreadCount(c.UserContext(), userID)
 	if err != nil {
+		logging.Ctx(c).Error("Error retrieving unread message count", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error retrieving unread message count",
 		})
@@ -233,3 +180,21 @@ func GetUnreadMessageCount(c *fiber.Ctx) error {
 		"unread_count": unreadCount,
 	})
 }
+
+// markMessagesRead marks messages from otherUserID to userID as read and sends
+// a read receipt to otherUserID
+func markMessagesRead(ctx context.Context, userID, otherUserID int) {
+	// Also advances the read position of the conversations shared with the other user
+	rows, err := messageRepo.MarkRead(ctx, userID, otherUserID)
+	if err != nil {
+		slog.Error("Error marking messages as read", "user_id", userID, "error", err)
+		return
+	}
+
+	if rows > 0 {
+		realtime.Publish(realtime.MessageRead, fiber.Map{
+			"reader_id": userID,
+			"read_at":   time.Now(),
+		}, otherUserID)
+	}
+}
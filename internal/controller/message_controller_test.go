@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+)
+
+type messageSentBody struct {
+	MessageID      int    `json:"message_id"`
+	ConversationID int    `json:"conversation_id"`
+	Warning        string `json:"warning"`
+	Error          string `json:"error"`
+}
+
+type messageListBody struct {
+	Messages []repository.MessageWithSender `json:"messages"`
+	Meta     struct {
+		Total int `json:"total"`
+		Pages int `json:"pages"`
+	} `json:"meta"`
+}
+
+type unreadBody struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+func TestSendMessage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+		bob := createUser(t, store, "bob", "student")
+
+		var first messageSentBody
+		status := request(t, app, http.MethodPost, "/messages", alice, models.MessageRequest{ReceiverID: bob, Content: "Is this your umbrella?"}, &first)
+		if status != http.StatusCreated {
+			t.Fatalf("send message: status %d (%s), want %d", status, first.Error, http.StatusCreated)
+		}
+
+		// Replies go to the same conversation
+		var reply messageSentBody
+		request(t, app, http.MethodPost, "/messages", bob, models.MessageRequest{ReceiverID: alice, Content: "Yes, thanks!"}, &reply)
+		if reply.ConversationID != first.ConversationID {
+			t.Errorf("reply went to conversation %d, want %d", reply.ConversationID, first.ConversationID)
+		}
+
+		// Each message records message.created for the notification handler
+		var created []models.Message
+		for _, event := range store.events(t) {
+			if event.Type != events.MessageCreated {
+				continue
+			}
+			var message models.Message
+			if err := json.Unmarshal(event.Data, &message); err != nil {
+				t.Fatalf("decoding %s: %v", event.Type, err)
+			}
+			created = append(created, message)
+		}
+		if len(created) != 2 || created[0].ID != first.MessageID || created[0].SenderID != alice {
+			t.Errorf("recorded messages %+v, want messages %d and %d", created, first.MessageID, reply.MessageID)
+		}
+	})
+}
+
+func TestSendMessageValidation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+
+		tests := []struct {
+			name string
+			req  models.MessageRequest
+			want int
+		}{
+			{"no content", models.MessageRequest{ReceiverID: alice}, http.StatusBadRequest},
+			{"unknown receiver", models.MessageRequest{ReceiverID: 99, Content: "Hi"}, http.StatusNotFound},
+			{"unknown item", models.MessageRequest{ReceiverID: alice, ItemID: 99, Content: "Hi"}, http.StatusNotFound},
+			{"to yourself", models.MessageRequest{ReceiverID: alice, Content: "Hi"}, http.StatusBadRequest},
+			{"unknown conversation", models.MessageRequest{ConversationID: 99, Content: "Hi"}, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var body messageSentBody
+				if status := request(t, app, http.MethodPost, "/messages", alice, tt.req, &body); status != tt.want {
+					t.Errorf("status %d (%s), want %d", status, body.Error, tt.want)
+				}
+			})
+		}
+		if len(store.events(t)) != 0 {
+			t.Error("rejected messages recorded events")
+		}
+	})
+}
+
+func TestSendMessageBlocked(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+		bob := createUser(t, store, "bob", "student")
+
+		if err := store.repos.Privacy.Block(context.Background(), bob, alice); err != nil {
+			t.Fatalf("blocking: %v", err)
+		}
+
+		var body messageSentBody
+		if status := request(t, app, http.MethodPost, "/messages", alice, models.MessageRequest{ReceiverID: bob, Content: "Hi"}, &body); status != http.StatusForbidden {
+			t.Errorf("status %d (%s), want %d", status, body.Error, http.StatusForbidden)
+		}
+	})
+}
+
+func TestReadMessages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+		bob := createUser(t, store, "bob", "student")
+
+		var sent messageSentBody
+		for _, content := range []string{"Found your wallet", "It is at the front desk"} {
+			request(t, app, http.MethodPost, "/messages", alice, models.MessageRequest{ReceiverID: bob, Content: content}, &sent)
+		}
+
+		var unread unreadBody
+		request(t, app, http.MethodGet, "/messages/unread", bob, nil, &unread)
+		if unread.UnreadCount != 2 {
+			t.Errorf("unread before reading = %d, want 2", unread.UnreadCount)
+		}
+
+		var conversations []models.ConversationSummary
+		request(t, app, http.MethodGet, "/messages/conversations", bob, nil, &conversations)
+		if len(conversations) != 1 || conversations[0].ID != sent.ConversationID || conversations[0].UnreadCount != 2 {
+			t.Fatalf("conversations %+v, want conversation %d with 2 unread", conversations, sent.ConversationID)
+		}
+
+		var messages messageListBody
+		if status := request(t, app, http.MethodGet, "/messages/"+strconv.Itoa(alice), bob, nil, &messages); status != http.StatusOK {
+			t.Fatalf("get messages: status %d", status)
+		}
+		if messages.Meta.Total != 2 || len(messages.Messages) != 2 || messages.Messages[0].SenderUsername != "alice" {
+			t.Errorf("messages %+v, want 2 from alice", messages)
+		}
+
+		request(t, app, http.MethodGet, "/messages/unread", bob, nil, &unread)
+		if unread.UnreadCount != 0 {
+			t.Errorf("unread after reading = %d, want 0", unread.UnreadCount)
+		}
+	})
+}
+
+func TestConversationMessages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+		bob := createUser(t, store, "bob", "student")
+		carol := createUser(t, store, "carol", "student")
+
+		var sent messageSentBody
+		request(t, app, http.MethodPost, "/messages", alice, models.MessageRequest{ReceiverID: bob, Content: "Hello"}, &sent)
+		path := "/conversations/" + strconv.Itoa(sent.ConversationID) + "/messages"
+
+		// Messages can be sent to the conversation directly
+		var reply messageSentBody
+		status := request(t, app, http.MethodPost, "/messages", bob, models.MessageRequest{ConversationID: sent.ConversationID, Content: "Hi"}, &reply)
+		if status != http.StatusCreated {
+			t.Fatalf("reply to conversation: status %d (%s)", status, reply.Error)
+		}
+
+		var messages messageListBody
+		if status := request(t, app, http.MethodGet, path, alice, nil, &messages); status != http.StatusOK {
+			t.Fatalf("get conversation messages: status %d", status)
+		}
+		if messages.Meta.Total != 2 {
+			t.Errorf("got %d messages, want 2", messages.Meta.Total)
+		}
+
+		// A zero limit is raised to one message per page
+		var firstPage messageListBody
+		if status := request(t, app, http.MethodGet, path+"?limit=0", alice, nil, &firstPage); status != http.StatusOK {
+			t.Fatalf("limit=0: status %d", status)
+		}
+		if len(firstPage.Messages) != 1 || firstPage.Meta.Pages != 2 {
+			t.Errorf("limit=0: got %d messages on %d pages, want 1 on 2", len(firstPage.Messages), firstPage.Meta.Pages)
+		}
+
+		// Only participants can read or write
+		if status := request(t, app, http.MethodGet, path, carol, nil, nil); status != http.StatusNotFound {
+			t.Errorf("non-participant read: status %d, want %d", status, http.StatusNotFound)
+		}
+		if status := request(t, app, http.MethodPost, "/messages", carol, models.MessageRequest{ConversationID: sent.ConversationID, Content: "Hi"}, nil); status != http.StatusNotFound {
+			t.Errorf("non-participant send: status %d, want %d", status, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/email"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/notifications"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+)
+
+// GetNotifications gets the current user's notifications, newest first
+func GetNotifications(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Parse pagination parameters
+	page, limit, offset := pagination(c, 20)
+
+	// Optionally only return unread notifications
+	unreadOnly := c.QueryBool("unread", false)
+
+	// Get notifications from database
+	notificationList, total, err := notificationRepo.List(c.UserContext(), userID, unreadOnly, limit, offset)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving notifications", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving notifications",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"notifications": notificationList,
+		"meta":          pageMeta(total, page, limit),
+	})
+}
+
+// GetUnreadNotificationCount gets the count of unread notifications for the current user
+func GetUnreadNotificationCount(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	unreadCount, err := notificationRepo.UnreadCount(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving unread notification count", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving unread notification count",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"unread_count": unreadCount,
+	})
+}
+
+// MarkNotificationRead marks one of the current user's notifications as read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get notification ID from URL parameter
+	notificationID, err := c.ParamsInt("id")
+	if err != nil || notificationID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid notification ID",
+		})
+	}
+
+	err = notificationRepo.MarkRead(c.UserContext(), notificationID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Notification not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error updating notification", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating notification",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notification marked as read",
+	})
+}
+
+// MarkAllNotificationsRead marks all of the current user's notifications as read
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	updated, err := notificationRepo.MarkAllRead(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error updating notifications", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating notifications",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notifications marked as read",
+		"updated": updated,
+	})
+}
+
+// GetNotificationPreferences gets which notification types the current user receives
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	prefs, err := notificationPreferences(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving notification preferences", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving notification preferences",
+		})
+	}
+
+	frequency, err := emailFrequency(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving notification preferences", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving notification preferences",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"preferences":     prefs,
+		"email_frequency": frequency,
+	})
+}
+
+// UpdateNotificationPreferences turns notification types on or off for the current user
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Parse request body
+	var prefsReq struct {
+		Preferences    []models.NotificationPreference `json:"preferences"`
+		EmailFrequency string                          `json:"email_frequency"` // Optional: immediate, daily or off
+	}
+	if err := c.BodyParser(&prefsReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate notification types
+	for _, pref := range prefsReq.Preferences {
+		if !notifications.ValidType(pref.Type) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown notification type: " + pref.Type,
+			})
+		}
+	}
+
+	if prefsReq.EmailFrequency != "" && !email.ValidFrequency(prefsReq.EmailFrequency) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid email frequency. Must be one of: immediate, daily, off",
+		})
+	}
+
+	if err := notificationRepo.SetPreferences(c.UserContext(), userID, prefsReq.Preferences); err != nil {
+		logging.Ctx(c).Error("Error updating notification preferences", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating notification preferences",
+		})
+	}
+	if prefsReq.EmailFrequency != "" {
+		if err := setEmailFrequency(c.UserContext(), userID, prefsReq.EmailFrequency); err != nil {
+			logging.Ctx(c).Error("Error updating notification preferences", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating notification preferences",
+			})
+		}
+	}
+
+	prefs, err := notificationPreferences(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving notification preferences", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving notification preferences",
+		})
+	}
+	frequency, err := emailFrequency(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving notification preferences", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving notification preferences",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":         "Notification preferences updated successfully",
+		"preferences":     prefs,
+		"email_frequency": frequency,
+	})
+}
+
+// UnsubscribePage asks the user in a signed unsubscribe link to confirm turning
+// off email notifications. It changes nothing, so that mail scanners and link
+// previews that follow the link cannot unsubscribe anyone.
+func UnsubscribePage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if _, err := email.ParseUnsubscribeToken(token); err != nil {
+		return renderUnsubscribePage(c, fiber.StatusBadRequest, unsubscribePageData{Error: unsubscribeTokenError(err)})
+	}
+	return renderUnsubscribePage(c, fiber.StatusOK, unsubscribePageData{Token: token})
+}
+
+// Unsubscribe turns off email notifications for the user in a signed
+// unsubscribe link. It needs no login so that it works from any mail client,
+// and serves both the confirmation form and RFC 8058 one-click unsubscribes.
+func Unsubscribe(c *fiber.Ctx) error {
+	// Browsers submitting the confirmation form get a page back, other clients JSON
+	html := c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML
+
+	token := c.Query("token")
+	if token == "" {
+		token = c.FormValue("token")
+	}
+	userID, err := email.ParseUnsubscribeToken(token)
+	if err != nil {
+		if html {
+			return renderUnsubscribePage(c, fiber.StatusBadRequest, unsubscribePageData{Error: unsubscribeTokenError(err)})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": unsubscribeTokenError(err),
+		})
+	}
+
+	if err := setEmailFrequency(c.UserContext(), userID, email.FrequencyOff); err != nil {
+		logging.Ctx(c).Error("Error updating email preferences", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating email preferences",
+		})
+	}
+
+	if html {
+		return renderUnsubscribePage(c, fiber.StatusOK, unsubscribePageData{Done: true})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "You have been unsubscribed from email notifications",
+	})
+}
+
+// unsubscribeTokenError describes why an unsubscribe token was rejected
+func unsubscribeTokenError(err error) string {
+	if errors.Is(err, email.ErrExpiredToken) {
+		return "This unsubscribe link has expired. Log in to change your notification preferences."
+	}
+	return "Invalid or missing unsubscribe token"
+}
+
+// unsubscribePageData is shown on the unsubscribe page
+type unsubscribePageData struct {
+	Token string // Of a valid link that has not been confirmed yet
+	Done  bool
+	Error string
+}
+
+// unsubscribePage confirms unsubscribing, posting the token back to the same URL
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <title>Unsubscribe - Campus Lost &amp; Found</title>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body style="font-family: Arial, sans-serif; color: #222; max-width: 600px; margin: 0 auto;">
+<h2 style="color: #1a4d8f;">Campus Lost &amp; Found</h2>
+{{if .Error}}<p>{{.Error}}</p>
+{{else if .Done}}<p>You have been unsubscribed from email notifications.</p>
+{{else}}<p>Do you want to stop receiving notification emails?</p>
+<form method="post" action="?token={{.Token}}">
+  <button type="submit">Unsubscribe</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// renderUnsubscribePage responds with the unsubscribe page
+func renderUnsubscribePage(c *fiber.Ctx, status int, data unsubscribePageData) error {
+	var page bytes.Buffer
+	if err := unsubscribePage.Execute(&page, data); err != nil {
+		return err
+	}
+	c.Type("html", "utf-8")
+	return c.Status(status).Send(page.Bytes())
+}
+
+// notificationPreferences returns the user's setting for every notification type
+func notificationPreferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	saved, err := notificationRepo.Preferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return notifications.Preferences(saved), nil
+}
+
+// emailFrequency returns how often the user receives notification emails
+func emailFrequency(ctx context.Context, userID int) (string, error) {
+	frequency, err := privacyRepo.EmailFrequency(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return email.FrequencyImmediate, nil
+	}
+	return frequency, err
+}
+
+// setEmailFrequency saves how often the user receives notification emails
+func setEmailFrequency(ctx context.Context, userID int, frequency string) error {
+	return privacyRepo.SetEmailFrequency(ctx, userID, frequency)
+}
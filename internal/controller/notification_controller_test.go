@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/email"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/notifications"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+		link := "/unsubscribe?token=" + url.QueryEscape(email.UnsubscribeToken(alice))
+
+		frequency := func() string {
+			t.Helper()
+			frequency, err := emailFrequency(context.Background(), alice)
+			if err != nil {
+				t.Fatalf("reading email frequency: %v", err)
+			}
+			return frequency
+		}
+
+		// Following the link only shows the confirmation form
+		status, page := unsubscribeRequest(t, app, http.MethodGet, link, "text/html", "")
+		if status != http.StatusOK || !strings.Contains(page, `method="post"`) {
+			t.Fatalf("GET: status %d, page %q", status, page)
+		}
+		if got := frequency(); got != email.FrequencyImmediate {
+			t.Fatalf("GET changed the email frequency to %q", got)
+		}
+
+		// Submitting the form unsubscribes and shows a page
+		status, page = unsubscribeRequest(t, app, http.MethodPost, link, "text/html", "")
+		if status != http.StatusOK || !strings.Contains(page, "You have been unsubscribed") {
+			t.Fatalf("POST form: status %d, page %q", status, page)
+		}
+		if got := frequency(); got != email.FrequencyOff {
+			t.Errorf("email frequency = %q, want %q", got, email.FrequencyOff)
+		}
+
+		// RFC 8058 one-click clients post the same link and get JSON
+		status, body := unsubscribeRequest(t, app, http.MethodPost, link, "", "List-Unsubscribe=One-Click")
+		if status != http.StatusOK || !strings.Contains(body, `"message"`) {
+			t.Errorf("one-click POST: status %d, body %q", status, body)
+		}
+	})
+}
+
+func TestUnsubscribeInvalidToken(t *testing.T) {
+	store := memoryStore(t)
+	app := testApp(store)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		for _, token := range []string{"", "v1.abc.def", "garbage"} {
+			if status, _ := unsubscribeRequest(t, app, method, "/unsubscribe?token="+token, "", ""); status != http.StatusBadRequest {
+				t.Errorf("%s with token %q: status %d, want %d", method, token, status, http.StatusBadRequest)
+			}
+		}
+	}
+}
+
+// unsubscribeRequest sends a form request like a browser or mail client and returns the response body
+func unsubscribeRequest(t *testing.T, app *fiber.App, method, path, accept, form string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(form))
+	req.Header.Set("Content-Type", fiber.MIMEApplicationForm)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s %s response: %v", method, path, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	forEachStore(t, func(t *testing.T, app *fiber.App, store testStore) {
+		alice := createUser(t, store, "alice", "student")
+
+		type body struct {
+			Preferences    []models.NotificationPreference `json:"preferences"`
+			EmailFrequency string                          `json:"email_frequency"`
+		}
+		enabled := func(b body) map[string]bool {
+			got := map[string]bool{}
+			for _, pref := range b.Preferences {
+				got[pref.Type] = pref.Enabled
+			}
+			return got
+		}
+
+		// Every type is on until it is turned off
+		var got body
+		if status := request(t, app, http.MethodGet, "/user/notification-preferences", alice, nil, &got); status != http.StatusOK {
+			t.Fatalf("GET: status %d", status)
+		}
+		if len(got.Preferences) != len(notifications.Types) || !enabled(got)[notifications.MessageNew] {
+			t.Fatalf("default preferences %+v", got.Preferences)
+		}
+
+		update := body{Preferences: []models.NotificationPreference{{Type: notifications.MessageNew, Enabled: false}}, EmailFrequency: email.FrequencyDaily}
+		if status := request(t, app, http.MethodPut, "/user/notification-preferences", alice, update, &got); status != http.StatusOK {
+			t.Fatalf("PUT: status %d", status)
+		}
+		if enabled(got)[notifications.MessageNew] || !enabled(got)[notifications.MatchNew] || got.EmailFrequency != email.FrequencyDaily {
+			t.Errorf("updated preferences %+v, email frequency %q", got.Preferences, got.EmailFrequency)
+		}
+
+		// Turning a type back on overwrites the saved setting
+		update = body{Preferences: []models.NotificationPreference{{Type: notifications.MessageNew, Enabled: true}}}
+		request(t, app, http.MethodPut, "/user/notification-preferences", alice, update, &got)
+		if !enabled(got)[notifications.MessageNew] || got.EmailFrequency != email.FrequencyDaily {
+			t.Errorf("preferences %+v, email frequency %q", got.Preferences, got.EmailFrequency)
+		}
+
+		update = body{Preferences: []models.NotificationPreference{{Type: "item.deleted", Enabled: false}}}
+		if status := request(t, app, http.MethodPut, "/user/notification-preferences", alice, update, nil); status != http.StatusBadRequest {
+			t.Errorf("unknown type: status %d, want %d", status, http.StatusBadRequest)
+		}
+	})
+}
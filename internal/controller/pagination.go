@@ -0,0 +1,35 @@
+package controller
+
+import "github.com/gofiber/fiber/v2"
+
+const (
+	// maxPageSize is the most records a list endpoint returns at once
+	maxPageSize = 100
+	// maxPage keeps the offset of the last page within a 32-bit integer
+	maxPage = (1<<31 - 1) / maxPageSize
+)
+
+// pagination reads the page and limit query parameters and returns them with
+// the offset of the page. The limit is clamped to 1..maxPageSize and the page
+// to 1..maxPage, so the offset is never negative and the page count never
+// divides by zero.
+func pagination(c *fiber.Ctx, defaultLimit int) (page, limit, offset int) {
+	page = clamp(c.QueryInt("page", 1), 1, maxPage)
+	limit = clamp(c.QueryInt("limit", defaultLimit), 1, maxPageSize)
+	return page, limit, (page - 1) * limit
+}
+
+// pageMeta describes a page of a list with total records
+func pageMeta(total, page, limit int) fiber.Map {
+	return fiber.Map{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"pages": (total + limit - 1) / limit,
+	}
+}
+
+// clamp limits value to the range lo..hi
+func clamp(value, lo, hi int) int {
+	return max(lo, min(value, hi))
+}
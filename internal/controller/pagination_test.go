@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		query               string
+		page, limit, offset int
+	}{
+		{"", 1, 20, 0},
+		{"?page=3&limit=10", 3, 10, 20},
+		{"?limit=0", 1, 1, 0},
+		{"?limit=-5&page=2", 2, 1, 1},
+		{"?limit=1000", 1, maxPageSize, 0},
+		{"?page=0", 1, 20, 0},
+		{"?page=-3&limit=10", 1, 10, 0},
+		{"?page=abc&limit=xyz", 1, 20, 0},
+		{"?page=9223372036854775807&limit=100", maxPage, 100, (maxPage - 1) * 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				page, limit, offset := pagination(c, 20)
+				if page != tt.page || limit != tt.limit || offset != tt.offset {
+					t.Errorf("got page %d, limit %d, offset %d, want %d, %d, %d", page, limit, offset, tt.page, tt.limit, tt.offset)
+				}
+				return nil
+			})
+			if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), -1); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestPageMeta(t *testing.T) {
+	for _, tt := range []struct{ total, limit, pages int }{
+		{0, 10, 0},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+	} {
+		if pages := pageMeta(tt.total, 1, tt.limit)["pages"]; pages != tt.pages {
+			t.Errorf("%d records of %d per page: %v pages, want %d", tt.total, tt.limit, pages, tt.pages)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+)
+
+// GetPermissions gets the permission catalog and the role mapping (admin only)
+func GetPermissions(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"permissions": permissions.All,
+		"roles":       permissions.Roles(c.UserContext()),
+	})
+}
+
+// UpdateRolePermissions replaces the permissions granted to a role (admin only)
+func UpdateRolePermissions(c *fiber.Ctx) error {
+	// Get role from URL parameter
+	role := c.Params("role")
+	if role == "" || len(role) > 20 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role is required and must be at most 20 characters",
+		})
+	}
+
+	// Parse request body
+	var update struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate permissions. An empty set would lock everyone with the role out
+	// of the API, so roles cannot be emptied here.
+	if len(update.Permissions) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one permission is required",
+		})
+	}
+	for _, perm := range update.Permissions {
+		if !permissions.Valid(perm) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown permission: " + perm,
+			})
+		}
+	}
+
+	// Prevent admins from removing their own ability to manage permissions
+	if role == c.Locals("role").(string) {
+		keepsManage := false
+		for _, perm := range update.Permissions {
+			if perm == permissions.PermissionsManage {
+				keepsManage = true
+			}
+		}
+		if !keepsManage {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot remove " + permissions.PermissionsManage + " from your own role",
+			})
+		}
+	}
+
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Update role permissions in database and the audit log
+	if err := permissions.SetRolePermissions(c.UserContext(), role, update.Permissions, userID); err != nil {
+		logging.Ctx(c).Error("Error updating role permissions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating role permissions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     "Role permissions updated successfully",
+		"role":        role,
+		"permissions": permissions.ForRole(c.UserContext(), role),
+	})
+}
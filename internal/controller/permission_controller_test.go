@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+)
+
+func TestUpdateRolePermissions(t *testing.T) {
+	store := sqliteStore(t)
+	app := testApp(store)
+	admin := createUser(t, store, "root", "admin")
+
+	type body struct {
+		Permissions []string `json:"permissions"`
+	}
+	tests := []struct {
+		name        string
+		role        string
+		permissions []string
+		want        int
+	}{
+		{"empty set", "guard", []string{}, http.StatusBadRequest},
+		{"missing set", "guard", nil, http.StatusBadRequest},
+		{"unknown permission", "guard", []string{"items:destroy"}, http.StatusBadRequest},
+		{"own role without permissions:manage", "admin", []string{permissions.UsersView}, http.StatusBadRequest},
+		{"valid", "guard", []string{permissions.ItemsViewAll, permissions.ItemsUpdateAny}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := request(t, app, http.MethodPut, "/admin/roles/"+tt.role+"/permissions", admin, body{tt.permissions}, nil); status != tt.want {
+				t.Errorf("status %d, want %d", status, tt.want)
+			}
+		})
+	}
+
+	// Only the successful update changed the role, and it is in the audit log
+	if got := permissions.ForRole(context.Background(), "guard"); len(got) != 2 {
+		t.Errorf("guard has permissions %v", got)
+	}
+	var changes []struct {
+		Role        string `db:"role"`
+		Previous    string `db:"previous_permissions"`
+		Permissions string `db:"permissions"`
+		ChangedBy   int    `db:"changed_by"`
+	}
+	if err := database.DB.Select(&changes, "SELECT role, previous_permissions, permissions, changed_by FROM role_permission_changes"); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("%d audit log entries, want 1", len(changes))
+	}
+	change := changes[0]
+	if change.Role != "guard" || change.ChangedBy != admin || change.Permissions != permissions.ItemsUpdateAny+","+permissions.ItemsViewAll {
+		t.Errorf("audit log entry %+v", change)
+	}
+	if change.Previous == "" || change.Previous == change.Permissions {
+		t.Errorf("previous permissions %q not recorded", change.Previous)
+	}
+}
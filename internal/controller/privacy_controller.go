@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/middleware"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+	"github.com/omniflare/campus-lostandfound/internal/utils/contact"
+)
+
+// Message policies a user can choose
+const (
+	messagePolicyEveryone    = "everyone"
+	messagePolicyItemRelated = "item_related"
+)
+
+// Profile field visibilities a user can choose
+const (
+	visibilityEveryone     = "everyone"
+	visibilityParticipants = "participants" // Users who share a conversation with them
+	visibilityNobody       = "nobody"
+)
+
+// GetBlockedUsers gets the users blocked by the current user
+func GetBlockedUsers(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get blocked users from database
+	blocks, err := privacyRepo.Blocks(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving blocked users", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving blocked users",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"blocked_users": blocks,
+	})
+}
+
+// BlockUser blocks another user from messaging the current user
+func BlockUser(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Parse request body
+	var blockReq struct {
+		UserID int `json:"user_id"`
+	}
+	if err := c.BodyParser(&blockReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate the user to block
+	if blockReq.UserID == 0 || blockReq.UserID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A user ID other than your own is required",
+		})
+	}
+	exists, err := userRepo.Exists(c.UserContext(), blockReq.UserID)
+	if err != nil || !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// Insert the block into the database
+	if err := privacyRepo.Block(c.UserContext(), userID, blockReq.UserID); err != nil {
+		logging.Ctx(c).Error("Error blocking user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error blocking user",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User blocked successfully",
+	})
+}
+
+// UnblockUser removes a block created by the current user
+func UnblockUser(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Get blocked user ID from URL parameter
+	blockedID, err := c.ParamsInt("id")
+	if err != nil || blockedID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	// Delete the block from the database
+	err = privacyRepo.Unblock(c.UserContext(), userID, blockedID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not blocked",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error unblocking user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error unblocking user",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unblocked successfully",
+	})
+}
+
+// GetUserSettings gets the current user's privacy settings
+func GetUserSettings(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	settings, err := userSettings(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving settings", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving settings",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(settings)
+}
+
+// UpdateUserSettings updates the current user's privacy settings
+func UpdateUserSettings(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	userID := c.Locals("user_id").(int)
+
+	// Start from the current settings so omitted fields are kept
+	settings, err := userSettings(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving settings", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving settings",
+		})
+	}
+
+	// Parse request body
+	if err := c.BodyParser(&settings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate message policy
+	if settings.MessagePolicy != messagePolicyEveryone && settings.MessagePolicy != messagePolicyItemRelated {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message policy. Must be one of: everyone, item_related",
+		})
+	}
+
+	// Validate profile visibilities
+	validVisibilities := map[string]bool{visibilityEveryone: true, visibilityParticipants: true, visibilityNobody: true}
+	if !validVisibilities[settings.NameVisibility] || !validVisibilities[settings.EmailVisibility] || !validVisibilities[settings.PhoneVisibility] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid visibility. Must be one of: everyone, participants, nobody",
+		})
+	}
+
+	// Save settings in database
+	settings.UserID = userID
+	settings.UpdatedAt = time.Now()
+	if err := privacyRepo.SaveSettings(c.UserContext(), settings); err != nil {
+		logging.Ctx(c).Error("Error updating settings", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating settings",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Settings updated successfully",
+		"settings": settings,
+	})
+}
+
+// GetPublicProfile gets another user's profile, limited by their privacy settings
+func GetPublicProfile(c *fiber.Ctx) error {
+	// Get user ID from JWT context
+	viewerID := c.Locals("user_id").(int)
+
+	// Get profile user ID from URL parameter
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	// Get user from database
+	user, err := userRepo.Get(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	settings, err := userSettings(c.UserContext(), userID)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving settings", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving settings",
+		})
+	}
+
+	// Work out how close the viewer is to the user
+	self := viewerID == userID
+	staff := middleware.HasPermission(c, permissions.UsersView)
+	var sharesConversation bool
+	if !self && !staff {
+		sharesConversation, err = conversationRepo.ShareConversation(c.UserContext(), viewerID, userID)
+		if err != nil {
+			logging.Ctx(c).Error("Database error", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Database error",
+			})
+		}
+	}
+	visible := func(visibility string) bool {
+		switch {
+		case self || staff || visibility == visibilityEveryone:
+			return true
+		case visibility == visibilityParticipants:
+			return sharesConversation
+		default:
+			return false
+		}
+	}
+
+	profile := models.PublicProfile{
+		ID:       user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+	}
+	if visible(settings.NameVisibility) {
+		profile.FirstName = &user.FirstName
+		profile.LastName = &user.LastName
+	}
+	if visible(settings.EmailVisibility) {
+		profile.Email = &user.Email
+	}
+	if visible(settings.PhoneVisibility) {
+		profile.Phone = &user.Phone
+	}
+
+	return c.Status(fiber.StatusOK).JSON(profile)
+}
+
+// userSettings returns a user's settings, or the defaults if they have never saved any
+func userSettings(ctx context.Context, userID int) (models.UserSettings, error) {
+	settings, err := privacyRepo.Settings(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.UserSettings{
+			UserID:          userID,
+			MessagePolicy:   messagePolicyEveryone,
+			NameVisibility:  visibilityEveryone,
+			EmailVisibility: visibilityParticipants,
+			PhoneVisibility: visibilityParticipants,
+		}, nil
+	}
+	return settings, err
+}
+
+// isBlocked reports whether either user has blocked the other
+func isBlocked(ctx context.Context, userID, otherUserID int) (bool, error) {
+	return privacyRepo.IsBlocked(ctx, userID, otherUserID)
+}
+
+// checkCanMessage returns a *fiber.Error explaining why senderID may not start
+// a conversation with receiverID about itemID, or nil if they may
+func checkCanMessage(ctx context.Context, senderID, receiverID int, itemID *int) error {
+	if senderID == receiverID {
+		return fiber.NewError(fiber.StatusBadRequest, "You cannot send a message to yourself")
+	}
+
+	blocked, err := isBlocked(ctx, senderID, receiverID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return fiber.NewError(fiber.StatusForbidden, "You cannot message this user")
+	}
+
+	settings, err := userSettings(ctx, receiverID)
+	if err != nil {
+		return err
+	}
+	if settings.MessagePolicy == messagePolicyItemRelated {
+		// The item must be one the receiver reported or found
+		related := false
+		if itemID != nil {
+			item, err := itemRepo.Get(ctx, *itemID)
+			switch {
+			case err == nil:
+				related = (item.ReporterID != nil && *item.ReporterID == receiverID) || (item.FinderID != nil && *item.FinderID == receiverID)
+			case !errors.Is(err, repository.ErrNotFound):
+				return err
+			}
+		}
+		if !related {
+			return fiber.NewError(fiber.StatusForbidden, "This user only accepts messages about items they reported or found")
+		}
+	}
+
+	return nil
+}
+
+// checkConversationBlocks returns a *fiber.Error if a block exists between the
+// sender and another participant of a conversation. Mediators are not considered.
+func checkConversationBlocks(ctx context.Context, participants []models.ConversationParticipant, senderID int) error {
+	for _, p := range participants {
+		if p.UserID == senderID || p.Role != "participant" {
+			continue
+		}
+		blocked, err := isBlocked(ctx, senderID, p.UserID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return fiber.NewError(fiber.StatusForbidden, "You cannot message this user")
+		}
+	}
+	return nil
+}
+
+// applyContactPolicy detects email addresses and phone numbers in a message
+// and redacts them if any participant uses masked contact mode and the
+// conversation's item has not yet been claimed
+func applyContactPolicy(ctx context.Context, conversationID int, content string) (string, bool, bool, error) {
+	if !contact.Detect(content) {
+		return content, false, false, nil
+	}
+
+	masked, err := conversationRepo.ContactMasked(ctx, conversationID)
+	if err != nil {
+		return content, true, false, err
+	}
+	if !masked {
+		return content, true, false, nil
+	}
+
+	redacted, _ := contact.Redact(content)
+	return redacted, true, true, nil
+}
+
+// messageSentResponse responds to a sent message, warning the sender about contact details
+func messageSentResponse(c *fiber.Ctx, message models.Message, extra fiber.Map) error {
+	response := fiber.Map{
+		"message":         "Message sent successfully",
+		"message_id":      message.ID,
+		"conversation_id": message.ConversationID,
+	}
+	if message.ContactInfoRedacted {
+		response["warning"] = "Contact details were hidden because this conversation uses masked contact mode until the item is claimed"
+	} else if message.ContainsContactInfo {
+		response["warning"] = "Your message appears to contain contact details. Consider keeping communication on the platform until the item is claimed"
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// messagingErrorResponse responds to an error from checkCanMessage or checkConversationBlocks
+func messagingErrorResponse(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	logging.Ctx(c).Error("Error checking messaging permissions", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Database error",
+	})
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/realtime"
+	"github.com/omniflare/campus-lostandfound/internal/utils/jwt"
+)
+
+const (
+	// socketPingInterval is how often the server pings idle websocket clients
+	socketPingInterval = 30 * time.Second
+
+	// socketReadTimeout closes connections that stop answering pings
+	socketReadTimeout = 2 * socketPingInterval
+
+	// socketMaxMessageSize limits frames sent by clients
+	socketMaxMessageSize = 4096
+
+	// typingInterval is how often a client's typing frames for one
+	// conversation or receiver are relayed. Frames in between are dropped
+	// before they reach the database.
+	typingInterval = 3 * time.Second
+)
+
+// socketRequest is a frame sent by a websocket client
+type socketRequest struct {
+	Type           string `json:"type"` // typing, read
+	ConversationID int    `json:"conversation_id"`
+	ReceiverID     int    `json:"receiver_id"`
+	OtherUserID    int    `json:"other_user_id"`
+	ItemID         int    `json:"item_id"`
+}
+
+// typingKey identifies who a typing frame is for
+type typingKey struct {
+	conversationID, receiverID, itemID int
+}
+
+// typingThrottle remembers when a connection's typing frames were last relayed
+type typingThrottle map[typingKey]time.Time
+
+// allow reports whether a typing frame for the key should be relayed now
+func (t typingThrottle) allow(key typingKey, now time.Time) bool {
+	if last, ok := t[key]; ok && now.Sub(last) < typingInterval {
+		return false
+	}
+	// Forget keys that would be allowed anyway, so the map stays small
+	if len(t) >= 64 {
+		for k, last := range t {
+			if now.Sub(last) >= typingInterval {
+				delete(t, k)
+			}
+		}
+	}
+	t[key] = now
+	return true
+}
+
+// WebSocketAuth authenticates a websocket handshake with a JWT. Browsers cannot
+// set headers on websocket requests, so the token may also be passed as ?token=.
+func WebSocketAuth(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "WebSocket upgrade required",
+		})
+	}
+
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		tokenString = strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	}
+	if tokenString == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Missing or invalid authorization token",
+		})
+	}
+
+	// Validate the token
+	claims, err := jwt.Validate(tokenString)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: " + err.Error(),
+		})
+	}
+	if !permissions.Has(c.UserContext(), claims.Role, permissions.MessagesSend) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Forbidden: Missing permission " + permissions.MessagesSend,
+		})
+	}
+
+	// Store user information for the websocket handler
+	c.Locals("user_id", claims.UserID)
+	c.Locals("username", claims.Username)
+	c.Locals("role", claims.Role)
+
+	return c.Next()
+}
+
+// MessagesSocket pushes new messages, read receipts and typing indicators to
+// the connected user and accepts typing and read frames from them
+var MessagesSocket = websocket.New(func(conn *websocket.Conn) {
+	userID := conn.Locals("user_id").(int)
+
+	client := realtime.Register(userID)
+	defer realtime.Unregister(client)
+
+	// Lookups made for the client's frames end with the connection, or when
+	// shutdown begins, which also closes the connection
+	draining := context.Background()
+	if workers != nil {
+		draining = workers.Draining()
+	}
+	ctx, cancel := context.WithCancel(draining)
+	defer cancel()
+
+	// Write events and keepalive pings from a single goroutine
+	go func() {
+		ticker := time.NewTicker(socketPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case payload, ok := <-client.Send():
+				if !ok {
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+					conn.Close()
+					return
+				}
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					conn.Close()
+					return
+				}
+			case <-ctx.Done():
+				// Tell the client to reconnect to another instance
+				if draining.Err() != nil {
+					conn.SetWriteDeadline(time.Now().Add(time.Second))
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+					conn.Close()
+				}
+				return
+			}
+		}
+	}()
+
+	conn.SetReadLimit(socketMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	})
+
+	// Handle frames until the client disconnects
+	typing := typingThrottle{}
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+
+		var req socketRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			continue
+		}
+
+		switch req.Type {
+		case "typing":
+			if !typing.allow(typingKey{req.ConversationID, req.ReceiverID, req.ItemID}, time.Now()) {
+				continue
+			}
+			// Typing indicators are only relayed to users the sender may message
+			if req.ConversationID != 0 {
+				if _, ok := participantRole(ctx, req.ConversationID, userID); !ok {
+					continue
+				}
+				participants, err := conversationRepo.Participants(ctx, req.ConversationID)
+				if err != nil || checkConversationBlocks(ctx, participants, userID) != nil {
+					continue
+				}
+				publishToConversation(ctx, req.ConversationID, realtime.Typing, fiber.Map{
+					"conversation_id": req.ConversationID,
+					"sender_id":       userID,
+				})
+			} else if req.ReceiverID != 0 {
+				var itemID *int
+				if req.ItemID != 0 {
+					itemID = &req.ItemID
+				}
+				if checkCanMessage(ctx, userID, req.ReceiverID, itemID) != nil {
+					continue
+				}
+				realtime.Publish(realtime.Typing, fiber.Map{
+					"sender_id": userID,
+					"item_id":   req.ItemID,
+				}, req.ReceiverID)
+			}
+		case "read":
+			if req.ConversationID != 0 {
+				if _, ok := participantRole(ctx, req.ConversationID, userID); ok {
+					markConversationRead(ctx, req.ConversationID, userID)
+				}
+			} else if req.OtherUserID != 0 {
+				markMessagesRead(ctx, userID, req.OtherUserID)
+			}
+		}
+	}
+})
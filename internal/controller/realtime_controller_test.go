@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTypingThrottle(t *testing.T) {
+	throttle := typingThrottle{}
+	start := time.Now()
+	conversation := typingKey{conversationID: 1}
+	direct := typingKey{receiverID: 2, itemID: 5}
+
+	tests := []struct {
+		key   typingKey
+		after time.Duration
+		want  bool
+	}{
+		{conversation, 0, true},
+		{conversation, time.Second, false},
+		{direct, time.Second, true}, // Each conversation or receiver has its own interval
+		{conversation, typingInterval - time.Millisecond, false},
+		{conversation, typingInterval, true},
+		{conversation, typingInterval + time.Second, false},
+		{direct, typingInterval + time.Second, true},
+	}
+	for _, tt := range tests {
+		if got := throttle.allow(tt.key, start.Add(tt.after)); got != tt.want {
+			t.Errorf("allow(%+v) after %s = %v, want %v", tt.key, tt.after, got, tt.want)
+		}
+	}
+
+	// Keys past their interval are forgotten once there are many
+	for i := 0; i < 100; i++ {
+		throttle.allow(typingKey{conversationID: 100 + i}, start.Add(time.Duration(i)*typingInterval))
+	}
+	if len(throttle) > 65 {
+		t.Errorf("throttle holds %d keys", len(throttle))
+	}
+}
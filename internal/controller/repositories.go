@@ -0,0 +1,34 @@
+package controller
+
+import "github.com/omniflare/campus-lostandfound/internal/repository"
+
+// Repositories used by the handlers, set at startup with UseRepositories
+var (
+	itemRepo         repository.ItemRepository
+	userRepo         repository.UserRepository
+	messageRepo      repository.MessageRepository
+	reportRepo       repository.ReportRepository
+	conversationRepo repository.ConversationRepository
+	privacyRepo      repository.PrivacyRepository
+	notificationRepo repository.NotificationRepository
+	apiKeyRepo       repository.APIKeyRepository
+	webhookRepo      repository.WebhookRepository
+	loginAttemptRepo repository.LoginAttemptRepository
+	statsRepo        repository.StatsRepository
+)
+
+// UseRepositories sets the repositories the handlers read and write through,
+// such as repository.NewPostgres for the server or an in-memory store in tests
+func UseRepositories(repos repository.Repositories) {
+	itemRepo = repos.Items
+	userRepo = repos.Users
+	messageRepo = repos.Messages
+	reportRepo = repos.Reports
+	conversationRepo = repos.Conversations
+	privacyRepo = repos.Privacy
+	notificationRepo = repos.Notifications
+	apiKeyRepo = repos.APIKeys
+	webhookRepo = repos.Webhooks
+	loginAttemptRepo = repos.LoginAttempts
+	statsRepo = repos.Stats
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+// streamHeartbeatInterval keeps idle connections open through proxies
+const streamHeartbeatInterval = 15 * time.Second
+
+// StreamItems streams item created and updated events as Server-Sent Events,
+// optionally filtered by category and status. Streams end when the server
+// shuts down, and clients reconnect to another instance.
+func StreamItems(c *fiber.Ctx) error {
+	category := c.Query("category")
+	status := c.Query("status")
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+
+	sub := events.Subscribe(events.ItemCreated, events.ItemUpdated)
+	draining := context.Background()
+	if workers != nil {
+		draining = workers.Draining()
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer events.Unsubscribe(sub)
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		// Tell the client how long to wait before reconnecting
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				var item models.Item
+				if err := json.Unmarshal(event.Data, &item); err != nil {
+					continue
+				}
+				if (category != "" && item.Category != category) || (status != "" && item.Status != status) {
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+			case <-heartbeat.C:
+				fmt.Fprintf(w, ": heartbeat\n\n")
+			case <-draining.Done():
+				return
+			}
+
+			// A failed flush means the client has gone away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/config"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// uploadRules describes which files may be uploaded and where they are stored
+type uploadRules struct {
+	Kind         string            // Label for the upload metrics
+	Dir          string            // Directory the file is saved in
+	MaxSize      int64             // Largest accepted file in bytes
+	AllowedTypes map[string]string // Sniffed content type to stored file extension
+}
+
+// imageUploads are item images, served publicly from /uploads
+var imageUploads = uploadRules{
+	Kind:    "image",
+	Dir:     "./uploads",
+	MaxSize: 5 * 1024 * 1024,
+	AllowedTypes: map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	},
+}
+
+// attachmentUploads are message attachments, kept outside the public uploads directory
+var attachmentUploads = uploadRules{
+	Kind:    "attachment",
+	Dir:     "./attachments",
+	MaxSize: 10 * 1024 * 1024,
+	AllowedTypes: map[string]string{
+		"image/jpeg":      ".jpg",
+		"image/png":       ".png",
+		"image/gif":       ".gif",
+		"image/webp":      ".webp",
+		"application/pdf": ".pdf",
+	},
+}
+
+// ConfigureUploads applies the configured directories and size limits to
+// item images and message attachments
+func ConfigureUploads(cfg config.Uploads) {
+	imageUploads.Dir, imageUploads.MaxSize = cfg.ImageDir, cfg.MaxImageSize
+	attachmentUploads.Dir, attachmentUploads.MaxSize = cfg.AttachmentDir, cfg.MaxAttachmentSize
+}
+
+// savedUpload is a validated file written to disk
+type savedUpload struct {
+	Filename    string // Generated name within the rules' directory
+	ContentType string
+	Size        int64
+}
+
+// saveUpload validates an uploaded file by size and sniffed content type and
+// saves it under a generated name. Validation failures are returned as
+// *fiber.Error with a 4xx code.
+func saveUpload(c *fiber.Ctx, file *multipart.FileHeader, rules uploadRules) (*savedUpload, error) {
+	if file.Size > rules.MaxSize {
+		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, "File is too large")
+	}
+
+	// Detect the type from the content rather than trusting the client
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	f.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := rules.AllowedTypes[contentType]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, "Unsupported file type: "+contentType)
+	}
+
+	// Never use the client's filename on disk
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	filename := time.Now().Format("20060102150405") + "_" + hex.EncodeToString(random) + ext
+
+	_, span := tracing.Start(c.UserContext(), "file save",
+		attribute.String("upload.kind", rules.Kind),
+		attribute.String("upload.content_type", contentType),
+		attribute.Int64("upload.size", file.Size))
+	err = c.SaveFile(file, filepath.Join(rules.Dir, filename))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	metrics.AddUploadBytes(rules.Kind, file.Size)
+
+	return &savedUpload{Filename: filename, ContentType: contentType, Size: file.Size}, nil
+}
+
+// uploadErrorResponse responds to an error from saveUpload
+func uploadErrorResponse(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	logging.Ctx(c).Error("Error saving file", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error saving file",
+	})
+}
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+	"github.com/omniflare/campus-lostandfound/internal/webhooks"
+)
+
+// GetWebhooks gets all registered webhooks (admin only)
+func GetWebhooks(c *fiber.Ctx) error {
+	hooks, err := webhookRepo.List(c.UserContext())
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving webhooks", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving webhooks",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"webhooks":    hooks,
+		"event_types": webhooks.EventTypes,
+	})
+}
+
+// CreateWebhook registers a webhook endpoint (admin only). The signing secret
+// is only returned in this response.
+func CreateWebhook(c *fiber.Ctx) error {
+	// Get admin ID from JWT context
+	adminID := c.Locals("user_id").(int)
+
+	// Parse request body
+	var webhookReq models.WebhookRequest
+	if err := c.BodyParser(&webhookReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if msg := validateWebhookRequest(webhookReq); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		logging.Ctx(c).Error("Error generating webhook secret", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error generating webhook secret",
+		})
+	}
+
+	active := true
+	if webhookReq.Active != nil {
+		active = *webhookReq.Active
+	}
+
+	// Insert the webhook into the database
+	now := time.Now()
+	webhook := models.Webhook{
+		URL:         webhookReq.URL,
+		Description: webhookReq.Description,
+		Secret:      secret,
+		EventTypes:  webhookReq.EventTypes,
+		Active:      active,
+		CreatedBy:   &adminID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := webhookRepo.Create(c.UserContext(), &webhook); err != nil {
+		logging.Ctx(c).Error("Error creating webhook", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error creating webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Webhook created successfully. Store the secret now, it will not be shown again",
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+// UpdateWebhook changes a webhook's URL, description, event types or active flag (admin only)
+func UpdateWebhook(c *fiber.Ctx) error {
+	// Get webhook ID from URL parameter
+	webhookID, err := c.ParamsInt("id")
+	if err != nil || webhookID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	// Parse request body
+	var webhookReq models.WebhookRequest
+	if err := c.BodyParser(&webhookReq); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if msg := validateWebhookRequest(webhookReq); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	// Update the webhook in database, keeping the active flag unless given
+	webhook, err := webhookRepo.Update(c.UserContext(), webhookID, webhookReq)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error updating webhook", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error updating webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Webhook updated successfully",
+		"webhook": webhook,
+	})
+}
+
+// DeleteWebhook removes a webhook and its delivery log (admin only)
+func DeleteWebhook(c *fiber.Ctx) error {
+	// Get webhook ID from URL parameter
+	webhookID, err := c.ParamsInt("id")
+	if err != nil || webhookID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	err = webhookRepo.Delete(c.UserContext(), webhookID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+	}
+	if err != nil {
+		logging.Ctx(c).Error("Error deleting webhook", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error deleting webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// SendTestWebhook sends a webhook.test event to a webhook and returns the result (admin only)
+func SendTestWebhook(c *fiber.Ctx) error {
+	// Get webhook ID from URL parameter
+	webhookID, err := c.ParamsInt("id")
+	if err != nil || webhookID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	webhook, err := webhookRepo.Get(c.UserContext(), webhookID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+	}
+
+	delivery, err := webhooks.SendTest(c.UserContext(), webhook)
+	if err != nil {
+		logging.Ctx(c).Error("Error sending test event", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error sending test event",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Test event sent",
+		"delivery": delivery,
+	})
+}
+
+// GetWebhookDeliveries gets the delivery log of a webhook, newest first (admin only)
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	// Get webhook ID from URL parameter
+	webhookID, err := c.ParamsInt("id")
+	if err != nil || webhookID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	// Parse query parameters
+	status := c.Query("status", "all") // pending, succeeded, failed or all
+	page, limit, offset := pagination(c, 20)
+
+	deliveries, total, err := webhookRepo.Deliveries(c.UserContext(), webhookID, allToEmpty(status), limit, offset)
+	if err != nil {
+		logging.Ctx(c).Error("Error retrieving webhook deliveries", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error retrieving webhook deliveries",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"deliveries": deliveries,
+		"meta":       pageMeta(total, page, limit),
+	})
+}
+
+// validateWebhookRequest returns an error message for an invalid webhook, or "" if it is valid
+func validateWebhookRequest(webhookReq models.WebhookRequest) string {
+	if !webhooks.ValidURL(webhookReq.URL) {
+		return "A valid http or https URL is required"
+	}
+	if len(webhookReq.EventTypes) == 0 {
+		return "At least one event type is required"
+	}
+	for _, eventType := range webhookReq.EventTypes {
+		if !webhooks.ValidEventType(eventType) {
+			return "Unknown event type: " + eventType
+		}
+	}
+	return ""
+}
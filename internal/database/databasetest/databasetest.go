@@ -0,0 +1,36 @@
+// Package databasetest opens a migrated database for tests, so that handler
+// and repository tests run against the real schema without any services.
+package databasetest
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+)
+
+// URL is the database tests run against. Every connection of the pool shares
+// the same in-memory SQLite database, which is dropped once they all close.
+const URL = "sqlite://file::memory:?cache=shared"
+
+// Open points database.DB at an empty in-memory database with every migration
+// applied and closes it when the test ends. Tests using it must not run in parallel.
+func Open(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	db, err := database.Open(URL)
+	if err != nil {
+		t.Fatalf("opening %s: %v", URL, err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+	})
+
+	if _, err := database.MigrateUp(); err != nil {
+		t.Fatalf("migrating %s: %v", URL, err)
+	}
+	return db
+}
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationFiles holds the numbered schema migrations for each storage driver,
+// named NNNN_description.up.sql and NNNN_description.down.sql. Both drivers
+// have the same versions.
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the PostgreSQL advisory lock held while migrations run so
+// that API instances starting together do not migrate at the same time
+const migrationLockID = 72657301
+
+// Migration is a numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and when it was applied, if it has been
+type MigrationStatus struct {
+	Version   int        `db:"version" json:"version"`
+	Name      string     `db:"name" json:"name"`
+	AppliedAt *time.Time `db:"applied_at" json:"applied_at"`
+}
+
+// Migrations returns the embedded migrations for the storage driver in version order
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/"+Driver+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		stem, direction := strings.TrimSuffix(base, ".sql"), ""
+		switch {
+		case strings.HasSuffix(stem, ".up"):
+			stem, direction = strings.TrimSuffix(stem, ".up"), "up"
+		case strings.HasSuffix(stem, ".down"):
+			stem, direction = strings.TrimSuffix(stem, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", base)
+		}
+
+		number, description, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a version number", base)
+		}
+
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: description}
+			byVersion[version] = m
+		} else if m.Name != description {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, m.Name, description)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones applied
+func MigrateUp() ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = withMigrationLock(func(conn *sqlx.Conn) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err := runMigration(conn, m.Up, `
+				INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)
+			`, m.Version, m.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the most recently applied migrations, at most steps of
+// them, and returns the ones reverted
+func MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	var reverted []Migration
+	err = withMigrationLock(func(conn *sqlx.Conn) error {
+		var versions []int
+		err := conn.SelectContext(context.Background(), &versions, `
+			SELECT version FROM schema_migrations ORDER BY version DESC LIMIT $1
+		`, steps)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			m, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %04d is applied but has no migration file", version)
+			}
+			err := runMigration(conn, m.Down, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatuses lists every known migration with when it was applied,
+// including applied versions that no longer have a migration file
+func MigrationStatuses() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureMigrationsTable(DB); err != nil {
+		return nil, err
+	}
+	var applied []MigrationStatus
+	if err := DB.Select(&applied, "SELECT version, name, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+
+	statuses := map[int]MigrationStatus{}
+	for _, m := range migrations {
+		statuses[m.Version] = MigrationStatus{Version: m.Version, Name: m.Name}
+	}
+	for _, s := range applied {
+		statuses[s.Version] = s
+	}
+
+	list := make([]MigrationStatus, 0, len(statuses))
+	for _, s := range statuses {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// SchemaVersion returns the highest applied migration version and the latest
+// embedded one, which differ while migrations are pending
+func SchemaVersion(ctx context.Context) (current, latest int, err error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	err = DB.GetContext(ctx, &current, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	return current, latest, err
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration
+// advisory lock, waiting for any other instance that holds it
+func withMigrationLock(fn func(conn *sqlx.Conn) error) error {
+	ctx := context.Background()
+	conn, err := DB.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// An embedded SQLite database is only used by one instance, and it has no advisory locks
+	if !IsSQLite() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}
+
+	if err := ensureMigrationsTable(conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func ensureMigrationsTable(e sqlx.ExecerContext) error {
+	_, err := e.ExecContext(context.Background(), `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// appliedVersions returns the versions recorded in schema_migrations
+func appliedVersions(conn *sqlx.Conn) (map[int]struct{}, error) {
+	var versions []int
+	if err := conn.SelectContext(context.Background(), &versions, "SELECT version FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	done := make(map[int]struct{}, len(versions))
+	for _, v := range versions {
+		done[v] = struct{}{}
+	}
+	return done, nil
+}
+
+// runMigration runs a migration's SQL and the statement recording it in one
+// transaction, so a failed migration leaves no partial changes behind
+func runMigration(conn *sqlx.Conn, script, record string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// logMigrations logs each migration with a verb such as "Applied"
+func logMigrations(verb string, migrations []Migration) {
+	for _, m := range migrations {
+		slog.Info(verb+" migration", "version", m.Version, "name", m.Name)
+	}
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS images;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS users;
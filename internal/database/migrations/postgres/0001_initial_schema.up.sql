@@ -0,0 +1,60 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	username VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	password_hash VARCHAR(255) NOT NULL,
+	role VARCHAR(20) NOT NULL DEFAULT 'student',
+	first_name VARCHAR(50),
+	last_name VARCHAR(50),
+	phone VARCHAR(20),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS items (
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(100) NOT NULL,
+	description TEXT,
+	category VARCHAR(50) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'lost',
+	location VARCHAR(255),
+	lost_time TIMESTAMP WITH TIME ZONE,
+	report_time TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	claimed_time TIMESTAMP WITH TIME ZONE,
+	reporter_id INTEGER REFERENCES users(id),
+	finder_id INTEGER REFERENCES users(id),
+	image_url VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS images (
+	id SERIAL PRIMARY KEY,
+	item_id INTEGER REFERENCES items(id),
+	image_url VARCHAR(255) NOT NULL,
+	timestamp TIMESTAMP WITH TIME ZONE,
+	latitude DOUBLE PRECISION,
+	longitude DOUBLE PRECISION,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id SERIAL PRIMARY KEY,
+	sender_id INTEGER REFERENCES users(id),
+	receiver_id INTEGER REFERENCES users(id),
+	item_id INTEGER REFERENCES items(id),
+	content TEXT NOT NULL,
+	read BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+	id SERIAL PRIMARY KEY,
+	reporter_id INTEGER REFERENCES users(id),
+	reported_id INTEGER REFERENCES users(id),
+	item_id INTEGER REFERENCES items(id),
+	reason TEXT NOT NULL,
+	status VARCHAR(20) DEFAULT 'pending',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
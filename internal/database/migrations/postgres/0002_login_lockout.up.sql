@@ -0,0 +1,16 @@
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS failed_login_count INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	id SERIAL PRIMARY KEY,
+	username VARCHAR(50) NOT NULL,
+	user_id INTEGER REFERENCES users(id),
+	ip_address VARCHAR(45) NOT NULL,
+	user_agent VARCHAR(255),
+	success BOOLEAN NOT NULL DEFAULT FALSE,
+	reason VARCHAR(20) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip_created ON login_attempts (ip_address, created_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS permissions (
+	name VARCHAR(50) PRIMARY KEY,
+	description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role VARCHAR(20) NOT NULL,
+	permission VARCHAR(50) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+	PRIMARY KEY (role, permission)
+);
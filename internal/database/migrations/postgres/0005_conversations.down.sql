@@ -0,0 +1,4 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS conversation_id;
+
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS conversations;
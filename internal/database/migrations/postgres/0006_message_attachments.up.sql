@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS message_attachments (
+	id SERIAL PRIMARY KEY,
+	message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	uploader_id INTEGER NOT NULL REFERENCES users(id),
+	filename VARCHAR(255) NOT NULL,
+	content_type VARCHAR(100) NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	storage_name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
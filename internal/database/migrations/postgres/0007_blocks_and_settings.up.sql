@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_blocks (
+	blocker_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	blocked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_settings (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	message_policy VARCHAR(20) NOT NULL DEFAULT 'everyone',
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
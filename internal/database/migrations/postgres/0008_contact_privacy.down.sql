@@ -0,0 +1,9 @@
+ALTER TABLE messages
+	DROP COLUMN IF EXISTS contact_info_redacted,
+	DROP COLUMN IF EXISTS contains_contact_info;
+
+ALTER TABLE user_settings
+	DROP COLUMN IF EXISTS phone_visibility,
+	DROP COLUMN IF EXISTS email_visibility,
+	DROP COLUMN IF EXISTS name_visibility,
+	DROP COLUMN IF EXISTS masked_contact;
@@ -0,0 +1,9 @@
+ALTER TABLE user_settings
+	ADD COLUMN IF NOT EXISTS masked_contact BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS name_visibility VARCHAR(20) NOT NULL DEFAULT 'everyone',
+	ADD COLUMN IF NOT EXISTS email_visibility VARCHAR(20) NOT NULL DEFAULT 'participants',
+	ADD COLUMN IF NOT EXISTS phone_visibility VARCHAR(20) NOT NULL DEFAULT 'participants';
+
+ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS contains_contact_info BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS contact_info_redacted BOOLEAN NOT NULL DEFAULT FALSE;
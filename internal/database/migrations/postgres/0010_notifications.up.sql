@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS notifications (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(50) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	body TEXT,
+	data JSONB,
+	read_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at DESC);
+
+-- A missing row means the type is enabled
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(50) NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, type)
+);
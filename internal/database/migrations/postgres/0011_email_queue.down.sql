@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS email_queue;
+
+ALTER TABLE user_settings
+	DROP COLUMN IF EXISTS last_digest_at,
+	DROP COLUMN IF EXISTS email_frequency;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS emailed_at;
@@ -0,0 +1,24 @@
+-- Track email delivery of notifications and each user's email preference
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS emailed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE user_settings
+	ADD COLUMN IF NOT EXISTS email_frequency VARCHAR(20) NOT NULL DEFAULT 'immediate',
+	ADD COLUMN IF NOT EXISTS last_digest_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS email_queue (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	to_address VARCHAR(255) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	text_body TEXT NOT NULL,
+	html_body TEXT NOT NULL,
+	unsubscribe_url TEXT,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	last_error TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_queue_pending ON email_queue (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- Events whose handlers keep failing are given up on and kept for inspection
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (id) WHERE published_at IS NULL AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_failed ON outbox (id) WHERE failed_at IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Audit log of edits to the role to permission mapping
+CREATE TABLE IF NOT EXISTS role_permission_changes (
+	id SERIAL PRIMARY KEY,
+	role VARCHAR(20) NOT NULL,
+	previous_permissions TEXT NOT NULL,
+	permissions TEXT NOT NULL,
+	changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_permission_changes_created ON role_permission_changes (created_at);
@@ -0,0 +1,57 @@
+-- Conversations are keyed by item and the two original participants
+CREATE TABLE IF NOT EXISTS conversations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	item_id INTEGER REFERENCES items(id),
+	participant_key VARCHAR(50) NOT NULL,
+	created_by INTEGER REFERENCES users(id),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_item_participants ON conversations (COALESCE(item_id, 0), participant_key);
+
+CREATE TABLE IF NOT EXISTS conversation_participants (
+	conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	role VARCHAR(20) NOT NULL DEFAULT 'participant',
+	last_read_at TIMESTAMP,
+	joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (conversation_id, user_id)
+);
+
+-- SQLite cannot drop a column that has a foreign key, so this one has none
+ALTER TABLE messages ADD COLUMN conversation_id INTEGER;
+
+-- Group messages sent before conversations existed into one conversation per
+-- item and pair of users
+INSERT INTO conversations (item_id, participant_key, created_at, updated_at)
+SELECT item_id,
+	MIN(sender_id, receiver_id) || ':' || MAX(sender_id, receiver_id),
+	MIN(created_at), MAX(created_at)
+FROM messages
+WHERE conversation_id IS NULL AND sender_id IS NOT NULL AND receiver_id IS NOT NULL
+GROUP BY item_id, MIN(sender_id, receiver_id), MAX(sender_id, receiver_id)
+ON CONFLICT DO NOTHING;
+
+UPDATE messages
+SET conversation_id = (
+	SELECT c.id FROM conversations c
+	WHERE COALESCE(c.item_id, 0) = COALESCE(messages.item_id, 0)
+		AND c.participant_key = MIN(messages.sender_id, messages.receiver_id) || ':' || MAX(messages.sender_id, messages.receiver_id)
+)
+WHERE conversation_id IS NULL AND sender_id IS NOT NULL AND receiver_id IS NOT NULL;
+
+-- Each participant has read up to their latest sent or read message
+INSERT INTO conversation_participants (conversation_id, user_id, role, last_read_at, joined_at)
+SELECT c.id, u.user_id, 'participant',
+	(SELECT MAX(m.created_at) FROM messages m
+	 WHERE m.conversation_id = c.id AND (m.sender_id = u.user_id OR (m.receiver_id = u.user_id AND m.read))),
+	c.created_at
+FROM conversations c
+JOIN (
+	SELECT id AS conversation_id, CAST(substr(participant_key, 1, instr(participant_key, ':') - 1) AS INTEGER) AS user_id FROM conversations
+	UNION ALL
+	SELECT id, CAST(substr(participant_key, instr(participant_key, ':') + 1) AS INTEGER) FROM conversations
+) u ON u.conversation_id = c.id
+WHERE NOT EXISTS (SELECT 1 FROM conversation_participants p WHERE p.conversation_id = c.id)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+ALTER TABLE messages DROP COLUMN contact_info_redacted;
+ALTER TABLE messages DROP COLUMN contains_contact_info;
+
+ALTER TABLE user_settings DROP COLUMN phone_visibility;
+ALTER TABLE user_settings DROP COLUMN email_visibility;
+ALTER TABLE user_settings DROP COLUMN name_visibility;
+ALTER TABLE user_settings DROP COLUMN masked_contact;
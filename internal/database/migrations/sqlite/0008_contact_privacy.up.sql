@@ -0,0 +1,7 @@
+ALTER TABLE user_settings ADD COLUMN masked_contact BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_settings ADD COLUMN name_visibility VARCHAR(20) NOT NULL DEFAULT 'everyone';
+ALTER TABLE user_settings ADD COLUMN email_visibility VARCHAR(20) NOT NULL DEFAULT 'participants';
+ALTER TABLE user_settings ADD COLUMN phone_visibility VARCHAR(20) NOT NULL DEFAULT 'participants';
+
+ALTER TABLE messages ADD COLUMN contains_contact_info BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE messages ADD COLUMN contact_info_redacted BOOLEAN NOT NULL DEFAULT FALSE;
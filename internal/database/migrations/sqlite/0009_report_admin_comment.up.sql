@@ -0,0 +1,2 @@
+-- Store the admin's comment when a report is resolved
+ALTER TABLE reports ADD COLUMN admin_comment TEXT;
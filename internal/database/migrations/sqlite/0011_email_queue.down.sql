@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS email_queue;
+
+ALTER TABLE user_settings DROP COLUMN last_digest_at;
+ALTER TABLE user_settings DROP COLUMN email_frequency;
+
+ALTER TABLE notifications DROP COLUMN emailed_at;
@@ -0,0 +1,8 @@
+-- Token buckets shared by API instances, keyed by limit and user or IP
+CREATE TABLE IF NOT EXISTS rate_limits (
+	key VARCHAR(255) PRIMARY KEY,
+	tokens REAL NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limits_updated_at ON rate_limits (updated_at);
@@ -0,0 +1,13 @@
+-- First responses to requests sent with an Idempotency-Key, replayed to retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	key VARCHAR(255) NOT NULL,
+	request_hash CHAR(64) NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0, -- 0 while the first request is in progress
+	content_type VARCHAR(255) NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+)
+
+// sqliteDriverName is the database/sql driver that runs the PostgreSQL
+// dialect used by the queries on embedded SQLite
+const sqliteDriverName = "sqlite-pg"
+
+// sqliteTimeFormat stores times as fixed width UTC text so that they compare
+// correctly as strings
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+// sqliteTimeFormats are the layouts SQLite and this driver write times in
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// sqliteRewrites translate the PostgreSQL-specific parts of the queries
+var sqliteRewrites = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// LIKE already ignores ASCII case in SQLite
+	{regexp.MustCompile(`(?i)\bILIKE\b`), "LIKE"},
+	// Writes are serialized, so there is nothing to lock or skip
+	{regexp.MustCompile(`(?i)\s+FOR\s+UPDATE(\s+SKIP\s+LOCKED)?\b`), ""},
+	{regexp.MustCompile(`::[a-zA-Z]+`), ""},
+	{regexp.MustCompile(`(?i)\bLEAST\(`), "MIN("},
+	{regexp.MustCompile(`(?i)\bGREATEST\(`), "MAX("},
+	{regexp.MustCompile(`(?i)\bNOW\(\)`), "CURRENT_TIMESTAMP"},
+}
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{})
+	sqlx.BindDriver(sqliteDriverName, sqlx.DOLLAR)
+}
+
+// sqliteDSN turns the path of a sqlite:// URL into a connection string that
+// enforces foreign keys and waits for other writers instead of failing. The
+// path may also be a file: URI with parameters, such as file::memory:?cache=shared.
+func sqliteDSN(path string) string {
+	if path == "" {
+		path = "lostandfound.db"
+	}
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_txlock=immediate"
+}
+
+// rewriteSQLite translates a PostgreSQL query for SQLite
+func rewriteSQLite(query string) string {
+	for _, r := range sqliteRewrites {
+		query = r.pattern.ReplaceAllString(query, r.replacement)
+	}
+	return query
+}
+
+// sqliteArgs stores times in sqliteTimeFormat
+func sqliteArgs(args []driver.NamedValue) []driver.NamedValue {
+	for i, arg := range args {
+		if t, ok := arg.Value.(time.Time); ok {
+			args[i].Value = t.UTC().Format(sqliteTimeFormat)
+		}
+	}
+	return args
+}
+
+// sqliteDriver opens SQLite connections that rewrite queries and results
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn}, nil
+}
+
+// sqliteConn is a SQLite connection that accepts PostgreSQL queries
+type sqliteConn struct {
+	driver.Conn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, rewriteSQLite(query))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStmt{stmt}, nil
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if conn, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return conn.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, rewriteSQLite(query), sqliteArgs(args))
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, rewriteSQLite(query), sqliteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRows{Rows: rows}, nil
+}
+
+func (c *sqliteConn) ResetSession(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.SessionResetter); ok {
+		return conn.ResetSession(ctx)
+	}
+	return nil
+}
+
+// sqliteStmt is a prepared statement whose arguments and results are converted
+type sqliteStmt struct {
+	driver.Stmt
+}
+
+func (s *sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.Stmt.(driver.StmtExecContext).ExecContext(ctx, sqliteArgs(args))
+}
+
+func (s *sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, sqliteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRows{Rows: rows}, nil
+}
+
+// sqliteRows returns times for timestamp columns and for expressions such as
+// MAX(created_at), which SQLite returns as text, and bytes for JSON columns
+// as PostgreSQL does
+type sqliteRows struct {
+	driver.Rows
+	columnTypes []string
+}
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+
+	if r.columnTypes == nil {
+		r.columnTypes = make([]string, len(dest))
+		if types, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			for i := range dest {
+				r.columnTypes[i] = strings.ToUpper(types.ColumnTypeDatabaseTypeName(i))
+			}
+		}
+	}
+
+	for i, v := range dest {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		declared := r.columnTypes[i]
+		switch {
+		case strings.Contains(declared, "JSON"):
+			dest[i] = []byte(s)
+		case declared == "" || strings.Contains(declared, "TIME") || strings.Contains(declared, "DATE"):
+			if t, ok := parseSQLiteTime(s); ok {
+				dest[i] = t
+			}
+		}
+	}
+	return nil
+}
+
+// parseSQLiteTime parses a time in one of sqliteTimeFormats
+func parseSQLiteTime(s string) (time.Time, bool) {
+	for _, layout := range sqliteTimeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedPrefix names the drivers that wrap PostgreSQL and SQLite with query spans
+const tracedPrefix = "traced-"
+
+var tracer = otel.Tracer("github.com/omniflare/campus-lostandfound/internal/database")
+
+// statementTable finds the table a statement reads or writes first
+var statementTable = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE|JOIN)\s+([a-z_][a-z0-9_]*)`)
+
+func init() {
+	for name, d := range map[string]driver.Driver{"postgres": &pq.Driver{}, sqliteDriverName: sqliteDriver{}} {
+		sql.Register(tracedPrefix+name, tracedDriver{d})
+		sqlx.BindDriver(tracedPrefix+name, sqlx.DOLLAR)
+	}
+}
+
+// statementName names a query's span after its operation and table, such as
+// "SELECT items" or "SELECT COUNT items", so that the span list shows which
+// query was slow without reading the SQL
+func statementName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	name := strings.ToUpper(fields[0])
+	if name == "SELECT" && len(fields) > 1 && strings.HasPrefix(strings.ToUpper(fields[1]), "COUNT(") {
+		name += " COUNT"
+	}
+	if m := statementTable.FindStringSubmatch(query); m != nil {
+		name += " " + strings.ToLower(m[1])
+	}
+	return name
+}
+
+// startQuery starts a span for a query when ctx belongs to a trace, such as a
+// request's, and leaves untraced work like background polling alone
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil
+	}
+	return tracer.Start(ctx, statementName(query),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", Driver),
+			attribute.String("db.statement", strings.Join(strings.Fields(query), " ")),
+		))
+}
+
+// endQuery ends a span from startQuery, recording err
+func endQuery(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedDriver opens connections whose queries are traced
+type tracedDriver struct {
+	driver.Driver
+}
+
+func (d tracedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn}, nil
+}
+
+// tracedConn creates a span for each query run with a traced context
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if conn, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = conn.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if conn, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return conn.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	conn, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuery(ctx, query)
+	result, err := conn.ExecContext(ctx, query, args)
+	endQuery(span, err)
+	return result, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	conn, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuery(ctx, query)
+	rows, err := conn.QueryContext(ctx, query, args)
+	if err != nil {
+		endQuery(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.Pinger); ok {
+		return conn.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.SessionResetter); ok {
+		return conn.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if conn, ok := c.Conn.(driver.Validator); ok {
+		return conn.IsValid()
+	}
+	return true
+}
+
+// tracedStmt is a prepared statement whose executions are traced
+type tracedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startQuery(ctx, s.query)
+	result, err := s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	endQuery(span, err)
+	return result, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startQuery(ctx, s.query)
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		endQuery(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+// tracedRows ends the query's span once its rows are read and closed, so the
+// span covers fetching them
+type tracedRows struct {
+	driver.Rows
+	span trace.Span
+	err  error
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	endQuery(r.span, errors.Join(r.err, err))
+	r.span = nil
+	return err
+}
@@ -0,0 +1,158 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/config"
+)
+
+// Message is a multipart email with a plain text and an HTML body
+type Message struct {
+	To             string
+	Subject        string
+	Text           string
+	HTML           string
+	UnsubscribeURL string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer sends messages through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send sends the message using PLAIN authentication when a username is set
+func (m SMTPMailer) Send(msg Message) error {
+	body, err := encode(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, body)
+}
+
+// LogMailer writes messages to a file, or to the log when Path is empty,
+// instead of sending them. It is meant for development and tests.
+type LogMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+// Send appends the encoded message to the sink
+func (m *LogMailer) Send(msg Message) error {
+	body, err := encode(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	if m.Path == "" {
+		slog.Info("Email", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(body, '\n'))
+	return err
+}
+
+// New returns the mailer selected by the mail driver setting
+func New() Mailer {
+	cfg := config.Get().Mail
+	switch cfg.Driver {
+	case "smtp":
+		return SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	default:
+		return &LogMailer{Path: cfg.LogFile, From: cfg.From}
+	}
+}
+
+// encode builds a multipart/alternative MIME message
+func encode(from string, msg Message) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	}
+	for _, p := range parts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %s\r\n", from)
+	fmt.Fprintf(&out, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&out, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", sanitizeHeader(msg.Subject)))
+	fmt.Fprintf(&out, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&out, "Message-ID: <%s@campus-lostandfound>\r\n", messageID())
+	if msg.UnsubscribeURL != "" {
+		fmt.Fprintf(&out, "List-Unsubscribe: <%s>\r\n", msg.UnsubscribeURL)
+		out.WriteString("List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	}
+	out.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&out, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	out.Write(body.Bytes())
+
+	return out.Bytes(), nil
+}
+
+// sanitizeHeader keeps user content from injecting extra headers
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// messageID returns a random identifier for the Message-ID header
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,195 @@
+package email
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/config"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+// Email frequencies a user can choose
+const (
+	FrequencyImmediate = "immediate"
+	FrequencyDaily     = "daily"
+	FrequencyOff       = "off"
+)
+
+// digestLookback limits how far back a first digest reaches
+const digestLookback = 7 * 24 * time.Hour
+
+// ValidFrequency reports whether the email frequency exists
+func ValidFrequency(frequency string) bool {
+	return frequency == FrequencyImmediate || frequency == FrequencyDaily || frequency == FrequencyOff
+}
+
+// recipient is a user's email address and delivery preference
+type recipient struct {
+	Username  string `db:"username"`
+	Email     string `db:"email"`
+	Frequency string `db:"email_frequency"`
+}
+
+// QueueNotification emails a notification straight away to users who chose
+// immediate delivery. Notifications for daily users are left for their digest.
+// q may be a transaction so that the email is only queued if it commits.
+func QueueNotification(q sqlx.Ext, notification models.Notification) error {
+	if !HasTemplate(notification.Type) {
+		return nil
+	}
+
+	var to recipient
+	err := sqlx.Get(q, &to, `
+		SELECT u.username, u.email, COALESCE(s.email_frequency, $2) AS email_frequency
+		FROM users u
+		LEFT JOIN user_settings s ON s.user_id = u.id
+		WHERE u.id = $1
+	`, notification.UserID, FrequencyImmediate)
+	if err != nil {
+		return err
+	}
+	if to.Frequency != FrequencyImmediate || to.Email == "" {
+		return nil
+	}
+
+	unsubscribe := UnsubscribeURL(notification.UserID)
+	text, html, err := Render(notification.Type, TemplateData{
+		Username:       to.Username,
+		Title:          notification.Title,
+		Body:           notification.Body,
+		Link:           notificationLink(notification),
+		UnsubscribeURL: unsubscribe,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = enqueue(q, &notification.UserID, Message{
+		To:             to.Email,
+		Subject:        notification.Title,
+		Text:           text,
+		HTML:           html,
+		UnsubscribeURL: unsubscribe,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec("UPDATE notifications SET emailed_at = $1 WHERE id = $2", time.Now(), notification.ID)
+	return err
+}
+
+// SendDigests queues a digest of un-emailed notifications for each daily user
+// whose last digest was at least a day ago
+func SendDigests() error {
+	now := time.Now()
+	var users []struct {
+		UserID       int          `db:"user_id"`
+		LastDigestAt sql.NullTime `db:"last_digest_at"`
+		recipient
+	}
+	err := database.DB.Select(&users, `
+		SELECT s.user_id, s.last_digest_at, u.username, u.email, s.email_frequency
+		FROM user_settings s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.email_frequency = $1 AND (s.last_digest_at IS NULL OR s.last_digest_at <= $2)
+	`, FrequencyDaily, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := sendDigest(user.UserID, user.recipient, now); err != nil {
+			slog.Error("Error sending digest", "user_id", user.UserID, "error", err)
+		}
+	}
+	return nil
+}
+
+// sendDigest queues one user's digest and marks its notifications as emailed
+func sendDigest(userID int, to recipient, now time.Time) error {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var entries []DigestEntry
+	err = tx.Select(&entries, `
+		SELECT title, COALESCE(body, '') AS body, created_at
+		FROM notifications
+		WHERE user_id = $1 AND emailed_at IS NULL AND created_at > $2
+		ORDER BY created_at
+	`, userID, now.Add(-digestLookback))
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 && to.Email != "" {
+		unsubscribe := UnsubscribeURL(userID)
+		text, html, err := Render("digest", TemplateData{
+			Username:       to.Username,
+			Link:           frontendURL() + "/dashboard",
+			UnsubscribeURL: unsubscribe,
+			Notifications:  entries,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = enqueue(tx, &userID, Message{
+			To:             to.Email,
+			Subject:        fmt.Sprintf("Your daily Lost & Found digest (%d updates)", len(entries)),
+			Text:           text,
+			HTML:           html,
+			UnsubscribeURL: unsubscribe,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE notifications SET emailed_at = $1 WHERE user_id = $2 AND emailed_at IS NULL AND created_at <= $1",
+			now, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Advance the digest time even when there was nothing to send
+	_, err = tx.Exec("UPDATE user_settings SET last_digest_at = $1 WHERE user_id = $2", now, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// notificationLink points at the page in the web app that a notification is about
+func notificationLink(notification models.Notification) string {
+	var data struct {
+		ItemID         int `json:"item_id"`
+		ConversationID int `json:"conversation_id"`
+	}
+	if notification.Data != nil {
+		json.Unmarshal(*notification.Data, &data)
+	}
+
+	switch {
+	case data.ConversationID != 0:
+		return frontendURL() + "/messages"
+	case data.ItemID != 0:
+		return fmt.Sprintf("%s/items/%d", frontendURL(), data.ItemID)
+	default:
+		return frontendURL() + "/dashboard"
+	}
+}
+
+// frontendURL is the address of the web app linked from emails
+func frontendURL() string {
+	return config.Get().FrontendURL
+}
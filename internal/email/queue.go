@@ -0,0 +1,189 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/tracing"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Queue tuning
+const (
+	MaxAttempts   = 8
+	BaseRetry     = time.Minute
+	MaxRetry      = 6 * time.Hour
+	pollInterval  = 15 * time.Second
+	batchSize     = 20
+	digestCheck   = time.Hour
+	maxErrorChars = 1000
+)
+
+// Enqueue stores a message to be sent by the worker
+func Enqueue(userID *int, msg Message) error {
+	return enqueue(database.DB, userID, msg)
+}
+
+// enqueue stores a message using q, which may be a transaction
+func enqueue(q sqlx.Execer, userID *int, msg Message) error {
+	_, err := q.Exec(`
+		INSERT INTO email_queue (user_id, to_address, subject, text_body, html_body, unsubscribe_url, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 'pending', $7, $7)
+	`, userID, msg.To, msg.Subject, msg.Text, msg.HTML, msg.UnsubscribeURL, time.Now())
+	return err
+}
+
+// RunWorker sends queued messages and daily digests until ctx is cancelled
+func RunWorker(ctx context.Context, mailer Mailer) {
+	poll := time.NewTicker(pollInterval)
+	digest := time.NewTicker(digestCheck)
+	defer poll.Stop()
+	defer digest.Stop()
+
+	for {
+		worker.Beat(ctx, pollInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			processQueue(mailer)
+		case <-digest.C:
+			start := time.Now()
+			if err := SendDigests(); err != nil {
+				slog.Error("Error sending email digests", "error", err)
+			}
+			metrics.ObserveJob("email-digests", start)
+		}
+	}
+}
+
+// processQueue sends up to one batch of due messages
+func processQueue(mailer Mailer) {
+	defer metrics.ObserveJob("email-queue", time.Now())
+	for i := 0; i < batchSize; i++ {
+		sent, err := deliverNext(mailer)
+		if err != nil {
+			slog.Error("Error processing email queue", "error", err)
+			return
+		}
+		if !sent {
+			return
+		}
+	}
+}
+
+// deliverNext claims the next due message, sends it and records the outcome.
+// It reports whether a message was found. Claiming counts the attempt and
+// schedules the retry in a transaction that commits before the message is
+// sent, so that several instances can share the queue without holding a lock
+// during delivery, and a message whose sender dies is retried.
+func deliverNext(mailer Mailer) (bool, error) {
+	queued, err := claimNext()
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, span := tracing.Start(context.Background(), "email send",
+		attribute.Int("email.id", queued.ID),
+		attribute.Int("email.attempt", queued.Attempts))
+	sendErr := mailer.Send(Message{
+		To:             queued.ToAddress,
+		Subject:        queued.Subject,
+		Text:           queued.TextBody,
+		HTML:           queued.HTMLBody,
+		UnsubscribeURL: queued.UnsubscribeURL.String,
+	})
+	tracing.End(span, sendErr)
+
+	// Record the outcome unless the claim has expired and the message was claimed again
+	switch {
+	case sendErr == nil:
+		_, err = database.DB.Exec("UPDATE email_queue SET status = 'sent', sent_at = $1, last_error = NULL WHERE id = $2 AND attempts = $3",
+			time.Now(), queued.ID, queued.Attempts)
+	case queued.Attempts >= MaxAttempts:
+		slog.Error("Giving up on email", "email_id", queued.ID, "attempts", queued.Attempts, "error", sendErr)
+		_, err = database.DB.Exec("UPDATE email_queue SET status = 'failed', last_error = $1 WHERE id = $2 AND attempts = $3",
+			truncateError(sendErr), queued.ID, queued.Attempts)
+	default:
+		_, err = database.DB.Exec("UPDATE email_queue SET last_error = $1 WHERE id = $2 AND attempts = $3",
+			truncateError(sendErr), queued.ID, queued.Attempts)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// queuedEmail is a claimed message. Attempts includes the current one.
+type queuedEmail struct {
+	ID             int            `db:"id"`
+	ToAddress      string         `db:"to_address"`
+	Subject        string         `db:"subject"`
+	TextBody       string         `db:"text_body"`
+	HTMLBody       string         `db:"html_body"`
+	UnsubscribeURL sql.NullString `db:"unsubscribe_url"`
+	Attempts       int            `db:"attempts"`
+}
+
+// claimNext locks the next due message, counts the attempt and moves its next
+// attempt to when it would be retried, then commits. It returns sql.ErrNoRows
+// when no message is due.
+func claimNext() (queuedEmail, error) {
+	var queued queuedEmail
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return queued, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	err = tx.Get(&queued, `
+		SELECT id, to_address, subject, text_body, html_body, unsubscribe_url, attempts
+		FROM email_queue
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, now)
+	if err != nil {
+		return queued, err
+	}
+
+	queued.Attempts++
+	_, err = tx.Exec("UPDATE email_queue SET attempts = $1, next_attempt_at = $2 WHERE id = $3",
+		queued.Attempts, now.Add(RetryDelay(queued.Attempts)), queued.ID)
+	if err != nil {
+		return queued, err
+	}
+	return queued, tx.Commit()
+}
+
+// RetryDelay doubles the wait after each failed attempt, up to MaxRetry
+func RetryDelay(attempts int) time.Duration {
+	delay := BaseRetry
+	for i := 1; i < attempts && delay < MaxRetry; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetry {
+		delay = MaxRetry
+	}
+	return delay
+}
+
+// truncateError keeps stored error messages to a reasonable size
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxErrorChars {
+		msg = msg[:maxErrorChars]
+	}
+	return msg
+}
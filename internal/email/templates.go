@@ -0,0 +1,52 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/email.html.tmpl"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/email.txt.tmpl"))
+)
+
+// TemplateData is the data available to the email templates
+type TemplateData struct {
+	Username       string
+	Title          string
+	Body           string
+	Link           string
+	UnsubscribeURL string
+	Notifications  []DigestEntry
+}
+
+// DigestEntry is a single notification listed in a digest email
+type DigestEntry struct {
+	Title     string
+	Body      string
+	CreatedAt time.Time
+}
+
+// Render executes the text and HTML templates with the given name, which is
+// a notification type or "digest"
+func Render(name string, data TemplateData) (text, html string, err error) {
+	var textBuf, htmlBuf bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&textBuf, name, data); err != nil {
+		return "", "", err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&htmlBuf, name, data); err != nil {
+		return "", "", err
+	}
+	return textBuf.String(), htmlBuf.String(), nil
+}
+
+// HasTemplate reports whether an email template exists for the name
+func HasTemplate(name string) bool {
+	return htmlTemplates.Lookup(name) != nil && textTemplates.Lookup(name) != nil
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/config"
+)
+
+// UnsubscribeTokenTTL is how long unsubscribe links stay valid after the email is sent
+const UnsubscribeTokenTTL = 90 * 24 * time.Hour
+
+// tokenVersion prefixes unsubscribe tokens and is signed with them, so that
+// the format can change without accepting tokens of an older one
+const tokenVersion = "v1"
+
+var (
+	// ErrInvalidToken is returned for unsubscribe tokens that were not signed by the server
+	ErrInvalidToken = errors.New("invalid unsubscribe token")
+	// ErrExpiredToken is returned for unsubscribe tokens older than UnsubscribeTokenTTL
+	ErrExpiredToken = errors.New("expired unsubscribe token")
+)
+
+// UnsubscribeToken returns a signed token identifying the user in unsubscribe
+// links. It records when it was issued and expires after UnsubscribeTokenTTL.
+func UnsubscribeToken(userID int) string {
+	return unsubscribeToken(userID, time.Now())
+}
+
+func unsubscribeToken(userID int, issued time.Time) string {
+	payload := strconv.Itoa(userID) + ":" + strconv.FormatInt(issued.Unix(), 10)
+	return tokenVersion + "." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(payload)
+}
+
+// ParseUnsubscribeToken verifies the token and returns the user ID it was created for
+func ParseUnsubscribeToken(token string) (int, error) {
+	return parseUnsubscribeToken(token, time.Now())
+}
+
+func parseUnsubscribeToken(token string, now time.Time) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenVersion {
+		return 0, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(string(payload)))) {
+		return 0, ErrInvalidToken
+	}
+
+	rawID, rawIssued, ok := strings.Cut(string(payload), ":")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	userID, err := strconv.Atoi(rawID)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	issued, err := strconv.ParseInt(rawIssued, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	if now.Sub(time.Unix(issued, 0)) > UnsubscribeTokenTTL {
+		return 0, ErrExpiredToken
+	}
+	return userID, nil
+}
+
+// UnsubscribeURL returns the link that turns off email notifications for the user
+func UnsubscribeURL(userID int) string {
+	return publicURL() + "/api/v1/unsubscribe?token=" + UnsubscribeToken(userID)
+}
+
+// sign returns the hex HMAC-SHA256 of the token payload
+func sign(payload string) string {
+	secret := config.Get().Auth.UnsubscribeSecret
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + tokenVersion + ":" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// publicURL is the address users reach the application at
+func publicURL() string {
+	return config.Get().PublicURL
+}
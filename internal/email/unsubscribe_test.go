@@ -0,0 +1,41 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	issued := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := unsubscribeToken(42, issued)
+	version, payload, _ := strings.Cut(token, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		want  error
+	}{
+		{"fresh", token, issued.Add(time.Hour), nil},
+		{"last valid moment", token, issued.Add(UnsubscribeTokenTTL), nil},
+		{"expired", token, issued.Add(UnsubscribeTokenTTL + time.Second), ErrExpiredToken},
+		{"empty", "", issued, ErrInvalidToken},
+		{"unknown version", "v0." + payload, issued, ErrInvalidToken},
+		{"missing version", payload, issued, ErrInvalidToken},
+		{"tampered signature", token + "0", issued, ErrInvalidToken},
+		{"other user", version + "." + strings.SplitN(unsubscribeToken(7, issued), ".", 3)[1] + "." + strings.SplitN(token, ".", 3)[2], issued, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := parseUnsubscribeToken(tt.token, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err == nil && userID != 42 {
+				t.Errorf("user ID = %d, want 42", userID)
+			}
+		})
+	}
+}
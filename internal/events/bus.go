@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database"
+)
+
+// Event types published on the bus
+const (
+	ItemCreated       = "item.created"
+	ItemUpdated       = "item.updated"
+	ItemStatusChanged = "item.status_changed"
+	ClaimApproved     = "claim.approved"
+	MessageCreated    = "message.created"
+	ReportCreated     = "report.created"
+	ReportResolved    = "report.resolved"
+)
+
+// notifyChannel is the PostgreSQL channel used to share events between API instances
+const notifyChannel = "app_events"
+
+// maxNotifyPayload keeps NOTIFY payloads under PostgreSQL's 8000 byte limit
+const maxNotifyPayload = 7900
+
+// Event is something that happened in the application
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	C     <-chan Event
+	ch    chan Event
+	types map[string]bool
+	once  sync.Once
+}
+
+var (
+	mu            sync.RWMutex
+	subscriptions = map[*Subscription]bool{}
+	listening     bool
+)
+
+// Subscribe returns a subscription to the given event types, or to every event
+// when no types are given. Events are dropped for subscribers that fall behind.
+func Subscribe(types ...string) *Subscription {
+	ch := make(chan Event, 64)
+	sub := &Subscription{C: ch, ch: ch, types: map[string]bool{}}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	mu.Lock()
+	subscriptions[sub] = true
+	mu.Unlock()
+
+	return sub
+}
+
+// Unsubscribe stops delivery to the subscription and closes its channel
+func Unsubscribe(sub *Subscription) {
+	mu.Lock()
+	delete(subscriptions, sub)
+	mu.Unlock()
+
+	sub.once.Do(func() { close(sub.ch) })
+}
+
+// Publish sends an event straight to the subscribers on every API instance.
+// Events describing committed changes should be written with Record instead
+// so that they are not lost if the process stops.
+func Publish(eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Error encoding event", "error", err)
+		return
+	}
+	publish(Event{ID: NewID(), Type: eventType, Time: time.Now(), Data: raw})
+}
+
+// publish broadcasts an event to the subscribers on every API instance
+func publish(event Event) {
+	mu.RLock()
+	viaDatabase := listening
+	mu.RUnlock()
+
+	// Without a listener only this instance's subscribers can be reached
+	if !viaDatabase {
+		deliver(event)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding event", "error", err)
+		return
+	}
+	if len(payload) > maxNotifyPayload {
+		slog.Warn("Event too large to share between instances, delivering locally", "event_type", event.Type)
+		deliver(event)
+		return
+	}
+
+	_, err = database.DB.Exec("SELECT pg_notify($1, $2)", notifyChannel, string(payload))
+	if err != nil {
+		slog.Error("Error publishing event", "error", err)
+		deliver(event)
+	}
+}
+
+// Listen receives events published by all API instances. It returns once the
+// listener is established and delivers events in the background until ctx is
+// cancelled.
+func Listen(ctx context.Context) error {
+	listener, err := database.NewListener()
+	if err != nil {
+		return err
+	}
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	mu.Lock()
+	listening = true
+	mu.Unlock()
+
+	go func() {
+		defer func() {
+			mu.Lock()
+			listening = false
+			mu.Unlock()
+			listener.Close()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				// A nil notification means the connection was re-established
+				if n == nil {
+					continue
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+					slog.Warn("Error decoding event", "error", err)
+					continue
+				}
+				deliver(event)
+			case <-time.After(90 * time.Second):
+				// Check the connection is still alive
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// deliver passes an event to this instance's subscribers
+func deliver(event Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for sub := range subscriptions {
+		if len(sub.types) > 0 && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			slog.Warn("Dropping event for slow subscriber", "event_type", event.Type)
+		}
+	}
+}
+
+// NewID returns a random event identifier
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,248 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+)
+
+// Outbox tuning
+const (
+	dispatchInterval = time.Second
+	dispatchBatch    = 50
+	outboxRetention  = 7 * 24 * time.Hour
+	maxOutboxErrors  = 1000
+	maxRetryDelay    = time.Hour
+	// maxAttempts is how often an event is handled before it is marked failed,
+	// about three hours after it was recorded
+	maxAttempts = 15
+)
+
+// Tx is the transaction an outbox event is handled in. Work that must not be
+// repeated, such as pushing to websockets, is deferred until it commits.
+type Tx struct {
+	*sqlx.Tx
+	afterCommit []func()
+}
+
+// AfterCommit runs fn once the handlers' transaction has committed
+func (tx *Tx) AfterCommit(fn func()) {
+	tx.afterCommit = append(tx.afterCommit, fn)
+}
+
+// Handler processes an outbox event inside the transaction that marks it published
+type Handler func(tx *Tx, event Event) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string][]Handler{}
+)
+
+// Handle registers a handler for the given event types. Handlers run exactly
+// once per event: their writes commit together with the event being marked
+// as published, and a failing handler rolls back and retries them all. After
+// maxAttempts failures the event is marked failed and no longer retried.
+func Handle(handler Handler, eventTypes ...string) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	for _, t := range eventTypes {
+		handlers[t] = append(handlers[t], handler)
+	}
+}
+
+// Record writes an event to the outbox as part of the caller's transaction,
+// so it is published if and only if the transaction commits
+func Record(tx *sqlx.Tx, eventType string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO outbox (event_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, NewID(), eventType, string(raw), time.Now())
+	return err
+}
+
+// RunDispatcher publishes outbox events until ctx is cancelled
+func RunDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		worker.Beat(ctx, dispatchInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dispatchPending(ctx)
+		}
+	}
+}
+
+// RunRetention deletes published events older than outboxRetention every
+// hour until ctx is cancelled. Failed events are kept until they are dealt with.
+func RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		worker.Beat(ctx, time.Hour)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			_, err := database.DB.ExecContext(ctx, "DELETE FROM outbox WHERE published_at < $1", start.Add(-outboxRetention))
+			if err != nil {
+				slog.Error("Error cleaning up outbox", "error", err)
+			}
+			metrics.ObserveJob("outbox-retention", start)
+		}
+	}
+}
+
+// dispatchPending publishes up to one batch of unpublished events in order
+func dispatchPending(ctx context.Context) {
+	defer metrics.ObserveJob("outbox-dispatch", time.Now())
+	for i := 0; i < dispatchBatch; i++ {
+		found, err := dispatchNext(ctx)
+		if err != nil {
+			slog.Error("Error dispatching outbox event", "error", err)
+			return
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// dispatchNext locks the oldest unpublished event so that only one instance
+// handles it, runs its handlers and marks it published in one transaction,
+// then broadcasts it on the bus. It reports whether an event was found.
+func dispatchNext(ctx context.Context) (bool, error) {
+	sqlTx, err := database.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer sqlTx.Rollback()
+
+	var row struct {
+		ID        int64     `db:"id"`
+		EventID   string    `db:"event_id"`
+		EventType string    `db:"event_type"`
+		Payload   string    `db:"payload"`
+		Attempts  int       `db:"attempts"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	err = sqlTx.GetContext(ctx, &row, `
+		SELECT id, event_id, event_type, payload, attempts, created_at
+		FROM outbox
+		WHERE published_at IS NULL AND failed_at IS NULL AND next_attempt_at <= $1
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, time.Now())
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	event := Event{ID: row.EventID, Type: row.EventType, Time: row.CreatedAt, Data: json.RawMessage(row.Payload)}
+
+	// Handlers share a savepoint so that a failure undoes all of their writes
+	if _, err := sqlTx.ExecContext(ctx, "SAVEPOINT handlers"); err != nil {
+		return false, err
+	}
+	tx := &Tx{Tx: sqlTx}
+	if handleErr := runHandlers(tx, event); handleErr != nil {
+		if _, err := sqlTx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT handlers"); err != nil {
+			return false, err
+		}
+		if err := recordFailure(ctx, sqlTx, row.ID, row.Attempts+1, handleErr); err != nil {
+			return false, err
+		}
+		slog.Error("Error handling event", "event_type", event.Type, "event_id", event.ID, "attempts", row.Attempts+1, "error", handleErr)
+		return true, sqlTx.Commit()
+	}
+
+	_, err = sqlTx.ExecContext(ctx, "UPDATE outbox SET published_at = $1, last_error = NULL WHERE id = $2", time.Now(), row.ID)
+	if err != nil {
+		return false, err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return false, err
+	}
+
+	for _, fn := range tx.afterCommit {
+		fn()
+	}
+	publish(event)
+	return true, nil
+}
+
+// recordFailure saves a failed attempt to handle an event. The event is
+// retried after retryDelay, or marked failed once it reaches maxAttempts.
+func recordFailure(ctx context.Context, tx *sqlx.Tx, id int64, attempts int, handleErr error) error {
+	msg := handleErr.Error()
+	if len(msg) > maxOutboxErrors {
+		msg = msg[:maxOutboxErrors]
+	}
+
+	now := time.Now()
+	var failedAt *time.Time
+	if attempts >= maxAttempts {
+		failedAt = &now
+		slog.ErrorContext(ctx, "Giving up on event", "outbox_id", id, "attempts", attempts, "error", handleErr)
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET attempts = $1, last_error = $2, next_attempt_at = $3, failed_at = $4
+		WHERE id = $5
+	`, attempts, msg, now.Add(retryDelay(attempts-1)), failedAt, id)
+	return err
+}
+
+// FailedCount returns how many events were given up on after maxAttempts
+func FailedCount(ctx context.Context) (int, error) {
+	var count int
+	err := database.DB.GetContext(ctx, &count, "SELECT COUNT(*) FROM outbox WHERE failed_at IS NOT NULL")
+	return count, err
+}
+
+// runHandlers calls every handler registered for the event's type
+func runHandlers(tx *Tx, event Event) error {
+	handlersMu.RLock()
+	registered := handlers[event.Type]
+	handlersMu.RUnlock()
+
+	for _, handler := range registered {
+		if err := handler(tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryDelay doubles the wait before retrying an event after each failed
+// attempt, starting at a second and capped at maxRetryDelay
+func retryDelay(attempts int) time.Duration {
+	delay := time.Second
+	for i := 0; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
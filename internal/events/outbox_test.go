@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+)
+
+func TestDispatchMarksEventFailedAfterMaxAttempts(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+
+	const eventType = "test.failing"
+	calls := 0
+	Handle(func(tx *Tx, event Event) error {
+		calls++
+		return errors.New("handler failed")
+	}, eventType)
+	t.Cleanup(func() {
+		handlersMu.Lock()
+		delete(handlers, eventType)
+		handlersMu.Unlock()
+	})
+
+	tx := db.MustBegin()
+	if err := Record(tx, eventType, map[string]int{"id": 1}); err != nil {
+		t.Fatalf("recording event: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		// Skip the retry delay
+		db.MustExec("UPDATE outbox SET next_attempt_at = $1", time.Now().Add(-time.Second))
+		found, err := dispatchNext(ctx)
+		if err != nil || !found {
+			t.Fatalf("attempt %d: found %v, error %v", attempt, found, err)
+		}
+		if failed, err := FailedCount(ctx); err != nil || (failed == 1) != (attempt == maxAttempts) {
+			t.Fatalf("after attempt %d: %d failed events, error %v", attempt, failed, err)
+		}
+	}
+
+	// Failed events are no longer dispatched
+	db.MustExec("UPDATE outbox SET next_attempt_at = $1", time.Now().Add(-time.Second))
+	if found, err := dispatchNext(ctx); err != nil || found {
+		t.Errorf("dispatched a failed event: found %v, error %v", found, err)
+	}
+	if calls != maxAttempts {
+		t.Errorf("handler called %d times, want %d", calls, maxAttempts)
+	}
+
+	var row struct {
+		Attempts  int     `db:"attempts"`
+		LastError *string `db:"last_error"`
+	}
+	if err := db.Get(&row, "SELECT attempts, last_error FROM outbox"); err != nil {
+		t.Fatal(err)
+	}
+	if row.Attempts != maxAttempts || row.LastError == nil || *row.LastError != "handler failed" {
+		t.Errorf("got %d attempts with error %v", row.Attempts, row.LastError)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{11, 2048 * time.Second},
+		{12, maxRetryDelay},
+		{100, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
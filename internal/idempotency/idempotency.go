@@ -0,0 +1,81 @@
+// Package idempotency keeps the first response to a request sent with an
+// Idempotency-Key header so that retries of the request can be answered with
+// it instead of being processed again.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Retention is how long a response is kept for retries
+const Retention = 24 * time.Hour
+
+// abandonAfter is how long a key stays claimed by a request that never
+// completed, e.g. because the instance serving it stopped
+const abandonAfter = 5 * time.Minute
+
+// Record is what is kept for a key
+type Record struct {
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"` // 0 while the first request is in progress
+	ContentType string    `db:"content_type"`
+	Body        string    `db:"body"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// InProgress reports whether the first request with the key is still running
+func (r *Record) InProgress() bool {
+	return r.StatusCode == 0
+}
+
+// Store keeps records by user and key
+type Store interface {
+	// Begin claims key for a request with the given hash and returns nil, or
+	// returns the record of the request that claimed it first
+	Begin(ctx context.Context, userID int, key, hash string) (*Record, error)
+	// Complete saves the response to the request that claimed key
+	Complete(ctx context.Context, userID int, key string, status int, contentType, body string) error
+	// Release forgets key so that the request can be retried
+	Release(ctx context.Context, userID int, key string) error
+}
+
+// store is the Store used by the middleware, set with Use
+var store Store = NewMemory()
+
+// Use sets the store the records are kept in
+func Use(s Store) {
+	store = s
+}
+
+// Begin claims key in the store set with Use
+func Begin(ctx context.Context, userID int, key, hash string) (*Record, error) {
+	return store.Begin(ctx, userID, key, hash)
+}
+
+// Complete saves a response in the store set with Use
+func Complete(ctx context.Context, userID int, key string, status int, contentType, body string) error {
+	return store.Complete(ctx, userID, key, status, contentType, body)
+}
+
+// Release forgets key in the store set with Use
+func Release(ctx context.Context, userID int, key string) error {
+	return store.Release(ctx, userID, key)
+}
+
+// Hash identifies a request by its method, path and body, so that a key
+// reused for a different request can be told apart from a retry
+func Hash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// expired reports whether a record no longer holds its key at now
+func expired(r *Record, now time.Time) bool {
+	age := now.Sub(r.CreatedAt)
+	return age >= Retention || (r.InProgress() && age >= abandonAfter)
+}
@@ -0,0 +1,189 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+)
+
+// The users records are kept for; the database store needs them to exist
+const (
+	alice = 1
+	bob   = 2
+)
+
+// testStore is a store under test with a way to make its records older
+type testStore struct {
+	Store
+	// age moves the creation of alice's record for key back by d
+	age func(t *testing.T, key string, d time.Duration)
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, store testStore)) {
+	t.Run("memory", func(t *testing.T) {
+		m := NewMemory()
+		test(t, testStore{m, func(t *testing.T, key string, d time.Duration) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.records[recordKey{alice, key}].CreatedAt = time.Now().Add(-d)
+		}})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db := databasetest.Open(t)
+		db.MustExec(`
+			INSERT INTO users (id, username, email, password_hash)
+			VALUES (1, 'alice', 'alice@example.edu', 'unused'), (2, 'bob', 'bob@example.edu', 'unused')
+		`)
+		test(t, testStore{NewPostgres(db), func(t *testing.T, key string, d time.Duration) {
+			db.MustExec("UPDATE idempotency_keys SET created_at = $1 WHERE user_id = $2 AND key = $3", time.Now().Add(-d), alice, key)
+		}})
+	})
+}
+
+// begin claims key for alice and fails the test on errors
+func begin(t *testing.T, store Store, key, hash string) *Record {
+	t.Helper()
+	record, err := store.Begin(context.Background(), alice, key, hash)
+	if err != nil {
+		t.Fatalf("Begin(%q): %v", key, err)
+	}
+	return record
+}
+
+func TestReplay(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		ctx := context.Background()
+		hash := Hash("POST", "/items/lost", []byte(`{"title":"Umbrella"}`))
+
+		if record := begin(t, store, "key-1", hash); record != nil {
+			t.Fatalf("new key already claimed: %+v", record)
+		}
+
+		// A retry while the first request runs sees it in progress
+		if record := begin(t, store, "key-1", hash); record == nil || !record.InProgress() {
+			t.Fatalf("retry during the first request got %+v, want a record in progress", record)
+		}
+
+		if err := store.Complete(ctx, alice, "key-1", 201, "application/json", `{"item_id":1}`); err != nil {
+			t.Fatal(err)
+		}
+		record := begin(t, store, "key-1", hash)
+		if record == nil || record.InProgress() {
+			t.Fatalf("retry got %+v, want the completed response", record)
+		}
+		if record.RequestHash != hash || record.StatusCode != 201 || record.ContentType != "application/json" || record.Body != `{"item_id":1}` {
+			t.Errorf("replayed %+v", record)
+		}
+
+		// Keys belong to a user
+		if record, err := store.Begin(ctx, bob, "key-1", hash); err != nil || record != nil {
+			t.Errorf("another user's key: %+v, error %v", record, err)
+		}
+	})
+}
+
+func TestDifferentRequest(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		first := Hash("POST", "/items/lost", []byte(`{"title":"Umbrella"}`))
+		second := Hash("POST", "/items/lost", []byte(`{"title":"Wallet"}`))
+		if first == second {
+			t.Fatal("different bodies have the same hash")
+		}
+
+		begin(t, store, "key-1", first)
+		if err := store.Complete(context.Background(), alice, "key-1", 201, "application/json", "{}"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The first request's hash is returned, so the middleware can reject the second
+		record := begin(t, store, "key-1", second)
+		if record == nil || record.RequestHash != first {
+			t.Errorf("reused key got %+v, want the first request's record", record)
+		}
+	})
+}
+
+func TestConcurrentBegin(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		const requests = 10
+		hash := Hash("POST", "/messages", []byte("{}"))
+
+		var wg sync.WaitGroup
+		claimed := make(chan bool, requests)
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				record, err := store.Begin(context.Background(), alice, "key-1", hash)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if record != nil && !record.InProgress() {
+					t.Errorf("got a completed record %+v", record)
+				}
+				claimed <- record == nil
+			}()
+		}
+		wg.Wait()
+		close(claimed)
+
+		winners := 0
+		for won := range claimed {
+			if won {
+				winners++
+			}
+		}
+		if winners != 1 {
+			t.Errorf("%d of %d concurrent requests claimed the key, want 1", winners, requests)
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		ctx := context.Background()
+		hash := Hash("POST", "/reports", []byte("{}"))
+
+		// Completed responses are kept for Retention
+		begin(t, store, "completed", hash)
+		if err := store.Complete(ctx, alice, "completed", 201, "application/json", "{}"); err != nil {
+			t.Fatal(err)
+		}
+		store.age(t, "completed", Retention-time.Minute)
+		if record := begin(t, store, "completed", hash); record == nil {
+			t.Fatal("response expired before Retention")
+		}
+		store.age(t, "completed", Retention)
+		if record := begin(t, store, "completed", hash); record != nil {
+			t.Errorf("response older than Retention was replayed: %+v", record)
+		}
+
+		// Requests that never completed free their key after abandonAfter
+		begin(t, store, "abandoned", hash)
+		store.age(t, "abandoned", abandonAfter-time.Minute)
+		if record := begin(t, store, "abandoned", hash); record == nil || !record.InProgress() {
+			t.Fatalf("running request lost its key: %+v", record)
+		}
+		store.age(t, "abandoned", abandonAfter)
+		if record := begin(t, store, "abandoned", hash); record != nil {
+			t.Errorf("abandoned request still holds its key: %+v", record)
+		}
+	})
+}
+
+func TestRelease(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store testStore) {
+		hash := Hash("POST", "/messages", []byte("{}"))
+		begin(t, store, "key-1", hash)
+		if err := store.Release(context.Background(), alice, "key-1"); err != nil {
+			t.Fatal(err)
+		}
+		if record := begin(t, store, "key-1", hash); record != nil {
+			t.Errorf("released key is still claimed: %+v", record)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneEvery is how often the memory store forgets expired records
+const pruneEvery = time.Minute
+
+// Memory keeps records in this process, for tests and handlers run without a database
+type Memory struct {
+	mu      sync.Mutex
+	records map[recordKey]*Record
+	pruned  time.Time
+}
+
+type recordKey struct {
+	userID int
+	key    string
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{records: map[recordKey]*Record{}, pruned: time.Now()}
+}
+
+// Begin implements Store
+func (m *Memory) Begin(ctx context.Context, userID int, key, hash string) (*Record, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.pruned) >= pruneEvery {
+		for k, r := range m.records {
+			if expired(r, now) {
+				delete(m.records, k)
+			}
+		}
+		m.pruned = now
+	}
+
+	k := recordKey{userID, key}
+	if r, ok := m.records[k]; ok && !expired(r, now) {
+		existing := *r
+		return &existing, nil
+	}
+	m.records[k] = &Record{RequestHash: hash, CreatedAt: now}
+	return nil, nil
+}
+
+// Complete implements Store
+func (m *Memory) Complete(ctx context.Context, userID int, key string, status int, contentType, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.records[recordKey{userID, key}]; ok {
+		r.StatusCode, r.ContentType, r.Body = status, contentType, body
+	}
+	return nil
+}
+
+// Release implements Store
+func (m *Memory) Release(ctx context.Context, userID int, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, recordKey{userID, key})
+	return nil
+}
@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+)
+
+// Postgres keeps records in the idempotency_keys table so that a retry is
+// recognized by every API instance. It works with the embedded SQLite driver
+// as well.
+type Postgres struct {
+	db *sqlx.DB
+}
+
+// NewPostgres returns a store backed by the database
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db}
+}
+
+// Begin implements Store. The primary key on (user_id, key) lets only one of
+// several concurrent requests claim a key.
+func (p *Postgres) Begin(ctx context.Context, userID int, key, hash string) (*Record, error) {
+	now := time.Now()
+
+	// Free the key if its record has expired or its request was abandoned
+	_, err := p.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND (created_at < $3 OR (status_code = 0 AND created_at < $4))
+	`, userID, key, now.Add(-Retention), now.Add(-abandonAfter))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := p.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`, userID, key, hash, now)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 1 {
+		return nil, nil
+	}
+
+	var existing Record
+	err = p.db.GetContext(ctx, &existing, `
+		SELECT request_hash, status_code, content_type, body, created_at
+		FROM idempotency_keys WHERE user_id = $1 AND key = $2
+	`, userID, key)
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// Complete implements Store
+func (p *Postgres) Complete(ctx context.Context, userID int, key string, status int, contentType, body string) error {
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status_code = $3, content_type = $4, body = $5
+		WHERE user_id = $1 AND key = $2
+	`, userID, key, status, contentType, body)
+	return err
+}
+
+// Release implements Store
+func (p *Postgres) Release(ctx context.Context, userID int, key string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2", userID, key)
+	return err
+}
+
+// RunCleanup deletes records older than Retention every hour until ctx is cancelled
+func (p *Postgres) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		worker.Beat(ctx, time.Hour)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			_, err := p.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", start.Add(-Retention))
+			if err != nil {
+				slog.Error("Error cleaning up idempotency keys", "error", err)
+			}
+			metrics.ObserveJob("idempotency-cleanup", start)
+		}
+	}
+}
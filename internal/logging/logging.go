@@ -0,0 +1,64 @@
+// Package logging configures structured JSON logging with log/slog and keeps
+// a logger per request that carries its request ID and user.
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/config"
+)
+
+// loggerKey is the fiber local holding the request's logger
+const loggerKey = "logger"
+
+// Setup makes a JSON or text handler at the configured level the default
+// logger. The standard log package then writes through it as well.
+func Setup(cfg config.Logging) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToLower(name))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// Ctx returns the request's logger, which includes its request ID and, once
+// authenticated, the user ID
+func Ctx(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With adds attributes to every later log line of the request
+func With(c *fiber.Ctx, args ...any) {
+	c.Locals(loggerKey, Ctx(c).With(args...))
+}
+
+// Fatal logs an error and exits, for failures during startup
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
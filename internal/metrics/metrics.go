@@ -0,0 +1,190 @@
+// Package metrics exposes Prometheus metrics for HTTP traffic, the database
+// pool, uploads, background jobs and the state of the board.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every application metric
+const namespace = "lostandfound"
+
+// boardQueryTimeout bounds the queries run for the board gauges on each scrape
+const boardQueryTimeout = 2 * time.Second
+
+var (
+	// Registry holds the application's metrics along with the Go runtime and process collectors
+	Registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	uploadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of uploaded files saved, by kind.",
+	}, []string{"kind"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of background job runs by job name.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"job"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		uploadBytes,
+		jobDuration,
+		boardCollector{},
+	)
+}
+
+// RegisterDB exports the connection pool statistics of database.DB, such as
+// open, idle and in-use connections and time spent waiting for one
+func RegisterDB() {
+	Registry.MustRegister(collectors.NewDBStatsCollector(database.DB.DB, database.Driver))
+}
+
+// Middleware counts requests and records their latency by route template, so
+// that /items/1 and /items/2 share the series for /api/v1/items/:id. It must
+// run after AccessLog, which writes error responses, so the status is final.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				status = fiberErr.Code
+			}
+		}
+
+		// Requests that matched no route would otherwise report the middleware's path
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && route == "/" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(c.Method(), route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format. When token is not
+// empty, requests must send it as a bearer token.
+func Handler(token string) fiber.Handler {
+	serve := adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	return func(c *fiber.Ctx) error {
+		if token != "" && !HasToken(c, token) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Missing or invalid metrics token",
+			})
+		}
+		return serve(c)
+	}
+}
+
+// HasToken reports whether the request sends token as its bearer token
+func HasToken(c *fiber.Ctx, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(c.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// AddUploadBytes counts the size of a saved upload of the given kind, such as "image"
+func AddUploadBytes(kind string, size int64) {
+	uploadBytes.WithLabelValues(kind).Add(float64(size))
+}
+
+// ObserveJob records a run of a background job that began at start, e.g.
+// defer metrics.ObserveJob("email-queue", time.Now())
+func ObserveJob(job string, start time.Time) {
+	jobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+}
+
+// boardCollector reports the open items, pending claims, pending reports and
+// failed outbox events by querying the database on each scrape
+type boardCollector struct{}
+
+var (
+	openItemsDesc = prometheus.NewDesc(namespace+"_open_items",
+		"Items not yet claimed or returned, by status (lost or found).", []string{"status"}, nil)
+	pendingClaimsDesc = prometheus.NewDesc(namespace+"_pending_claims",
+		"Items claimed but not yet returned to their owner.", nil, nil)
+	pendingReportsDesc = prometheus.NewDesc(namespace+"_pending_reports",
+		"Reports waiting for an admin.", nil, nil)
+	failedEventsDesc = prometheus.NewDesc(namespace+"_outbox_failed_events",
+		"Outbox events given up on after their handlers failed too often.", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (boardCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openItemsDesc
+	ch <- pendingClaimsDesc
+	ch <- pendingReportsDesc
+	ch <- failedEventsDesc
+}
+
+// Collect implements prometheus.Collector. The gauges are left out of the
+// scrape when the database cannot be queried.
+func (boardCollector) Collect(ch chan<- prometheus.Metric) {
+	if database.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), boardQueryTimeout)
+	defer cancel()
+
+	var counts struct {
+		Lost    int `db:"lost"`
+		Found   int `db:"found"`
+		Claimed int `db:"claimed"`
+		Reports int `db:"reports"`
+		Failed  int `db:"failed"`
+	}
+	err := database.DB.GetContext(ctx, &counts, `
+		SELECT
+			(SELECT COUNT(*) FROM items WHERE status = 'lost') AS lost,
+			(SELECT COUNT(*) FROM items WHERE status = 'found') AS found,
+			(SELECT COUNT(*) FROM items WHERE status = 'claimed') AS claimed,
+			(SELECT COUNT(*) FROM reports WHERE status = 'pending') AS reports,
+			(SELECT COUNT(*) FROM outbox WHERE failed_at IS NOT NULL) AS failed
+	`)
+	if err != nil {
+		slog.Error("Error counting items for metrics", "error", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(openItemsDesc, prometheus.GaugeValue, float64(counts.Lost), "lost")
+	ch <- prometheus.MustNewConstMetric(openItemsDesc, prometheus.GaugeValue, float64(counts.Found), "found")
+	ch <- prometheus.MustNewConstMetric(pendingClaimsDesc, prometheus.GaugeValue, float64(counts.Claimed))
+	ch <- prometheus.MustNewConstMetric(pendingReportsDesc, prometheus.GaugeValue, float64(counts.Reports))
+	ch <- prometheus.MustNewConstMetric(failedEventsDesc, prometheus.GaugeValue, float64(counts.Failed))
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+)
+
+// AccessLog middleware logs one line per request with its route, status and
+// latency, and adds the request ID to JSON error responses. It must run after
+// RequestID so that the line carries the request ID, and the user ID once Auth
+// has run.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// Let the error handler write the response first so the status is final
+		if err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusBadRequest {
+			addRequestIDToError(c)
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"ip", c.IP(),
+		}
+		// Reading a streamed body, such as a file or event stream, would consume it
+		if !c.Response().IsBodyStream() {
+			attrs = append(attrs, "bytes", len(c.Response().Body()))
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err.Error())
+		}
+		logging.Ctx(c).Log(c.UserContext(), level, "request", attrs...)
+		return nil
+	}
+}
+
+// addRequestIDToError adds a request_id field to {"error": ...} responses so
+// that users can quote it when reporting a problem
+func addRequestIDToError(c *fiber.Ctx) {
+	id := GetRequestID(c)
+	if id == "" || c.Response().IsBodyStream() || !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+		return
+	}
+	if _, ok := body["error"]; !ok {
+		return
+	}
+	if _, ok := body["request_id"]; ok {
+		return
+	}
+
+	body["request_id"], _ = json.Marshal(id)
+	if encoded, err := json.Marshal(body); err == nil {
+		c.Response().SetBodyRaw(encoded)
+	}
+}
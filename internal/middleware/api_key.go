@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+	"github.com/omniflare/campus-lostandfound/internal/utils/apikey"
+)
+
+// lastUsedResolution limits how often last_used_at is written for busy keys
+const lastUsedResolution = time.Minute
+
+// apiKeys looks up the keys sent in X-API-Key headers
+var apiKeys repository.APIKeyRepository
+
+// UseAPIKeys sets the repository API keys are authenticated against
+func UseAPIKeys(repo repository.APIKeyRepository) {
+	apiKeys = repo
+}
+
+// authenticateAPIKey validates an X-API-Key header and stores the key owner in context
+func authenticateAPIKey(c *fiber.Ctx, key string) error {
+	prefix, ok := apikey.Prefix(key)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid API key",
+		})
+	}
+
+	// Look up the key and its owner
+	record, err := apiKeys.GetByPrefix(c.UserContext(), prefix)
+	if err != nil || !apikey.Matches(key, record.KeyHash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid API key",
+		})
+	}
+
+	now := time.Now()
+	if record.RevokedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: API key has been revoked",
+		})
+	}
+	if record.ExpiresAt != nil && record.ExpiresAt.Before(now) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: API key has expired",
+		})
+	}
+
+	// Record usage without writing on every request
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > lastUsedResolution {
+		if err := apiKeys.Touch(c.UserContext(), record.ID, now); err != nil {
+			logging.Ctx(c).Error("Error updating API key last used time", "error", err)
+		}
+	}
+
+	// Store user information in context for later use
+	c.Locals("user_id", record.UserID)
+	c.Locals("username", record.Username)
+	c.Locals("role", record.Role)
+	c.Locals("api_key_id", record.ID)
+	c.Locals("api_key_scopes", []string(record.Permissions))
+	logging.With(c, "user_id", record.UserID, "api_key_id", record.ID)
+
+	// Continue to the next middleware/handler
+	return c.Next()
+}
@@ -4,11 +4,19 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
 	"github.com/omniflare/campus-lostandfound/internal/utils/jwt"
 )
 
+// Auth middleware authenticates requests with a JWT bearer token or an X-API-Key header
 func Auth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		// API keys take precedence so kiosks never need a JWT
+		if key := c.Get("X-API-Key"); key != "" {
+			return authenticateAPIKey(c, key)
+		}
+
 		authHeader := c.Get("Authorization")
 
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -31,50 +39,40 @@ func Auth() fiber.Handler {
 		c.Locals("user_id", claims.UserID)
 		c.Locals("username", claims.Username)
 		c.Locals("role", claims.Role)
+		logging.With(c, "user_id", claims.UserID)
 
 		// Continue to the next middleware/handler
 		return c.Next()
 	}
 }
 
-// AdminOnly middleware to restrict endpoints to admin users only
-func AdminOnly() fiber.Handler {
+// StreamAuth works like Auth but also accepts the JWT as a ?token= query
+// parameter, since browsers cannot set headers on EventSource requests
+func StreamAuth() fiber.Handler {
+	auth := Auth()
 	return func(c *fiber.Ctx) error {
-		// First check if the user is authenticated
-		role := c.Locals("role")
-		if role == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized: Authentication required",
-			})
-		}
-
-		// Check if the user has admin role
-		if role != "admin" {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Forbidden: Admin access required",
-			})
+		if token := c.Query("token"); token != "" && c.Get("Authorization") == "" && c.Get("X-API-Key") == "" {
+			c.Request().Header.Set("Authorization", "Bearer "+token)
 		}
-
-		// Continue to the next middleware/handler
-		return c.Next()
+		return auth(c)
 	}
 }
 
-// GuardAndAdmin middleware to restrict endpoints to guard and admin users
-func GuardAndAdmin() fiber.Handler {
+// Require middleware restricts endpoints to users whose role grants the permission.
+// Requests authenticated with an API key also need the permission in the key's scope.
+func Require(permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// First check if the user is authenticated
-		role := c.Locals("role")
-		if role == nil {
+		if _, ok := c.Locals("role").(string); !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Unauthorized: Authentication required",
 			})
 		}
 
-		// Check if the user has guard or admin role
-		if role != "guard" && role != "admin" {
+		// Check if the role and API key scope grant the permission
+		if !HasPermission(c, permission) {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Forbidden: Guard or admin access required",
+				"error": "Forbidden: Missing permission " + permission,
 			})
 		}
 
@@ -82,3 +80,23 @@ func GuardAndAdmin() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// HasPermission reports whether the authenticated request may use the permission
+func HasPermission(c *fiber.Ctx, permission string) bool {
+	role, ok := c.Locals("role").(string)
+	if !ok || !permissions.Has(c.UserContext(), role, permission) {
+		return false
+	}
+
+	// Restrict API key requests to the key's scope
+	if scopes, ok := c.Locals("api_key_scopes").([]string); ok {
+		for _, scope := range scopes {
+			if scope == permission {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
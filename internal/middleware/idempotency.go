@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/idempotency"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+)
+
+const (
+	// HeaderIdempotencyKey is the request header holding the client's key
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed for a retry
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKey is the longest key accepted, the size of its column
+const maxIdempotencyKey = 255
+
+// Idempotency middleware answers retries of a request sent with an
+// Idempotency-Key header with the response to the first request, keyed by
+// user, for idempotency.Retention. It must run after Auth. A key reused for a
+// different request is rejected with 422, and one whose first request is
+// still running with 409. Server errors and throttled requests are not kept,
+// so they can be retried.
+func Idempotency() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		userID, ok := c.Locals("user_id").(int)
+		if key == "" || !ok {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKey {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Idempotency-Key must be at most 255 characters",
+			})
+		}
+
+		ctx := c.UserContext()
+		hash := idempotency.Hash(c.Method(), c.Path(), c.Body())
+		existing, err := idempotency.Begin(ctx, userID, key, hash)
+		if err != nil {
+			// Process the request rather than fail it because the store is unavailable
+			logging.Ctx(c).Error("Error checking idempotency key", "error", err)
+			return c.Next()
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != hash:
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+					"error": "Idempotency-Key was already used for a different request",
+				})
+			case existing.InProgress():
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "A request with this Idempotency-Key is still being processed",
+				})
+			}
+			c.Set(HeaderIdempotentReplayed, "true")
+			c.Set(fiber.HeaderContentType, existing.ContentType)
+			return c.Status(existing.StatusCode).SendString(existing.Body)
+		}
+
+		err = c.Next()
+		status := c.Response().StatusCode()
+		if err != nil || status >= fiber.StatusInternalServerError || status == fiber.StatusTooManyRequests {
+			if err := idempotency.Release(ctx, userID, key); err != nil {
+				logging.Ctx(c).Error("Error releasing idempotency key", "error", err)
+			}
+			return err
+		}
+
+		contentType := string(c.Response().Header.ContentType())
+		if err := idempotency.Complete(ctx, userID, key, status, contentType, string(c.Response().Body())); err != nil {
+			logging.Ctx(c).Error("Error saving idempotent response", "error", err)
+		}
+		return nil
+	}
+}
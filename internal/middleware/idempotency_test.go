@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+	"github.com/omniflare/campus-lostandfound/internal/idempotency"
+)
+
+// forEachIdempotencyStore runs a test with each store in use. Requests are
+// made as user 1, which the database store needs to exist.
+func forEachIdempotencyStore(t *testing.T, test func(t *testing.T)) {
+	for _, backend := range []struct {
+		name string
+		open func(t *testing.T) idempotency.Store
+	}{
+		{"memory", func(t *testing.T) idempotency.Store { return idempotency.NewMemory() }},
+		{"sqlite", func(t *testing.T) idempotency.Store {
+			db := databasetest.Open(t)
+			db.MustExec("INSERT INTO users (id, username, email, password_hash) VALUES (1, 'alice', 'alice@example.edu', 'unused')")
+			return idempotency.NewPostgres(db)
+		}},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			idempotency.Use(backend.open(t))
+			t.Cleanup(func() { idempotency.Use(idempotency.NewMemory()) })
+			test(t)
+		})
+	}
+}
+
+// idempotentApp serves POST /items with the middleware as user 1. The handler
+// responds with the status in the body and how often it has been called.
+func idempotentApp(calls *atomic.Int32, handler fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", 1)
+		return c.Next()
+	})
+	if handler == nil {
+		handler = func(c *fiber.Ctx) error {
+			n := calls.Add(1)
+			status, _ := strconv.Atoi(string(c.Body()))
+			return c.Status(status).JSON(fiber.Map{"call": n})
+		}
+	}
+	app.Post("/items", Idempotency(), handler)
+	return app
+}
+
+// post sends body to /items with an Idempotency-Key and returns the response
+func post(t *testing.T, app *fiber.App, key, body string) (*http.Response, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(raw)
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	forEachIdempotencyStore(t, func(t *testing.T) {
+		var calls atomic.Int32
+		app := idempotentApp(&calls, nil)
+
+		first, firstBody := post(t, app, "key-1", "201")
+		retry, retryBody := post(t, app, "key-1", "201")
+		if first.StatusCode != http.StatusCreated || retry.StatusCode != http.StatusCreated {
+			t.Fatalf("statuses %d and %d, want %d", first.StatusCode, retry.StatusCode, http.StatusCreated)
+		}
+		if retryBody != firstBody || calls.Load() != 1 {
+			t.Errorf("retry got %q after %d calls, want %q after 1", retryBody, calls.Load(), firstBody)
+		}
+		if retry.Header.Get(HeaderIdempotentReplayed) != "true" || first.Header.Get(HeaderIdempotentReplayed) != "" {
+			t.Error("only the replayed response should be marked")
+		}
+		if got := retry.Header.Get(fiber.HeaderContentType); got != fiber.MIMEApplicationJSON {
+			t.Errorf("replayed content type %q", got)
+		}
+
+		// Requests without a key are always processed
+		post(t, app, "", "201")
+		post(t, app, "", "201")
+		if calls.Load() != 3 {
+			t.Errorf("handler called %d times, want 3", calls.Load())
+		}
+	})
+}
+
+func TestIdempotencyRejectsDifferentRequest(t *testing.T) {
+	forEachIdempotencyStore(t, func(t *testing.T) {
+		var calls atomic.Int32
+		app := idempotentApp(&calls, nil)
+
+		post(t, app, "key-1", "201")
+		if resp, _ := post(t, app, "key-1", "200"); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("reused key with another body: status %d, want %d", resp.StatusCode, http.StatusUnprocessableEntity)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("handler called %d times, want 1", calls.Load())
+		}
+	})
+}
+
+func TestIdempotencyConflictWhileInFlight(t *testing.T) {
+	forEachIdempotencyStore(t, func(t *testing.T) {
+		started, finish := make(chan struct{}), make(chan struct{})
+		app := idempotentApp(nil, func(c *fiber.Ctx) error {
+			close(started)
+			<-finish
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{"ok": true})
+		})
+
+		done := make(chan int)
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("{}"))
+			req.Header.Set(HeaderIdempotencyKey, "key-1")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				done <- 0
+				return
+			}
+			resp.Body.Close()
+			done <- resp.StatusCode
+		}()
+		select {
+		case <-started:
+		case status := <-done:
+			t.Fatalf("first request finished with status %d before the handler ran", status)
+		}
+
+		if resp, _ := post(t, app, "key-1", "{}"); resp.StatusCode != http.StatusConflict {
+			t.Errorf("retry while in flight: status %d, want %d", resp.StatusCode, http.StatusConflict)
+		}
+		close(finish)
+		if status := <-done; status != http.StatusCreated {
+			t.Errorf("first request: status %d, want %d", status, http.StatusCreated)
+		}
+		if resp, _ := post(t, app, "key-1", "{}"); resp.StatusCode != http.StatusCreated || resp.Header.Get(HeaderIdempotentReplayed) != "true" {
+			t.Errorf("retry after completion: status %d, replayed %q", resp.StatusCode, resp.Header.Get(HeaderIdempotentReplayed))
+		}
+	})
+}
+
+func TestIdempotencyDoesNotKeepRetryableErrors(t *testing.T) {
+	forEachIdempotencyStore(t, func(t *testing.T) {
+		var calls atomic.Int32
+		app := idempotentApp(&calls, nil)
+
+		for _, status := range []string{"500", "429", "201"} {
+			resp, _ := post(t, app, "key-1", status)
+			if resp.Header.Get(HeaderIdempotentReplayed) != "" {
+				t.Errorf("response %s replayed an earlier one", status)
+			}
+		}
+		if calls.Load() != 3 {
+			t.Errorf("handler called %d times, want 3", calls.Load())
+		}
+	})
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	var calls atomic.Int32
+	app := idempotentApp(&calls, nil)
+
+	if resp, _ := post(t, app, strings.Repeat("k", maxIdempotencyKey+1), "201"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if calls.Load() != 0 {
+		t.Error("handler ran for a rejected key")
+	}
+}
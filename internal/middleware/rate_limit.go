@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/logging"
+	"github.com/omniflare/campus-lostandfound/internal/ratelimit"
+)
+
+// RateLimit middleware throttles requests with a token bucket per user once
+// Auth has run, or per IP address on public routes. Users whose role is in
+// exemptRoles are not limited, which needs Auth to have set the role. Responses carry the RateLimit-* headers, and
+// throttled requests get 429 with Retry-After. The name separates the buckets
+// of different limits.
+func RateLimit(name string, limit ratelimit.Limit, exemptRoles []string) fiber.Handler {
+	if !limit.Enabled() {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+	policy := fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, int(limit.Per.Seconds()), limit.Burst)
+
+	return func(c *fiber.Ctx) error {
+		if role, ok := c.Locals("role").(string); ok && slices.Contains(exemptRoles, role) {
+			return c.Next()
+		}
+
+		key := name + ":ip:" + c.IP()
+		if userID, ok := c.Locals("user_id").(int); ok {
+			key = name + ":user:" + strconv.Itoa(userID)
+		}
+
+		result, err := ratelimit.Take(c.UserContext(), key, limit)
+		if err != nil {
+			// Serve the request rather than fail it because the store is unavailable
+			logging.Ctx(c).Error("Error checking rate limit", "limit", name, "error", err)
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+		c.Set("RateLimit-Policy", policy)
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests, please try again later",
+			})
+		}
+
+		// Continue to the next middleware/handler
+		return c.Next()
+	}
+}
+
+// ceilSeconds formats a duration as whole seconds, rounding up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
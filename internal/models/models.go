@@ -1,19 +1,27 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // User represents a user in the system
 type User struct {
-	ID           int       `db:"id" json:"id"`
-	Username     string    `db:"username" json:"username"`
-	Email        string    `db:"email" json:"email"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	Role         string    `db:"role" json:"role"` // student, guard, admin
-	FirstName    string    `db:"first_name" json:"first_name"`
-	LastName     string    `db:"last_name" json:"last_name"`
-	Phone        string    `db:"phone" json:"phone"`
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	ID               int        `db:"id" json:"id"`
+	Username         string     `db:"username" json:"username"`
+	Email            string     `db:"email" json:"email"`
+	PasswordHash     string     `db:"password_hash" json:"-"`
+	Role             string     `db:"role" json:"role"` // student, guard, admin
+	FirstName        string     `db:"first_name" json:"first_name"`
+	LastName         string     `db:"last_name" json:"last_name"`
+	Phone            string     `db:"phone" json:"phone"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
+	FailedLoginCount int        `db:"failed_login_count" json:"failed_login_count"`
+	LockedUntil      *time.Time `db:"locked_until" json:"locked_until"`
 }
 
 // Item represents an item in the lost and found system
@@ -47,25 +55,227 @@ type Image struct {
 
 // Message represents a message between users about an item
 type Message struct {
-	ID         int       `db:"id" json:"id"`
-	SenderID   int       `db:"sender_id" json:"sender_id"`
-	ReceiverID int       `db:"receiver_id" json:"receiver_id"`
-	ItemID     int       `db:"item_id" json:"item_id"`
-	Content    string    `db:"content" json:"content"`
-	Read       bool      `db:"read" json:"read"`
-	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	ID             int       `db:"id" json:"id"`
+	ConversationID *int      `db:"conversation_id" json:"conversation_id"`
+	SenderID       int       `db:"sender_id" json:"sender_id"`
+	ReceiverID     *int      `db:"receiver_id" json:"receiver_id"` // nil for messages to every participant of a mediated conversation
+	ItemID         *int      `db:"item_id" json:"item_id"`
+	Content        string    `db:"content" json:"content"`
+	Read           bool      `db:"read" json:"read"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+
+	ContainsContactInfo bool `db:"contains_contact_info" json:"contains_contact_info"`
+	ContactInfoRedacted bool `db:"contact_info_redacted" json:"contact_info_redacted"`
+
+	Attachments []MessageAttachment `db:"-" json:"attachments,omitempty"`
+}
+
+// MessageAttachment represents a file such as a proof photo sent with a message
+type MessageAttachment struct {
+	ID             int       `db:"id" json:"id"`
+	MessageID      int       `db:"message_id" json:"message_id"`
+	ConversationID int       `db:"conversation_id" json:"conversation_id"`
+	UploaderID     int       `db:"uploader_id" json:"uploader_id"`
+	Filename       string    `db:"filename" json:"filename"`
+	ContentType    string    `db:"content_type" json:"content_type"`
+	SizeBytes      int64     `db:"size_bytes" json:"size_bytes"`
+	StorageName    string    `db:"storage_name" json:"-"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	URL            string    `db:"-" json:"url"`
+}
+
+// Conversation represents a message thread between users about an item
+type Conversation struct {
+	ID             int       `db:"id" json:"id"`
+	ItemID         *int      `db:"item_id" json:"item_id"`
+	ParticipantKey string    `db:"participant_key" json:"-"` // "lowID:highID" of the two original participants
+	CreatedBy      *int      `db:"created_by" json:"created_by"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// ConversationParticipant represents a user taking part in a conversation
+type ConversationParticipant struct {
+	ConversationID int        `db:"conversation_id" json:"conversation_id"`
+	UserID         int        `db:"user_id" json:"user_id"`
+	Username       string     `db:"username" json:"username"`
+	Role           string     `db:"role" json:"role"` // participant, mediator
+	LastReadAt     *time.Time `db:"last_read_at" json:"last_read_at"`
+	JoinedAt       time.Time  `db:"joined_at" json:"joined_at"`
+}
+
+// ConversationSummary is a conversation as shown in the conversation list
+type ConversationSummary struct {
+	ID                int                       `db:"id" json:"id"`
+	ItemID            *int                      `db:"item_id" json:"item_id"`
+	ItemTitle         *string                   `db:"item_title" json:"item_title"`
+	ItemImageURL      *string                   `db:"item_image_url" json:"item_image_url"`
+	ItemStatus        *string                   `db:"item_status" json:"item_status"`
+	MyRole            *string                   `db:"my_role" json:"my_role"`
+	OtherUserID       *int                      `db:"-" json:"other_user_id"`
+	OtherUsername     string                    `db:"-" json:"other_username"`
+	LatestMessageID   *int                      `db:"latest_message_id" json:"latest_message_id"`
+	LatestMessage     *string                   `db:"latest_message" json:"latest_message"`
+	LatestMessageTime *time.Time                `db:"latest_message_time" json:"latest_message_time"`
+	LatestSenderID    *int                      `db:"latest_sender_id" json:"latest_sender_id"`
+	UnreadCount       int                       `db:"unread_count" json:"unread_count"`
+	UpdatedAt         time.Time                 `db:"updated_at" json:"updated_at"`
+	Participants      []ConversationParticipant `db:"-" json:"participants"`
 }
 
 // Report represents a report of abuse or suspicious activity
 type Report struct {
-	ID         int       `db:"id" json:"id"`
-	ReporterID *int      `db:"reporter_id" json:"reporter_id"`
-	ReportedID int       `db:"reported_id" json:"reported_id"`
-	ItemID     *int      `db:"item_id" json:"item_id"`
-	Reason     string    `db:"reason" json:"reason"`
-	Status     string    `db:"status" json:"status"` // pending, resolved, dismissed
-	CreatedAt  time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+	ID           int       `db:"id" json:"id"`
+	ReporterID   *int      `db:"reporter_id" json:"reporter_id"`
+	ReportedID   int       `db:"reported_id" json:"reported_id"`
+	ItemID       *int      `db:"item_id" json:"item_id"`
+	Reason       string    `db:"reason" json:"reason"`
+	Status       string    `db:"status" json:"status"` // pending, resolved, dismissed
+	AdminComment *string   `db:"admin_comment" json:"admin_comment"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// LoginAttempt represents a single login attempt for auditing
+type LoginAttempt struct {
+	ID        int       `db:"id" json:"id"`
+	Username  string    `db:"username" json:"username"`
+	UserID    *int      `db:"user_id" json:"user_id"`
+	IPAddress string    `db:"ip_address" json:"ip_address"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	Success   bool      `db:"success" json:"success"`
+	Reason    string    `db:"reason" json:"reason"` // success, invalid_password, unknown_user, locked, throttled, or pending while in progress
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// APIKey represents a scoped key used by kiosks and integrations instead of a JWT
+type APIKey struct {
+	ID          int        `db:"id" json:"id"`
+	UserID      int        `db:"user_id" json:"user_id"`
+	Name        string     `db:"name" json:"name"`
+	Prefix      string     `db:"prefix" json:"prefix"`
+	KeyHash     string     `db:"key_hash" json:"-"`
+	Permissions StringList `db:"permissions" json:"permissions"`
+	CreatedBy   *int       `db:"created_by" json:"created_by"`
+	LastUsedAt  *time.Time `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at"`
+	RevokedAt   *time.Time `db:"revoked_at" json:"revoked_at"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// StringList is a list of strings stored as a comma separated column
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+
+	*l = StringList{}
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// UserBlock represents one user blocking another
+type UserBlock struct {
+	BlockerID int       `db:"blocker_id" json:"blocker_id"`
+	BlockedID int       `db:"blocked_id" json:"blocked_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// UserSettings represents a user's privacy preferences
+type UserSettings struct {
+	UserID          int       `db:"user_id" json:"user_id"`
+	MessagePolicy   string    `db:"message_policy" json:"message_policy"`     // everyone, item_related
+	MaskedContact   bool      `db:"masked_contact" json:"masked_contact"`     // Redact contact details in messages until a claim is approved
+	NameVisibility  string    `db:"name_visibility" json:"name_visibility"`   // everyone, participants, nobody
+	EmailVisibility string    `db:"email_visibility" json:"email_visibility"` // everyone, participants, nobody
+	PhoneVisibility string    `db:"phone_visibility" json:"phone_visibility"` // everyone, participants, nobody
+	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Notification represents an event shown in a user's notification center
+type Notification struct {
+	ID        int              `db:"id" json:"id"`
+	UserID    int              `db:"user_id" json:"user_id"`
+	Type      string           `db:"type" json:"type"` // match.new, claim.approved, claim.rejected, item.status_changed, message.new, report.resolved
+	Title     string           `db:"title" json:"title"`
+	Body      string           `db:"body" json:"body"`
+	Data      *json.RawMessage `db:"data" json:"data,omitempty"`
+	ReadAt    *time.Time       `db:"read_at" json:"read_at"`
+	EmailedAt *time.Time       `db:"emailed_at" json:"-"`
+	CreatedAt time.Time        `db:"created_at" json:"created_at"`
+}
+
+// NotificationPreference represents whether a user receives a type of notification
+type NotificationPreference struct {
+	Type    string `db:"type" json:"type"`
+	Enabled bool   `db:"enabled" json:"enabled"`
+}
+
+// Webhook represents an external endpoint that receives signed event payloads
+type Webhook struct {
+	ID          int        `db:"id" json:"id"`
+	URL         string     `db:"url" json:"url"`
+	Description string     `db:"description" json:"description"`
+	Secret      string     `db:"secret" json:"-"`
+	EventTypes  StringList `db:"event_types" json:"event_types"`
+	Active      bool       `db:"active" json:"active"`
+	CreatedBy   *int       `db:"created_by" json:"created_by"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// WebhookRequest represents the request body for creating or updating a webhook
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	Active      *bool    `json:"active"`
+}
+
+// WebhookDelivery represents the delivery of one event to a webhook, with the outcome of its latest attempt an event to a webhook
+type WebhookDelivery struct {
+	ID             int        `db:"id" json:"id"`
+	WebhookID      int        `db:"webhook_id" json:"webhook_id"`
+	EventID        string     `db:"event_id" json:"event_id"`
+	EventType      string     `db:"event_type" json:"event_type"`
+	Payload        string     `db:"payload" json:"payload"`
+	Status         string     `db:"status" json:"status"` // pending, succeeded, failed
+	Attempts       int        `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	ResponseStatus *int       `db:"response_status" json:"response_status"`
+	ResponseBody   *string    `db:"response_body" json:"response_body"`
+	LastError      *string    `db:"last_error" json:"last_error"`
+	DurationMS     *int       `db:"duration_ms" json:"duration_ms"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time `db:"delivered_at" json:"delivered_at"`
+}
+
+// PublicProfile is the part of a user's profile other users may see
+type PublicProfile struct {
+	ID        int     `json:"id"`
+	Username  string  `json:"username"`
+	Role      string  `json:"role"`
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Phone     *string `json:"phone,omitempty"`
 }
 
 // Login represents the login request payload
@@ -94,11 +304,13 @@ type ItemRequest struct {
 	Status      string     `json:"status"` // For found items, this would be "found"
 }
 
-// MessageRequest represents a message request payload
+// MessageRequest represents a message request payload. Either a receiver (and
+// optional item) or an existing conversation must be given.
 type MessageRequest struct {
-	ReceiverID int    `json:"receiver_id"`
-	ItemID     int    `json:"item_id"`
-	Content    string `json:"content"`
+	ReceiverID     int    `json:"receiver_id"`
+	ItemID         int    `json:"item_id"`
+	ConversationID int    `json:"conversation_id"`
+	Content        string `json:"content"`
 }
 
 // ReportRequest represents a report request payload
@@ -108,6 +320,13 @@ type ReportRequest struct {
 	Reason     string `json:"reason"`
 }
 
+// APIKeyRequest represents an API key creation payload
+type APIKeyRequest struct {
+	Name        string     `json:"name"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
 // TokenResponse is the response containing the JWT token
 type TokenResponse struct {
 	Token string `json:"token"`
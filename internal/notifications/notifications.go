@@ -0,0 +1,132 @@
+package notifications
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/email"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/realtime"
+)
+
+// Notification types a user can receive
+const (
+	MatchNew          = "match.new"
+	ClaimApproved     = "claim.approved"
+	ClaimRejected     = "claim.rejected"
+	ItemStatusChanged = "item.status_changed"
+	MessageNew        = "message.new"
+	ReportResolved    = "report.resolved"
+)
+
+// Types lists every notification type, in the order preferences are shown
+var Types = []string{MatchNew, ClaimApproved, ClaimRejected, ItemStatusChanged, MessageNew, ReportResolved}
+
+// ValidType reports whether the notification type exists
+func ValidType(notificationType string) bool {
+	for _, t := range Types {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyTx records a notification for each user who has not turned its type
+// off, and queues its email for immediate delivery, as part of an outbox
+// event's transaction. The notifications are pushed to the users' open
+// connections once the transaction commits.
+func NotifyTx(tx *events.Tx, notificationType, title, body string, data interface{}, userIDs ...int) error {
+	created, err := create(tx, notificationType, title, body, data, userIDs)
+	if err != nil {
+		return err
+	}
+	tx.AfterCommit(func() { push(created) })
+	return nil
+}
+
+// create saves a notification and queues its email for each user who has not
+// turned its type off, returning the notifications saved before any error
+func create(q sqlx.Ext, notificationType, title, body string, data interface{}, userIDs []int) ([]models.Notification, error) {
+	var raw *json.RawMessage
+	var payload interface{}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		msg := json.RawMessage(encoded)
+		raw = &msg
+		payload = string(encoded)
+	}
+
+	var created []models.Notification
+	for _, userID := range userIDs {
+		enabled, err := enabled(q, userID, notificationType)
+		if err != nil {
+			return created, err
+		}
+		if !enabled {
+			continue
+		}
+
+		notification := models.Notification{
+			UserID:    userID,
+			Type:      notificationType,
+			Title:     title,
+			Body:      body,
+			Data:      raw,
+			CreatedAt: time.Now(),
+		}
+		err = q.QueryRowx(`
+			INSERT INTO notifications (user_id, type, title, body, data, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`, userID, notificationType, title, body, payload, notification.CreatedAt).Scan(&notification.ID)
+		if err != nil {
+			return created, err
+		}
+
+		if err := email.QueueNotification(q, notification); err != nil {
+			return created, err
+		}
+		created = append(created, notification)
+	}
+	return created, nil
+}
+
+// push sends notifications to their users' open connections
+func push(created []models.Notification) {
+	for _, notification := range created {
+		realtime.Publish(realtime.NotificationNew, notification, notification.UserID)
+	}
+}
+
+// enabled reports whether the user receives notifications of the type using q
+func enabled(q sqlx.Queryer, userID int, notificationType string) (bool, error) {
+	var enabled bool
+	err := sqlx.Get(q, &enabled, `
+		SELECT COALESCE(
+			(SELECT enabled FROM notification_preferences WHERE user_id = $1 AND type = $2),
+			TRUE
+		)
+	`, userID, notificationType)
+	return enabled, err
+}
+
+// Preferences returns the user's setting for every notification type, given
+// the settings they have saved. Types they have never set are on.
+func Preferences(saved []models.NotificationPreference) []models.NotificationPreference {
+	disabled := map[string]bool{}
+	for _, pref := range saved {
+		disabled[pref.Type] = !pref.Enabled
+	}
+
+	prefs := make([]models.NotificationPreference, len(Types))
+	for i, t := range Types {
+		prefs[i] = models.NotificationPreference{Type: t, Enabled: !disabled[t]}
+	}
+	return prefs
+}
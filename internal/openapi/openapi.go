@@ -0,0 +1,352 @@
+// Package openapi describes the API as an OpenAPI 3.1 document, with schemas
+// derived from the models package, and serves it with a Redoc page.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SpecPath is where the document is served, and DocsPath its Redoc page
+const (
+	SpecPath = "/api/v1/openapi.json"
+	DocsPath = "/api/v1/docs"
+)
+
+// auth is how an operation authenticates its caller
+type auth int
+
+const (
+	public        auth = iota
+	authenticated      // JWT bearer token or X-API-Key
+	session            // JWT bearer token only
+	streamToken        // Like authenticated, or the JWT as ?token=
+	socketToken        // JWT as ?token= only
+	metricsToken       // Bearer METRICS_TOKEN when one is configured
+)
+
+// param is a query parameter
+type param struct {
+	name        string
+	description string
+	schema      Schema
+	required    bool
+}
+
+// operation documents one registered route
+type operation struct {
+	method, path string // As registered with Fiber, e.g. /api/v1/items/:id
+	id           string
+	tag, summary string
+	description  string
+	auth         auth
+	permission   string
+	pathParams   map[string]string // Descriptions of path parameters other than a plain ID
+	query        []param
+	body         Schema // JSON request body
+	form         Schema // multipart/form-data request body
+	status       int    // Success status, 200 when zero
+	response     Schema
+	contentType  string // Of the success response, application/json when empty
+	limited      bool   // Throttled by a rate limit
+	idempotent   bool   // Accepts an Idempotency-Key
+	noErrors     bool   // Responds only with its success status
+}
+
+// tags orders the operation groups in the document
+var tags = []string{"Health", "Auth", "Items", "Messages", "Conversations", "Profile", "Notifications", "Reports", "API Keys", "Guard", "Admin", "Webhooks", "Docs"}
+
+// Spec returns the OpenAPI document. It is built on first use.
+var Spec = sync.OnceValue(build)
+
+// Handler serves the document as JSON
+func Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(Spec())
+	}
+}
+
+// docsPage renders the document with Redoc
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Campus Lost and Found API</title>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+  <redoc spec-url="` + SpecPath + `"></redoc>
+  <script src="https://cdn.jsdelivr.net/npm/redoc@2/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// DocsHandler serves the interactive documentation page
+func DocsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Type("html", "utf-8")
+		return c.SendString(docsPage)
+	}
+}
+
+// Check reports registered routes missing from the document and documented
+// operations that are not registered. HEAD routes, which Fiber adds for every
+// GET route, and middleware are ignored.
+func Check(routes []fiber.Route) error {
+	paths := Spec()["paths"].(Schema)
+	var errs []error
+
+	registered := map[string]bool{}
+	for _, route := range routes {
+		if route.Method == fiber.MethodHead || route.Method == "USE" {
+			continue
+		}
+		path, method := openAPIPath(route.Path), strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+
+		item, _ := paths[path].(Schema)
+		if _, ok := item[method]; !ok {
+			errs = append(errs, fmt.Errorf("%s %s is registered but not documented", route.Method, route.Path))
+		}
+	}
+
+	for _, path := range sortedKeys(paths) {
+		for _, method := range sortedKeys(paths[path].(Schema)) {
+			if !registered[method+" "+path] {
+				errs = append(errs, fmt.Errorf("%s %s is documented but not registered", strings.ToUpper(method), path))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// build assembles the document from the operations
+func build() Schema {
+	r := &registry{schemas: map[string]Schema{}}
+	r.schemas["Error"] = object(
+		"error", str("What went wrong"),
+		"request_id", str("ID of the request, also sent as X-Request-ID"),
+	)
+	r.schemas["PageMeta"] = object(
+		"total", integer("Number of matching records"),
+		"page", integer("Current page, from 1"),
+		"limit", integer("Records per page"),
+		"pages", integer("Number of pages"),
+	)
+
+	paths := Schema{}
+	for _, op := range operations(r) {
+		path := openAPIPath(op.path)
+		if paths[path] == nil {
+			paths[path] = Schema{}
+		}
+		paths[path].(Schema)[strings.ToLower(op.method)] = op.document()
+	}
+
+	tagList := []Schema{}
+	for _, tag := range tags {
+		tagList = append(tagList, Schema{"name": tag})
+	}
+
+	return Schema{
+		"openapi": "3.1.0",
+		"info": Schema{
+			"title":       "Campus Lost and Found API",
+			"version":     "1.0.0",
+			"description": "Report, search and claim items lost and found on campus, and message the people who found or lost them.",
+		},
+		"servers": []Schema{{"url": "/"}},
+		"tags":    tagList,
+		"paths":   paths,
+		"components": Schema{
+			"schemas":   r.schemas,
+			"responses": errorResponses(),
+			"headers": Schema{
+				"RateLimit-Limit":     Schema{"description": "Requests allowed in a burst", "schema": integer("")},
+				"RateLimit-Remaining": Schema{"description": "Requests left before the limit applies", "schema": integer("")},
+				"RateLimit-Reset":     Schema{"description": "Seconds until the full burst is available again", "schema": integer("")},
+			},
+			"securitySchemes": Schema{
+				"bearerAuth":   Schema{"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "Token from POST /api/v1/auth/login"},
+				"apiKey":       Schema{"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "Scoped API key for kiosks and integrations"},
+				"tokenQuery":   Schema{"type": "apiKey", "in": "query", "name": "token", "description": "JWT passed in the URL by EventSource and WebSocket clients"},
+				"metricsToken": Schema{"type": "http", "scheme": "bearer", "description": "METRICS_TOKEN, when one is configured"},
+			},
+		},
+	}
+}
+
+// document describes the operation as an OpenAPI operation object
+func (op operation) document() Schema {
+	doc := Schema{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+	}
+
+	description := op.description
+	if op.permission != "" {
+		description = strings.TrimSpace(description + "\n\nRequires the `" + op.permission + "` permission.")
+	}
+	if description != "" {
+		doc["description"] = description
+	}
+
+	switch op.auth {
+	case authenticated:
+		doc["security"] = []Schema{{"bearerAuth": []string{}}, {"apiKey": []string{}}}
+	case session:
+		doc["security"] = []Schema{{"bearerAuth": []string{}}}
+	case streamToken:
+		doc["security"] = []Schema{{"bearerAuth": []string{}}, {"apiKey": []string{}}, {"tokenQuery": []string{}}}
+	case socketToken:
+		doc["security"] = []Schema{{"tokenQuery": []string{}}}
+	case metricsToken:
+		doc["security"] = []Schema{{"metricsToken": []string{}}, {}}
+	}
+
+	params := []Schema{}
+	for _, name := range pathParams.FindAllStringSubmatch(op.path, -1) {
+		schema, description := integer(""), "ID"
+		if name[1] != "id" {
+			schema = str("")
+		}
+		if d, ok := op.pathParams[name[1]]; ok {
+			description = d
+		}
+		params = append(params, Schema{"name": name[1], "in": "path", "required": true, "description": description, "schema": schema})
+	}
+	for _, p := range op.query {
+		param := Schema{"name": p.name, "in": "query", "schema": p.schema}
+		if p.description != "" {
+			param["description"] = p.description
+		}
+		if p.required {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+	if op.idempotent {
+		params = append(params, Schema{
+			"name":        "Idempotency-Key",
+			"in":          "header",
+			"description": "Client-generated key, such as a UUID, identifying the action. Retries with the same key get the first response, for 24 hours.",
+			"schema":      Schema{"type": "string", "maxLength": 255},
+		})
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	switch {
+	case op.body != nil:
+		doc["requestBody"] = Schema{"required": true, "content": Schema{"application/json": Schema{"schema": op.body}}}
+	case op.form != nil:
+		doc["requestBody"] = Schema{"required": true, "content": Schema{"multipart/form-data": Schema{"schema": op.form}}}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	contentType := op.contentType
+	if contentType == "" {
+		contentType = fiber.MIMEApplicationJSON
+	}
+	success := Schema{"description": http.StatusText(status)}
+	if op.response != nil {
+		success["content"] = Schema{contentType: Schema{"schema": op.response}}
+	}
+	headers := Schema{}
+	if op.limited {
+		for _, name := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"} {
+			headers[name] = Schema{"$ref": "#/components/headers/" + name}
+		}
+	}
+	if op.idempotent {
+		headers["Idempotent-Replayed"] = Schema{"description": "true when the response is replayed for a retry", "schema": str("")}
+	}
+	if len(headers) > 0 {
+		success["headers"] = headers
+	}
+	responses := Schema{strconv.Itoa(status): success}
+
+	if !op.noErrors {
+		add := func(status int, name string) {
+			responses[strconv.Itoa(status)] = Schema{"$ref": "#/components/responses/" + name}
+		}
+		if op.body != nil || op.form != nil || len(op.query) > 0 || strings.Contains(op.path, ":") {
+			add(fiber.StatusBadRequest, "BadRequest")
+		}
+		if op.auth != public {
+			add(fiber.StatusUnauthorized, "Unauthorized")
+		}
+		if op.permission != "" {
+			add(fiber.StatusForbidden, "Forbidden")
+		}
+		if strings.Contains(op.path, ":") {
+			add(fiber.StatusNotFound, "NotFound")
+		}
+		if op.idempotent {
+			add(fiber.StatusConflict, "IdempotencyConflict")
+			add(fiber.StatusUnprocessableEntity, "IdempotencyMismatch")
+		}
+		if op.limited {
+			add(fiber.StatusTooManyRequests, "TooManyRequests")
+		}
+		add(fiber.StatusInternalServerError, "InternalServerError")
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// errorResponses are the shared error responses, all with an Error body
+func errorResponses() Schema {
+	errorResponse := func(description string) Schema {
+		return Schema{
+			"description": description,
+			"content":     Schema{fiber.MIMEApplicationJSON: Schema{"schema": Schema{"$ref": "#/components/schemas/Error"}}},
+		}
+	}
+
+	tooMany := errorResponse("A rate limit was exceeded")
+	tooMany["headers"] = Schema{
+		"Retry-After": Schema{"description": "Seconds until a request is allowed", "schema": integer("")},
+	}
+
+	return Schema{
+		"BadRequest":          errorResponse("The request is invalid"),
+		"Unauthorized":        errorResponse("Missing or invalid credentials"),
+		"Forbidden":           errorResponse("The caller lacks the required permission"),
+		"NotFound":            errorResponse("The resource does not exist"),
+		"IdempotencyConflict": errorResponse("A request with the same Idempotency-Key is still being processed"),
+		"IdempotencyMismatch": errorResponse("The Idempotency-Key was already used for a different request"),
+		"TooManyRequests":     tooMany,
+		"InternalServerError": errorResponse("The server failed to process the request"),
+	}
+}
+
+// pathParams matches the parameters of a Fiber route path
+var pathParams = regexp.MustCompile(`:(\w+)`)
+
+// openAPIPath turns a Fiber path such as /items/:id into /items/{id}
+func openAPIPath(path string) string {
+	return pathParams.ReplaceAllString(path, "{$1}")
+}
+
+func sortedKeys(m Schema) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
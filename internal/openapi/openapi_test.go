@@ -0,0 +1,54 @@
+package openapi_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/openapi"
+	"github.com/omniflare/campus-lostandfound/internal/routes"
+)
+
+// registeredRoutes registers the API's routes on an app that is never started
+func registeredRoutes() []fiber.Route {
+	app := fiber.New()
+	routes.SetupRoutes(app)
+	return app.GetRoutes(true)
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	if err := openapi.Check(registeredRoutes()); err != nil {
+		t.Errorf("the OpenAPI document does not match the routes:\n%v", err)
+	}
+}
+
+func TestCheckReportsDocumentedRouteThatDoesNotExist(t *testing.T) {
+	// Leave out a documented route, as if its handler had been removed
+	var remaining []fiber.Route
+	for _, route := range registeredRoutes() {
+		if route.Method == fiber.MethodGet && route.Path == "/api/v1/items/:id" {
+			continue
+		}
+		remaining = append(remaining, route)
+	}
+
+	err := openapi.Check(remaining)
+	if err == nil {
+		t.Fatal("Check accepted a documented route that is not registered")
+	}
+	if want := "GET /api/v1/items/{id} is documented but not registered"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Check error %q does not contain %q", err, want)
+	}
+}
+
+func TestCheckReportsUndocumentedRoute(t *testing.T) {
+	undocumented := fiber.Route{Method: fiber.MethodDelete, Path: "/api/v1/items/:id"}
+
+	err := openapi.Check(append(registeredRoutes(), undocumented))
+	if err == nil {
+		t.Fatal("Check accepted a route that is not documented")
+	}
+	if want := "DELETE /api/v1/items/:id is registered but not documented"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Check error %q does not contain %q", err, want)
+	}
+}
@@ -0,0 +1,544 @@
+package openapi
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+)
+
+// operations lists every route registered by routes.SetupRoutes, in the same order
+func operations(r *registry) []operation {
+	item := r.ref(models.Item{})
+	user := r.ref(models.User{})
+	apiKey := r.ref(models.APIKey{})
+	webhook := r.ref(models.Webhook{})
+	conversation := r.ref(models.ConversationSummary{})
+	participant := r.ref(models.ConversationParticipant{})
+	preference := r.ref(models.NotificationPreference{})
+	nullableTime := Schema{"type": []string{"string", "null"}, "format": "date-time"}
+
+	itemFilters := []param{
+		queryOneOf("status", "Only items with this status", "all", "lost", "found", "claimed", "returned"),
+		query("category", "Only items in this category, or all"),
+	}
+	messageSent := optional(withMessage("Message sent successfully", object(
+		"message_id", integer(""),
+		"conversation_id", integer(""),
+		"warning", str("Present when the message contained contact details, or had them hidden by masked contact mode"),
+	)), "warning")
+	apiKeyCreated := withMessage("API key created successfully. Store it now, it will not be shown again", object(
+		"api_key_id", integer(""),
+		"key", str("The full key, shown only in this response"),
+		"prefix", str("Start of the key, shown in key lists"),
+		"permissions", arrayOf(str("")),
+		"expires_at", nullableTime,
+	))
+	emailFrequency := oneOf("How often notifications are emailed", "immediate", "daily", "off")
+
+	return []operation{
+		// Health and monitoring
+		{
+			method: fiber.MethodGet, path: "/health", id: "health", tag: "Health",
+			summary:  "Check that the API is running",
+			response: object("status", str(""), "message", str("")),
+			noErrors: true,
+		},
+		{
+			method: fiber.MethodGet, path: "/health/live", id: "liveness", tag: "Health",
+			summary:     "Liveness probe",
+			description: "Reports that the process is serving requests, without checking its dependencies.",
+			response:    object("status", oneOf("", "ok")),
+			noErrors:    true,
+		},
+		{
+			method: fiber.MethodGet, path: "/health/ready", id: "readiness", tag: "Health",
+			summary:     "Readiness probe",
+			description: "Checks the database, upload storage, migrations and background workers. Responds 503 with the same body when the database, storage or migrations are unhealthy. Stale or restarting workers and failed outbox events are reported as degraded and do not fail the probe. Whenever a check is not ok the body includes each check's status and error; requests sending the metrics token always get the details, with the database driver and latency, schema version and worker heartbeats.",
+			auth:        metricsToken,
+			response: optional(object(
+				"status", oneOf("", "ok", "unavailable"),
+				"checks", object(
+					"database", oneOf("", "ok", "unhealthy"),
+					"storage", oneOf("", "ok", "unhealthy"),
+					"migrations", oneOf("", "ok", "unhealthy"),
+					"workers", oneOf("", "ok", "degraded"),
+					"outbox", oneOf("", "ok", "degraded"),
+				),
+				"details", Schema{"type": "object", "description": "Each check's status and error, sent whenever a check is not ok. With the metrics token it is always sent and adds the database driver and latency, schema versions, worker heartbeats and the number of failed outbox events."},
+			), "details"),
+			noErrors: true,
+		},
+		{
+			method: fiber.MethodGet, path: "/metrics", id: "metrics", tag: "Health",
+			summary:     "Prometheus metrics",
+			auth:        metricsToken,
+			response:    str("Metrics in the Prometheus text exposition format"),
+			contentType: fiber.MIMETextPlain,
+			noErrors:    true,
+		},
+
+		// Documentation
+		{
+			method: fiber.MethodGet, path: SpecPath, id: "getOpenAPISpec", tag: "Docs",
+			summary:  "This OpenAPI document",
+			response: Schema{"type": "object"},
+			noErrors: true,
+		},
+		{
+			method: fiber.MethodGet, path: DocsPath, id: "getAPIDocs", tag: "Docs",
+			summary:     "Interactive API documentation",
+			response:    str("Redoc page rendering this document"),
+			contentType: fiber.MIMETextHTMLCharsetUTF8,
+			noErrors:    true,
+		},
+
+		// Auth
+		{
+			method: fiber.MethodPost, path: "/api/v1/auth/register", id: "registerUser", tag: "Auth",
+			summary:  "Register a new student account",
+			body:     r.ref(models.Register{}),
+			status:   fiber.StatusCreated,
+			response: withMessage("User registered successfully", object("user_id", integer(""))),
+			limited:  true,
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/auth/login", id: "loginUser", tag: "Auth",
+			summary:     "Log in and get a JWT",
+			description: "Repeated failures lock the account for a while and throttle the client's IP address; those requests are rejected with 429 and retry_after.",
+			body:        r.ref(models.Login{}),
+			response:    r.ref(models.TokenResponse{}),
+			limited:     true,
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/unsubscribe", id: "unsubscribePage", tag: "Notifications",
+			summary:     "Confirm unsubscribing from notification emails",
+			description: "Shows a page that asks to confirm with POST and changes nothing. Tokens expire 90 days after the email was sent.",
+			query:       []param{{name: "token", description: "Signed token from the email's unsubscribe link", schema: str(""), required: true}},
+			response:    str("Confirmation page"),
+			contentType: fiber.MIMETextHTMLCharsetUTF8,
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/unsubscribe", id: "unsubscribe", tag: "Notifications",
+			summary:     "Unsubscribe from notification emails",
+			description: "Used by the confirmation page and RFC 8058 one-click clients. Clients that accept text/html get a page instead of JSON.",
+			query:       []param{{name: "token", description: "Signed token from the email's unsubscribe link or List-Unsubscribe header", schema: str(""), required: true}},
+			response:    message("You have been unsubscribed from email notifications"),
+		},
+
+		// Profile
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/profile", id: "getUserProfile", tag: "Profile",
+			summary: "Get your profile", auth: authenticated, permission: permissions.ProfileManage,
+			response: user,
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/user/profile", id: "updateUserProfile", tag: "Profile",
+			summary: "Update your profile", auth: authenticated, permission: permissions.ProfileManage,
+			body:     optional(object("first_name", str(""), "last_name", str(""), "phone", str(""), "email", str("")), "first_name", "last_name", "phone", "email"),
+			response: message("Profile updated successfully"),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/user/password", id: "changePassword", tag: "Profile",
+			summary: "Change your password", auth: session, permission: permissions.ProfileManage,
+			description: "Requires a JWT; API keys are rejected.",
+			body:        object("current_password", str(""), "new_password", str("")),
+			response:    message("Password changed successfully"),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/items", id: "getUserItems", tag: "Items",
+			summary: "List the items you reported or found", auth: authenticated, permission: permissions.ProfileManage,
+			query:    append(itemFilters[:1:1], paging(10)...),
+			response: page("items", item),
+		},
+
+		// Messages
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/messages/unread", id: "getUnreadMessageCount", tag: "Messages",
+			summary: "Count your unread messages", auth: authenticated, permission: permissions.MessagesSend,
+			response: object("unread_count", integer("")),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/messages/conversations", id: "getConversations", tag: "Messages",
+			summary: "List your conversations", auth: authenticated, permission: permissions.MessagesSend,
+			query:    []param{queryInt("item_id", "Only conversations about this item")},
+			response: arrayOf(conversation),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/messages/:id", id: "getMessages", tag: "Messages",
+			summary: "List your messages with another user", auth: authenticated, permission: permissions.MessagesSend,
+			description: "Marks the messages you received as read.",
+			pathParams:  map[string]string{"id": "ID of the other user"},
+			query:       append([]param{queryInt("item_id", "Only messages about this item")}, paging(50)...),
+			response:    page("messages", r.ref(models.Message{})),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/messages", id: "sendMessage", tag: "Messages",
+			summary: "Send a message", auth: authenticated, permission: permissions.MessagesSend,
+			description: "Starts or continues the conversation with receiver_id about item_id, or continues conversation_id.",
+			body:        r.ref(models.MessageRequest{}),
+			status:      fiber.StatusCreated,
+			response:    messageSent,
+			limited:     true, idempotent: true,
+		},
+
+		// Conversations
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/conversations/:id/messages", id: "getConversationMessages", tag: "Conversations",
+			summary: "List the messages of a conversation", auth: authenticated, permission: permissions.MessagesSend,
+			query: paging(50),
+			response: object(
+				"messages", arrayOf(extend(r.ref(models.Message{}), object("sender_username", str("")))),
+				"participants", arrayOf(participant),
+				"meta", Schema{"$ref": "#/components/schemas/PageMeta"},
+			),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/conversations/:id/messages", id: "sendConversationMessage", tag: "Conversations",
+			summary: "Send a message to a conversation", auth: authenticated, permission: permissions.MessagesSend,
+			body:     object("content", str("")),
+			status:   fiber.StatusCreated,
+			response: messageSent,
+			limited:  true, idempotent: true,
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/conversations/:id/participants", id: "addConversationParticipant", tag: "Conversations",
+			summary: "Add a guard to mediate a conversation", auth: authenticated, permission: permissions.MessagesSend,
+			description: "Only guards and admins with the `" + permissions.ConversationsMediate + "` permission can be added.",
+			body:        object("user_id", integer("ID of the guard to add")),
+			response:    withMessage("Participant added successfully", object("participants", arrayOf(participant))),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/conversations/:id/attachments", id: "uploadMessageAttachment", tag: "Conversations",
+			summary: "Send a file, such as a proof photo, to a conversation", auth: authenticated, permission: permissions.MessagesSend,
+			form:     file("file", "Image or PDF, at most MAX_ATTACHMENT_SIZE bytes"),
+			status:   fiber.StatusCreated,
+			response: withMessage("Attachment sent successfully", optional(object("message_id", integer(""), "conversation_id", integer(""), "warning", str(""), "attachment", r.ref(models.MessageAttachment{})), "warning")),
+			limited:  true, idempotent: true,
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/attachments/:id", id: "getMessageAttachment", tag: "Conversations",
+			summary: "Download an attachment of a conversation you take part in", auth: authenticated, permission: permissions.MessagesSend,
+			response:    Schema{"type": "string", "contentMediaType": "application/octet-stream"},
+			contentType: "*/*",
+		},
+
+		// Blocks and settings
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/blocks", id: "getBlockedUsers", tag: "Profile",
+			summary: "List the users you blocked", auth: authenticated, permission: permissions.MessagesSend,
+			response: object("blocked_users", arrayOf(extend(r.ref(models.UserBlock{}), object("blocked_username", str(""))))),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/blocks", id: "blockUser", tag: "Profile",
+			summary: "Block a user from messaging you", auth: authenticated, permission: permissions.MessagesSend,
+			body:     object("user_id", integer("")),
+			response: message("User blocked successfully"),
+		},
+		{
+			method: fiber.MethodDelete, path: "/api/v1/user/blocks/:id", id: "unblockUser", tag: "Profile",
+			summary: "Unblock a user", auth: authenticated, permission: permissions.MessagesSend,
+			pathParams: map[string]string{"id": "ID of the blocked user"},
+			response:   message("User unblocked successfully"),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/settings", id: "getUserSettings", tag: "Profile",
+			summary: "Get your privacy settings", auth: authenticated, permission: permissions.ProfileManage,
+			response: r.ref(models.UserSettings{}),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/user/settings", id: "updateUserSettings", tag: "Profile",
+			summary: "Update your privacy settings", auth: authenticated, permission: permissions.ProfileManage,
+			description: "Omitted fields keep their current values.",
+			body:        r.ref(models.UserSettings{}),
+			response:    withMessage("Settings updated successfully", object("settings", r.ref(models.UserSettings{}))),
+		},
+
+		// Notifications
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/notifications", id: "getNotifications", tag: "Notifications",
+			summary: "List your notifications", auth: authenticated, permission: permissions.ProfileManage,
+			query:    append([]param{{name: "unread", description: "Only unread notifications", schema: boolean("")}}, paging(20)...),
+			response: page("notifications", r.ref(models.Notification{})),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/notifications/unread", id: "getUnreadNotificationCount", tag: "Notifications",
+			summary: "Count your unread notifications", auth: authenticated, permission: permissions.ProfileManage,
+			response: object("unread_count", integer("")),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/user/notifications/read", id: "markAllNotificationsRead", tag: "Notifications",
+			summary: "Mark all your notifications as read", auth: authenticated, permission: permissions.ProfileManage,
+			response: withMessage("Notifications marked as read", object("updated", integer("Number of notifications marked"))),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/user/notifications/:id/read", id: "markNotificationRead", tag: "Notifications",
+			summary: "Mark a notification as read", auth: authenticated, permission: permissions.ProfileManage,
+			response: message("Notification marked as read"),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/notification-preferences", id: "getNotificationPreferences", tag: "Notifications",
+			summary: "Get which notifications you receive", auth: authenticated, permission: permissions.ProfileManage,
+			response: object("preferences", arrayOf(preference), "email_frequency", emailFrequency),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/user/notification-preferences", id: "updateNotificationPreferences", tag: "Notifications",
+			summary: "Choose which notifications you receive", auth: authenticated, permission: permissions.ProfileManage,
+			body:     optional(object("preferences", arrayOf(preference), "email_frequency", emailFrequency), "email_frequency"),
+			response: withMessage("Notification preferences updated successfully", object("preferences", arrayOf(preference), "email_frequency", emailFrequency)),
+		},
+
+		// Reports
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/reports", id: "createReport", tag: "Reports",
+			summary: "Report a user for abuse or suspicious activity", auth: authenticated, permission: permissions.ReportsCreate,
+			body:     r.ref(models.ReportRequest{}),
+			status:   fiber.StatusCreated,
+			response: withMessage("Report submitted successfully", object("report_id", integer(""))),
+			limited:  true, idempotent: true,
+		},
+
+		// API keys
+		{
+			method: fiber.MethodGet, path: "/api/v1/user/api-keys", id: "getAPIKeys", tag: "API Keys",
+			summary: "List your API keys", auth: authenticated, permission: permissions.APIKeysCreate,
+			response: object("api_keys", arrayOf(apiKey)),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/user/api-keys", id: "createAPIKey", tag: "API Keys",
+			summary: "Create an API key", auth: session, permission: permissions.APIKeysCreate,
+			description: "The key's permissions must be granted by your role.",
+			body:        r.ref(models.APIKeyRequest{}),
+			status:      fiber.StatusCreated,
+			response:    apiKeyCreated,
+		},
+		{
+			method: fiber.MethodDelete, path: "/api/v1/user/api-keys/:id", id: "revokeAPIKey", tag: "API Keys",
+			summary: "Revoke one of your API keys", auth: session, permission: permissions.APIKeysCreate,
+			response: message("API key revoked successfully"),
+		},
+
+		// Realtime
+		{
+			method: fiber.MethodGet, path: "/api/v1/ws", id: "messagesSocket", tag: "Messages",
+			summary:     "Receive messages and typing and read events over a WebSocket",
+			description: "Upgrades to a WebSocket that pushes message.new, message.read, typing, notification.new and conversation.participant_added events. Clients send {\"type\": \"typing\" | \"read\", ...} frames.",
+			auth:        socketToken,
+			status:      fiber.StatusSwitchingProtocols,
+		},
+
+		// Public profiles
+		{
+			method: fiber.MethodGet, path: "/api/v1/users/:id", id: "getPublicProfile", tag: "Profile",
+			summary:     "Get another user's public profile",
+			description: "Names, email and phone are included as the user's privacy settings allow.",
+			auth:        authenticated,
+			response:    r.ref(models.PublicProfile{}),
+		},
+
+		// Items
+		{
+			method: fiber.MethodGet, path: "/api/v1/items", id: "getItems", tag: "Items",
+			summary:  "List items",
+			query:    append(itemFilters, paging(10)...),
+			response: page("items", item),
+			limited:  true,
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/items/search", id: "searchItems", tag: "Items",
+			summary: "Search items by title or description",
+			query: append([]param{
+				{name: "q", description: "Text to search for, ignoring case", schema: str(""), required: true},
+				itemFilters[0],
+			}, paging(10)...),
+			response: page("items", item),
+			limited:  true,
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/items/:id", id: "getItemDetails", tag: "Items",
+			summary:  "Get an item",
+			response: item,
+			limited:  true,
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/items/lost", id: "reportLostItem", tag: "Items",
+			summary: "Report a lost item", auth: authenticated, permission: permissions.ItemsCreate,
+			body:     r.ref(models.ItemRequest{}),
+			status:   fiber.StatusCreated,
+			response: withMessage("Lost item reported successfully", object("item_id", integer(""))),
+			limited:  true, idempotent: true,
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/items/found", id: "reportFoundItem", tag: "Items",
+			summary: "Report a found item", auth: authenticated, permission: permissions.ItemsCreate,
+			body:     r.ref(models.ItemRequest{}),
+			status:   fiber.StatusCreated,
+			response: withMessage("Found item reported successfully", object("item_id", integer(""))),
+			limited:  true, idempotent: true,
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/items/:id/status", id: "updateItemStatus", tag: "Items",
+			summary:     "Update an item's status",
+			description: "The reporter or finder can update their own items. The `" + permissions.ItemsUpdateAny + "` permission allows updating any item, and `" + permissions.ClaimsApprove + "` marking any item claimed or returned.",
+			auth:        authenticated,
+			body:        object("status", oneOf("", "lost", "found", "claimed", "returned")),
+			response:    message("Item status updated successfully"),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/items/:id/image", id: "uploadItemImage", tag: "Items",
+			summary: "Upload an item's image", auth: authenticated, permission: permissions.ItemsCreate,
+			form:     file("image", "JPEG, PNG, GIF or WebP image, at most MAX_IMAGE_SIZE bytes"),
+			response: withMessage("Image uploaded successfully", object("image_url", str("Public URL of the image under /uploads"))),
+			limited:  true, idempotent: true,
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/items/:id/conversations", id: "getItemConversations", tag: "Conversations",
+			summary: "List your conversations about an item", auth: authenticated, permission: permissions.MessagesSend,
+			response: arrayOf(conversation),
+		},
+
+		// Guard
+		{
+			method: fiber.MethodGet, path: "/api/v1/guard/items/stream", id: "streamItems", tag: "Guard",
+			summary: "Follow new and updated items as server-sent events", auth: streamToken, permission: permissions.ItemsViewAll,
+			description: "Sends item.created and item.status_changed events, whose data is the item as JSON, and a heartbeat comment every 15 seconds.",
+			query: []param{
+				query("category", "Only items in this category"),
+				queryOneOf("status", "Only items with this status", "lost", "found", "claimed", "returned"),
+			},
+			response:    str("Stream of events"),
+			contentType: "text/event-stream",
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/guard/items", id: "getGuardItems", tag: "Guard",
+			summary: "List all items", auth: authenticated, permission: permissions.ItemsViewAll,
+			query:    append(itemFilters, paging(10)...),
+			response: page("items", item),
+		},
+
+		// Admin
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/users", id: "getUsers", tag: "Admin",
+			summary: "List users", auth: authenticated, permission: permissions.UsersView,
+			query: append([]param{
+				query("role", "Only users with this role, or all"),
+				query("search", "Only users whose username, email or name contains this text"),
+			}, paging(20)...),
+			response: page("users", user),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/admin/users/:id/role", id: "updateUserRole", tag: "Admin",
+			summary: "Change a user's role", auth: authenticated, permission: permissions.UsersManageRoles,
+			body:     object("role", str("A role with at least one permission, e.g. student, guard or admin")),
+			response: message("User role updated successfully"),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/admin/users/:id/unlock", id: "unlockUser", tag: "Admin",
+			summary: "Unlock an account locked after failed logins", auth: authenticated, permission: permissions.UsersUnlock,
+			response: message("User unlocked successfully"),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/login-attempts", id: "getLoginAttempts", tag: "Admin",
+			summary: "List login attempts", auth: authenticated, permission: permissions.AuditView,
+			query: append([]param{
+				query("username", "Only attempts for this username"),
+				query("ip", "Only attempts from this IP address"),
+				queryOneOf("success", "Only successful or failed attempts", "all", "true", "false"),
+			}, paging(50)...),
+			response: page("login_attempts", r.ref(models.LoginAttempt{})),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/reports", id: "getReports", tag: "Admin",
+			summary: "List reports", auth: authenticated, permission: permissions.ReportsView,
+			query:    append([]param{queryOneOf("status", "Only reports with this status", "all", "pending", "resolved", "dismissed")}, paging(20)...),
+			response: page("reports", extend(r.ref(models.Report{}), object("reporter_username", str(""), "reported_username", str("")))),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/admin/reports/:id/status", id: "updateReportStatus", tag: "Admin",
+			summary: "Resolve or dismiss a report", auth: authenticated, permission: permissions.ReportsResolve,
+			body:     optional(object("status", oneOf("", "pending", "resolved", "dismissed"), "comment", str("Shown to the reporter")), "comment"),
+			response: message("Report status updated successfully"),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/stats", id: "getStats", tag: "Admin",
+			summary: "Count users, items and pending reports", auth: authenticated, permission: permissions.StatsView,
+			response: object(
+				"total_users", integer(""), "student_count", integer(""), "guard_count", integer(""), "admin_count", integer(""),
+				"total_items", integer(""), "lost_items", integer(""), "found_items", integer(""), "claimed_items", integer(""), "returned_items", integer(""),
+				"pending_reports", integer(""),
+			),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/permissions", id: "getPermissions", tag: "Admin",
+			summary: "List permissions and the permissions of each role", auth: authenticated, permission: permissions.PermissionsManage,
+			response: object(
+				"permissions", arrayOf(object("name", str(""), "description", str(""))),
+				"roles", Schema{"type": "object", "additionalProperties": arrayOf(str(""))},
+			),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/admin/roles/:role/permissions", id: "updateRolePermissions", tag: "Admin",
+			summary: "Set a role's permissions", auth: authenticated, permission: permissions.PermissionsManage,
+			description: "Replaces the role's permissions with a non-empty set and records the change, with the previous permissions, in the role_permission_changes audit log.",
+			pathParams:  map[string]string{"role": "Role name, at most 20 characters"},
+			body:        object("permissions", arrayOf(str(""))),
+			response:    withMessage("Role permissions updated successfully", object("role", str(""), "permissions", arrayOf(str("")))),
+		},
+
+		// Webhooks
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/webhooks", id: "getWebhooks", tag: "Webhooks",
+			summary: "List webhooks", auth: authenticated, permission: permissions.WebhooksManage,
+			response: object("webhooks", arrayOf(webhook), "event_types", arrayOf(str("An event a webhook can subscribe to"))),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/admin/webhooks", id: "createWebhook", tag: "Webhooks",
+			summary: "Create a webhook", auth: authenticated, permission: permissions.WebhooksManage,
+			body:     r.ref(models.WebhookRequest{}),
+			status:   fiber.StatusCreated,
+			response: withMessage("Webhook created successfully. Store the secret now, it will not be shown again", object("webhook", webhook, "secret", str("Key of the HMAC signature in X-Webhook-Signature, shown only in this response"))),
+		},
+		{
+			method: fiber.MethodPut, path: "/api/v1/admin/webhooks/:id", id: "updateWebhook", tag: "Webhooks",
+			summary: "Update a webhook", auth: authenticated, permission: permissions.WebhooksManage,
+			body:     r.ref(models.WebhookRequest{}),
+			response: withMessage("Webhook updated successfully", object("webhook", webhook)),
+		},
+		{
+			method: fiber.MethodDelete, path: "/api/v1/admin/webhooks/:id", id: "deleteWebhook", tag: "Webhooks",
+			summary: "Delete a webhook", auth: authenticated, permission: permissions.WebhooksManage,
+			response: message("Webhook deleted successfully"),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/admin/webhooks/:id/test", id: "sendTestWebhook", tag: "Webhooks",
+			summary: "Send a test event to a webhook", auth: authenticated, permission: permissions.WebhooksManage,
+			response: withMessage("Test event sent", object("delivery", r.ref(models.WebhookDelivery{}))),
+		},
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/webhooks/:id/deliveries", id: "getWebhookDeliveries", tag: "Webhooks",
+			summary: "List a webhook's deliveries", auth: authenticated, permission: permissions.WebhooksManage,
+			query:    append([]param{queryOneOf("status", "Only deliveries with this status", "all", "pending", "succeeded", "failed")}, paging(20)...),
+			response: page("deliveries", r.ref(models.WebhookDelivery{})),
+		},
+
+		// API key administration
+		{
+			method: fiber.MethodGet, path: "/api/v1/admin/api-keys", id: "adminGetAPIKeys", tag: "API Keys",
+			summary: "List all API keys", auth: authenticated, permission: permissions.APIKeysManage,
+			query:    append([]param{queryInt("user_id", "Only keys of this user")}, paging(20)...),
+			response: page("api_keys", apiKey),
+		},
+		{
+			method: fiber.MethodPost, path: "/api/v1/admin/users/:id/api-keys", id: "adminCreateAPIKey", tag: "API Keys",
+			summary: "Create an API key for a user", auth: authenticated, permission: permissions.APIKeysManage,
+			pathParams: map[string]string{"id": "ID of the user who will own the key"},
+			body:       r.ref(models.APIKeyRequest{}),
+			status:     fiber.StatusCreated,
+			response:   apiKeyCreated,
+		},
+		{
+			method: fiber.MethodDelete, path: "/api/v1/admin/api-keys/:id", id: "adminRevokeAPIKey", tag: "API Keys",
+			summary: "Revoke any API key", auth: authenticated, permission: permissions.APIKeysManage,
+			response: message("API key revoked successfully"),
+		},
+	}
+}
@@ -0,0 +1,156 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema object, as used by OpenAPI 3.1
+type Schema map[string]any
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// enums lists the values of model fields that hold one of a fixed set of
+// strings, by component and property name
+var enums = map[string][]string{
+	"User.role":                     {"student", "guard", "admin"},
+	"Item.status":                   {"lost", "found", "claimed", "returned"},
+	"ItemRequest.status":            {"lost", "found"},
+	"ConversationParticipant.role":  {"participant", "mediator"},
+	"Report.status":                 {"pending", "resolved", "dismissed"},
+	"LoginAttempt.reason":           {"success", "invalid_password", "unknown_user", "locked", "throttled", "pending"},
+	"UserSettings.message_policy":   {"everyone", "item_related"},
+	"UserSettings.name_visibility":  visibilities,
+	"UserSettings.email_visibility": visibilities,
+	"UserSettings.phone_visibility": visibilities,
+	"WebhookDelivery.status":        {"pending", "succeeded", "failed"},
+}
+
+var visibilities = []string{"everyone", "participants", "nobody"}
+
+// requiredFields lists the fields the handlers require in request payloads,
+// whose other fields are optional although they have no omitempty
+var requiredFields = map[string][]string{
+	"Login":          {"username", "password"},
+	"Register":       {"username", "email", "password"},
+	"ItemRequest":    {"title", "category", "location"},
+	"MessageRequest": {"content"},
+	"ReportRequest":  {"reported_id", "reason"},
+	"APIKeyRequest":  {"name", "permissions"},
+	"WebhookRequest": {"url", "event_types"},
+}
+
+// registry builds the component schemas of the model types referenced by the spec
+type registry struct {
+	schemas map[string]Schema
+}
+
+// ref returns a reference to the component schema of v's struct type,
+// building the component on first use
+func (r *registry) ref(v any) Schema {
+	return r.schema(reflect.TypeOf(v))
+}
+
+// schema describes values of type t as encoding/json marshals them. Named
+// structs become components and are referenced.
+func (r *registry) schema(t reflect.Type) Schema {
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case rawType:
+		return Schema{} // Any JSON value
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(r.schema(t.Elem()))
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": r.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": r.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.object(t, "")
+		}
+		if _, ok := r.schemas[t.Name()]; !ok {
+			r.schemas[t.Name()] = nil // Reserve the name for recursive types
+			r.schemas[t.Name()] = r.object(t, t.Name())
+		}
+		return Schema{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return Schema{}
+}
+
+// object describes a struct's JSON fields. Fields without omitempty are
+// always present and so required.
+func (r *registry) object(t reflect.Type, name string) Schema {
+	properties := Schema{}
+	required := []string{}
+	r.fields(t, name, properties, &required)
+	if fields, ok := requiredFields[name]; ok {
+		required = fields
+	}
+
+	s := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// fields adds the JSON fields of t to properties, including those of embedded structs
+func (r *registry) fields(t reflect.Type, name string, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			r.fields(f.Type, name, properties, required)
+			continue
+		}
+
+		key, options, _ := strings.Cut(tag, ",")
+		if key == "" {
+			key = f.Name
+		}
+		s := r.schema(f.Type)
+		if values, ok := enums[name+"."+key]; ok {
+			s["enum"] = values
+		}
+		properties[key] = s
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, key)
+		}
+	}
+}
+
+// nullable allows null besides the values s describes
+func nullable(s Schema) Schema {
+	switch typ := s["type"].(type) {
+	case string:
+		s["type"] = []string{typ, "null"}
+		return s
+	case nil:
+		if len(s) == 0 {
+			return s // Any value, null included
+		}
+	}
+	return Schema{"anyOf": []Schema{s, {"type": "null"}}}
+}
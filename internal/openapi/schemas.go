@@ -0,0 +1,122 @@
+package openapi
+
+import (
+	"fmt"
+	"slices"
+)
+
+// str describes a string, with an optional description
+func str(description string) Schema {
+	return described(Schema{"type": "string"}, description)
+}
+
+// integer describes an integer, with an optional description
+func integer(description string) Schema {
+	return described(Schema{"type": "integer"}, description)
+}
+
+// boolean describes a boolean, with an optional description
+func boolean(description string) Schema {
+	return described(Schema{"type": "boolean"}, description)
+}
+
+// oneOf describes a string taking one of values
+func oneOf(description string, values ...string) Schema {
+	s := str(description)
+	s["enum"] = values
+	return s
+}
+
+func arrayOf(items Schema) Schema {
+	return Schema{"type": "array", "items": items}
+}
+
+// object describes an object from pairs of property names and schemas. All
+// of its properties are required.
+func object(pairs ...any) Schema {
+	must(len(pairs)%2 == 0, "object: odd number of arguments %v", pairs)
+	properties := Schema{}
+	required := []string{}
+	for i := 0; i < len(pairs); i += 2 {
+		name := pairs[i].(string)
+		properties[name] = pairs[i+1]
+		required = append(required, name)
+	}
+	return Schema{"type": "object", "properties": properties, "required": required}
+}
+
+// optional marks properties of an object schema as not required
+func optional(s Schema, names ...string) Schema {
+	required := []string{}
+	for _, name := range s["required"].([]string) {
+		if !slices.Contains(names, name) {
+			required = append(required, name)
+		}
+	}
+	s["required"] = required
+	return s
+}
+
+// extend adds the properties of an object schema to a referenced component
+func extend(base, extra Schema) Schema {
+	return Schema{"allOf": []Schema{base, extra}}
+}
+
+// message describes the {"message": ...} confirmation most changes respond with
+func message(text string) Schema {
+	return object("message", Schema{"type": "string", "examples": []string{text}})
+}
+
+// withMessage adds a confirmation message to an object schema
+func withMessage(text string, s Schema) Schema {
+	s["properties"].(Schema)["message"] = Schema{"type": "string", "examples": []string{text}}
+	s["required"] = append([]string{"message"}, s["required"].([]string)...)
+	return s
+}
+
+// page describes a page of records under key, with its PageMeta
+func page(key string, items Schema) Schema {
+	return object(key, arrayOf(items), "meta", Schema{"$ref": "#/components/schemas/PageMeta"})
+}
+
+// file describes a multipart form holding one uploaded file in field
+func file(field, description string) Schema {
+	return object(field, Schema{"type": "string", "contentMediaType": "application/octet-stream", "description": description})
+}
+
+// query describes an optional string query parameter
+func query(name, description string) param {
+	return param{name: name, description: description, schema: str("")}
+}
+
+// queryInt describes an optional integer query parameter
+func queryInt(name, description string) param {
+	return param{name: name, description: description, schema: integer("")}
+}
+
+// queryOneOf describes an optional query parameter taking one of values
+func queryOneOf(name, description string, values ...string) param {
+	return param{name: name, description: description, schema: oneOf("", values...)}
+}
+
+// paging describes the page and limit parameters of a paginated list
+func paging(limit int) []param {
+	return []param{
+		{name: "page", description: "Page to return, from 1", schema: Schema{"type": "integer", "minimum": 1, "default": 1}},
+		{name: "limit", description: "Records per page", schema: Schema{"type": "integer", "minimum": 1, "default": limit}},
+	}
+}
+
+func described(s Schema, description string) Schema {
+	if description != "" {
+		s["description"] = description
+	}
+	return s
+}
+
+// must panics on a mistake in the operations table
+func must(ok bool, format string, args ...any) {
+	if !ok {
+		panic(fmt.Sprintf(format, args...))
+	}
+}
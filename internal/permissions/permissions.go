@@ -0,0 +1,242 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database"
+)
+
+// Named permissions checked by routes and controllers
+const (
+	ProfileManage        = "profile:manage"
+	ItemsCreate          = "items:create"
+	ItemsUpdateAny       = "items:update_any"
+	ItemsViewAll         = "items:view_all"
+	ClaimsApprove        = "claims:approve"
+	MessagesSend         = "messages:send"
+	ReportsCreate        = "reports:create"
+	ReportsView          = "reports:view"
+	ReportsResolve       = "reports:resolve"
+	UsersView            = "users:view"
+	UsersManageRoles     = "users:manage_roles"
+	UsersUnlock          = "users:unlock"
+	AuditView            = "audit:view"
+	StatsView            = "stats:view"
+	PermissionsManage    = "permissions:manage"
+	APIKeysCreate        = "api_keys:create"
+	APIKeysManage        = "api_keys:manage"
+	ConversationsMediate = "conversations:mediate"
+	WebhooksManage       = "webhooks:manage"
+)
+
+// Definition describes a permission and the roles that receive it by default
+type Definition struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	DefaultRoles []string `json:"-"`
+}
+
+var (
+	student = []string{"student", "guard", "admin"}
+	guard   = []string{"guard", "admin"}
+	admin   = []string{"admin"}
+)
+
+// All is the catalog of permissions known to the application
+var All = []Definition{
+	{ProfileManage, "View and update your own profile, password and items", student},
+	{ItemsCreate, "Report lost and found items, upload their images and update their status", student},
+	{ItemsUpdateAny, "Update the status of any item", guard},
+	{ItemsViewAll, "Use the guard item listing", guard},
+	{ClaimsApprove, "Mark any item as claimed or returned", guard},
+	{MessagesSend, "Send and read messages", student},
+	{ReportsCreate, "Report users for abuse", student},
+	{ReportsView, "View abuse reports", admin},
+	{ReportsResolve, "Resolve or dismiss abuse reports", admin},
+	{UsersView, "List users", admin},
+	{UsersManageRoles, "Change user roles", admin},
+	{UsersUnlock, "Unlock accounts locked after failed logins", admin},
+	{AuditView, "View the login attempt audit log", admin},
+	{StatsView, "View dashboard statistics", admin},
+	{PermissionsManage, "Edit the role to permission mapping", admin},
+	{APIKeysCreate, "Create and revoke your own API keys", student},
+	{APIKeysManage, "Create and revoke API keys for any user", admin},
+	{ConversationsMediate, "View item conversations and join them as a mediator", guard},
+	{WebhooksManage, "Register outbound webhooks and view their deliveries", admin},
+}
+
+// cacheTTL bounds how long a role mapping changed by another instance may be stale
+const cacheTTL = time.Minute
+
+var (
+	mu       sync.RWMutex
+	roles    map[string]map[string]bool
+	loadedAt time.Time
+)
+
+// Seed adds any permissions missing from the database and grants them to
+// their default roles. Permissions that already exist are left untouched so
+// that edits made by admins are preserved.
+func Seed(ctx context.Context) error {
+	for _, def := range All {
+		result, err := database.DB.ExecContext(ctx, `
+			INSERT INTO permissions (name, description) VALUES ($1, $2)
+			ON CONFLICT (name) DO NOTHING
+		`, def.Name, def.Description)
+		if err != nil {
+			return fmt.Errorf("seeding permission %s: %w", def.Name, err)
+		}
+
+		// Only grant defaults the first time a permission is seen
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			continue
+		}
+		for _, role := range def.DefaultRoles {
+			_, err := database.DB.ExecContext(ctx, `
+				INSERT INTO role_permissions (role, permission) VALUES ($1, $2)
+				ON CONFLICT DO NOTHING
+			`, role, def.Name)
+			if err != nil {
+				return fmt.Errorf("granting %s to %s: %w", def.Name, role, err)
+			}
+		}
+	}
+
+	return Reload(ctx)
+}
+
+// Reload refreshes the cached role to permission mapping from the database
+func Reload(ctx context.Context) error {
+	var rows []struct {
+		Role       string `db:"role"`
+		Permission string `db:"permission"`
+	}
+	err := database.DB.SelectContext(ctx, &rows, "SELECT role, permission FROM role_permissions")
+	if err != nil {
+		return err
+	}
+
+	mapping := map[string]map[string]bool{}
+	for _, row := range rows {
+		if mapping[row.Role] == nil {
+			mapping[row.Role] = map[string]bool{}
+		}
+		mapping[row.Role][row.Permission] = true
+	}
+
+	mu.Lock()
+	roles = mapping
+	loadedAt = time.Now()
+	mu.Unlock()
+	return nil
+}
+
+// snapshot returns the cached mapping, reloading it once it is stale
+func snapshot(ctx context.Context) map[string]map[string]bool {
+	mu.RLock()
+	mapping, stale := roles, time.Since(loadedAt) > cacheTTL
+	mu.RUnlock()
+
+	if stale || mapping == nil {
+		if err := Reload(ctx); err != nil {
+			slog.ErrorContext(ctx, "Error reloading role permissions", "error", err)
+			return mapping
+		}
+		mu.RLock()
+		mapping = roles
+		mu.RUnlock()
+	}
+	return mapping
+}
+
+// Has reports whether the role has been granted the permission
+func Has(ctx context.Context, role, permission string) bool {
+	return snapshot(ctx)[role][permission]
+}
+
+// ForRole returns the sorted permissions granted to a role
+func ForRole(ctx context.Context, role string) []string {
+	perms := []string{}
+	for perm := range snapshot(ctx)[role] {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// Roles returns every role with its sorted permissions
+func Roles(ctx context.Context) map[string][]string {
+	result := map[string][]string{}
+	for role := range snapshot(ctx) {
+		result[role] = ForRole(ctx, role)
+	}
+	return result
+}
+
+// RoleExists reports whether any permission has been granted to the role
+func RoleExists(ctx context.Context, role string) bool {
+	_, ok := snapshot(ctx)[role]
+	return ok
+}
+
+// Valid reports whether the permission is part of the catalog
+func Valid(permission string) bool {
+	for _, def := range All {
+		if def.Name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRolePermissions replaces the permissions granted to a role and records
+// the change, with the role's previous permissions, in the
+// role_permission_changes audit log
+func SetRolePermissions(ctx context.Context, role string, perms []string, changedBy int) error {
+	tx, err := database.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous []string
+	err = tx.SelectContext(ctx, &previous, "SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission", role)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role = $1", role)
+	if err != nil {
+		return err
+	}
+	for _, perm := range perms {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (role, permission) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, role, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	granted := append([]string(nil), perms...)
+	sort.Strings(granted)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO role_permission_changes (role, previous_permissions, permissions, changed_by, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, role, strings.Join(previous, ","), strings.Join(granted, ","), changedBy, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return Reload(ctx)
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneEvery is how often the memory store forgets buckets that have filled up
+const pruneEvery = time.Minute
+
+// Memory keeps buckets in this process, so each API instance limits on its own
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	idle    time.Duration
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, pruned: time.Now()}
+}
+
+// Take implements Store
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.pruned) >= pruneEvery {
+		m.prune(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, idle: idleAfter(limit)}
+		m.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, result = take(b.tokens, b.updated, now, limit)
+	b.updated = now
+	return result, nil
+}
+
+// prune removes buckets that are full again
+func (m *Memory) prune(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) >= b.idle {
+			delete(m.buckets, key)
+		}
+	}
+	m.pruned = now
+}
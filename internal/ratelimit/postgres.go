@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+)
+
+// staleBucket is how long a bucket is kept after its last request. Buckets
+// of the configured limits are full again well before then.
+const staleBucket = 24 * time.Hour
+
+// Postgres keeps buckets in the rate_limits table so that every API instance
+// shares them. It works with the embedded SQLite driver as well.
+type Postgres struct {
+	db *sqlx.DB
+}
+
+// NewPostgres returns a store backed by the database
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db}
+}
+
+// Take implements Store. The bucket's row is created full if it is missing and
+// then locked while it is updated, so that concurrent requests from several
+// instances each take their own token, even from a new bucket.
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO rate_limits (key, tokens, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING
+	`, key, float64(limit.Burst), now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var b struct {
+		Tokens    float64   `db:"tokens"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	err = tx.GetContext(ctx, &b, "SELECT tokens, updated_at FROM rate_limits WHERE key = $1 FOR UPDATE", key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	tokens, result := take(b.Tokens, b.UpdatedAt, now, limit)
+	_, err = tx.ExecContext(ctx, "UPDATE rate_limits SET tokens = $1, updated_at = $2 WHERE key = $3", tokens, now, key)
+	if err != nil {
+		return Result{}, err
+	}
+	return result, tx.Commit()
+}
+
+// RunCleanup deletes buckets unused for staleBucket every hour until ctx is cancelled
+func (p *Postgres) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		worker.Beat(ctx, time.Hour)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			_, err := p.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE updated_at < $1", start.Add(-staleBucket))
+			if err != nil {
+				slog.Error("Error cleaning up rate limits", "error", err)
+			}
+			metrics.ObserveJob("rate-limit-cleanup", start)
+		}
+	}
+}
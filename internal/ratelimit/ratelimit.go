@@ -0,0 +1,94 @@
+// Package ratelimit implements token-bucket rate limits with buckets kept in
+// memory for a single instance or in the database to share them between
+// instances.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Requests per Per on average, with bursts of up to Burst
+// requests after a quiet period
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// PerMinute returns a limit of requests a minute with the given burst, which
+// defaults to requests when it is zero
+func PerMinute(requests, burst int) Limit {
+	if burst <= 0 {
+		burst = requests
+	}
+	return Limit{Requests: requests, Per: time.Minute, Burst: burst}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// rate is the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Remaining int           // Whole tokens left after this request
+	Reset     time.Duration // Time until the bucket is full again
+	// RetryAfter is how long to wait for the next token when not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets by key
+type Store interface {
+	// Take removes a token from the bucket for key, if one is left
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// store is the Store used by the middleware, set with Use
+var store Store = NewMemory()
+
+// Use sets the store the rate limits are kept in
+func Use(s Store) {
+	store = s
+}
+
+// Take removes a token from the bucket for key in the store set with Use
+func Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	return store.Take(ctx, key, limit)
+}
+
+// take refills a bucket that held tokens at updated, then removes a token if
+// one is left. It returns the new token count.
+func take(tokens float64, updated, now time.Time, limit Limit) (float64, Result) {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.rate())
+	}
+
+	result := Result{Allowed: tokens >= 1}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = secondsToDuration((1 - tokens) / limit.rate())
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = secondsToDuration((burst - tokens) / limit.rate())
+	return tokens, result
+}
+
+// idleAfter is how long a bucket takes to fill up, after which it can be
+// forgotten because a new bucket starts full
+func idleAfter(limit Limit) time.Duration {
+	return secondsToDuration(float64(limit.Burst) / limit.rate())
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+)
+
+func TestTake(t *testing.T) {
+	limit := PerMinute(60, 3) // A token a second, up to 3
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		allowed    bool
+		left       float64
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{"full bucket", 3, 0, true, 2, 2, 0},
+		{"last token", 1, 0, true, 0, 0, 0},
+		{"empty", 0, 0, false, 0, 0, time.Second},
+		{"half refilled", 0, 500 * time.Millisecond, false, 0.5, 0, 500 * time.Millisecond},
+		{"refilled", 0, 1500 * time.Millisecond, true, 0.5, 0, 0},
+		{"refill capped at burst", 1, time.Hour, true, 2, 2, 0},
+		{"clock went back", 1, -time.Minute, true, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, result := take(tt.tokens, start, start.Add(tt.elapsed), limit)
+			if result.Allowed != tt.allowed || left != tt.left || result.Remaining != tt.remaining {
+				t.Errorf("allowed %v with %v tokens left (remaining %d), want %v with %v (%d)",
+					result.Allowed, left, result.Remaining, tt.allowed, tt.left, tt.remaining)
+			}
+			if result.RetryAfter != tt.retryAfter {
+				t.Errorf("retry after %v, want %v", result.RetryAfter, tt.retryAfter)
+			}
+			if want := time.Duration((3 - left) * float64(time.Second)); result.Reset != want {
+				t.Errorf("reset after %v, want %v", result.Reset, want)
+			}
+		})
+	}
+}
+
+func TestPerMinute(t *testing.T) {
+	if limit := PerMinute(30, 0); limit.Burst != 30 || !limit.Enabled() {
+		t.Errorf("PerMinute(30, 0) = %+v, want a burst of 30", limit)
+	}
+	if PerMinute(0, 10).Enabled() {
+		t.Error("a limit of 0 requests is enabled")
+	}
+}
+
+func TestStores(t *testing.T) {
+	for _, backend := range []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{"memory", func(t *testing.T) Store { return NewMemory() }},
+		{"sqlite", func(t *testing.T) Store { return NewPostgres(databasetest.Open(t)) }},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			ctx := context.Background()
+			limit := Limit{Requests: 1, Per: time.Hour, Burst: 2}
+
+			for i, want := range []bool{true, true, false} {
+				result, err := store.Take(ctx, "ip:192.0.2.1", limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Allowed != want {
+					t.Fatalf("request %d: allowed %v, want %v", i+1, result.Allowed, want)
+				}
+				if !want && result.RetryAfter <= 0 {
+					t.Errorf("request %d: no Retry-After", i+1)
+				}
+			}
+
+			// Every key has its own bucket
+			result, err := store.Take(ctx, "ip:192.0.2.2", limit)
+			if err != nil || !result.Allowed || result.Remaining != 1 {
+				t.Errorf("other key: %+v, error %v", result, err)
+			}
+		})
+	}
+}
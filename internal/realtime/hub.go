@@ -0,0 +1,189 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database"
+)
+
+// Event types pushed to connected clients
+const (
+	MessageNew  = "message.new"
+	MessageRead = "message.read"
+	Typing      = "typing"
+
+	NotificationNew = "notification.new"
+
+	ConversationParticipantAdded = "conversation.participant_added"
+)
+
+// notifyChannel is the PostgreSQL channel used to fan events out to every API instance
+const notifyChannel = "realtime_events"
+
+// maxNotifyPayload keeps NOTIFY payloads under PostgreSQL's 8000 byte limit
+const maxNotifyPayload = 7900
+
+// Event is a message pushed to the connected clients of a set of users
+type Event struct {
+	Type    string          `json:"type"`
+	UserIDs []int           `json:"user_ids,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Refetch bool            `json:"refetch,omitempty"` // Set when data was too large to broadcast
+}
+
+// Client is a single websocket connection belonging to a user
+type Client struct {
+	UserID int
+	send   chan []byte
+	once   sync.Once
+}
+
+// Send returns the channel of encoded events for the client's writer
+func (cl *Client) Send() <-chan []byte {
+	return cl.send
+}
+
+var (
+	mu        sync.RWMutex
+	clients   = map[int]map[*Client]bool{}
+	listening bool
+)
+
+// Register adds a connection for the user and returns its client
+func Register(userID int) *Client {
+	cl := &Client{UserID: userID, send: make(chan []byte, 32)}
+
+	mu.Lock()
+	if clients[userID] == nil {
+		clients[userID] = map[*Client]bool{}
+	}
+	clients[userID][cl] = true
+	mu.Unlock()
+
+	return cl
+}
+
+// Unregister removes a connection and closes its send channel
+func Unregister(cl *Client) {
+	mu.Lock()
+	delete(clients[cl.UserID], cl)
+	if len(clients[cl.UserID]) == 0 {
+		delete(clients, cl.UserID)
+	}
+	mu.Unlock()
+
+	cl.once.Do(func() { close(cl.send) })
+}
+
+// Publish pushes an event to every connection of the given users on all instances
+func Publish(eventType string, data interface{}, userIDs ...int) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Error encoding realtime event", "error", err)
+		return
+	}
+	event := Event{Type: eventType, UserIDs: userIDs, Data: raw}
+
+	mu.RLock()
+	viaDatabase := listening
+	mu.RUnlock()
+
+	// Without a listener only this instance's clients can be reached
+	if !viaDatabase {
+		deliver(event)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding realtime event", "error", err)
+		return
+	}
+	if len(payload) > maxNotifyPayload {
+		// Ask clients to refetch rather than dropping the event
+		payload, _ = json.Marshal(Event{Type: eventType, UserIDs: userIDs, Refetch: true})
+	}
+
+	_, err = database.DB.Exec("SELECT pg_notify($1, $2)", notifyChannel, string(payload))
+	if err != nil {
+		slog.Error("Error publishing realtime event", "error", err)
+		deliver(event)
+	}
+}
+
+// Listen subscribes to events published by all API instances. It returns once
+// the listener is established and delivers events in the background until
+// ctx is cancelled.
+func Listen(ctx context.Context) error {
+	listener, err := database.NewListener()
+	if err != nil {
+		return err
+	}
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	mu.Lock()
+	listening = true
+	mu.Unlock()
+
+	go func() {
+		defer func() {
+			mu.Lock()
+			listening = false
+			mu.Unlock()
+			listener.Close()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				// A nil notification means the connection was re-established
+				if n == nil {
+					continue
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+					slog.Warn("Error decoding realtime event", "error", err)
+					continue
+				}
+				deliver(event)
+			case <-time.After(90 * time.Second):
+				// Check the connection is still alive
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// deliver sends an event to this instance's connections for its users
+func deliver(event Event) {
+	userIDs := event.UserIDs
+	event.UserIDs = nil
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding realtime event", "error", err)
+		return
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, userID := range userIDs {
+		for cl := range clients[userID] {
+			select {
+			case cl.send <- payload:
+			default:
+				// Drop events for clients that are not keeping up
+				slog.Warn("Dropping realtime event for slow client", "user_id", userID)
+			}
+		}
+	}
+}
@@ -0,0 +1,1250 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+// Memory keeps every repository's records in memory so that handlers can be
+// exercised with net/http/httptest without a database. Events that would be
+// written to the outbox are kept in order and returned by Events.
+type Memory struct {
+	mu                sync.Mutex
+	users             []models.User
+	items             []models.Item
+	images            []models.Image
+	messages          []models.Message
+	reports           []models.Report
+	conversations     []models.Conversation
+	participants      []models.ConversationParticipant
+	blocks            []models.UserBlock
+	settings          map[int]models.UserSettings
+	emailFrequencies  map[int]string
+	notifications     []models.Notification
+	notificationPrefs map[int]map[string]bool
+	apiKeys           []models.APIKey
+	webhooks          []models.Webhook
+	deliveries        []models.WebhookDelivery
+	loginAttempts     []models.LoginAttempt
+	events            []events.Event
+	lastIDs           map[string]int
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		settings:          map[int]models.UserSettings{},
+		emailFrequencies:  map[int]string{},
+		notificationPrefs: map[int]map[string]bool{},
+		lastIDs:           map[string]int{},
+	}
+}
+
+// Repositories returns repositories backed by the store
+func (m *Memory) Repositories() Repositories {
+	return Repositories{
+		Items:         &memoryItems{m},
+		Users:         &memoryUsers{m},
+		Messages:      &memoryMessages{m},
+		Reports:       &memoryReports{m},
+		Conversations: &memoryConversations{m},
+		Privacy:       &memoryPrivacy{m},
+		Notifications: &memoryNotifications{m},
+		APIKeys:       &memoryAPIKeys{m},
+		Webhooks:      &memoryWebhooks{m},
+		LoginAttempts: &memoryLoginAttempts{m},
+		Stats:         &memoryStats{m},
+	}
+}
+
+// Events returns the events recorded so far, oldest first
+func (m *Memory) Events() []events.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]events.Event(nil), m.events...)
+}
+
+// id returns the next ID in a table, numbered from 1 like a SERIAL column.
+// The caller must hold m.mu.
+func (m *Memory) id(table string) int {
+	m.lastIDs[table]++
+	return m.lastIDs[table]
+}
+
+// record keeps events as Record would write them. The caller must hold m.mu.
+func (m *Memory) record(pending ...pendingEvent) error {
+	for _, p := range pending {
+		raw, err := json.Marshal(p.Data)
+		if err != nil {
+			return err
+		}
+		m.events = append(m.events, events.Event{ID: events.NewID(), Type: p.Type, Time: time.Now(), Data: raw})
+	}
+	return nil
+}
+
+// page returns the records in [offset, offset+limit) of n records
+func page(n, limit, offset int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit >= 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// containsFold reports whether s contains substr, ignoring case like ILIKE
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// memoryItems implements ItemRepository
+type memoryItems struct {
+	m *Memory
+}
+
+func (r *memoryItems) Create(ctx context.Context, item *models.Item) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	item.ID = r.m.id("items")
+	r.m.items = append(r.m.items, *item)
+	return r.m.record(pendingEvent{events.ItemCreated, *item})
+}
+
+func (r *memoryItems) Get(ctx context.Context, id int) (models.Item, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if i := r.find(id); i >= 0 {
+		return r.m.items[i], nil
+	}
+	return models.Item{}, ErrNotFound
+}
+
+func (r *memoryItems) Exists(ctx context.Context, id int) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.find(id) >= 0, nil
+}
+
+func (r *memoryItems) List(ctx context.Context, filter ItemFilter) ([]models.Item, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []models.Item{}
+	for _, item := range r.m.items {
+		if filter.Status != "" && item.Status != filter.Status {
+			continue
+		}
+		if filter.Category != "" && item.Category != filter.Category {
+			continue
+		}
+		if filter.Search != "" && !containsFold(item.Title, filter.Search) && !containsFold(item.Description, filter.Search) {
+			continue
+		}
+		if filter.OwnerID != 0 && !isOwner(item, filter.OwnerID) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), filter.Limit, filter.Offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryItems) UpdateStatus(ctx context.Context, id int, status string, changedBy int, authorize func(item models.Item) error) (models.Item, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return models.Item{}, ErrNotFound
+	}
+	previous := r.m.items[i]
+	if err := authorize(previous); err != nil {
+		return models.Item{}, err
+	}
+
+	now := time.Now()
+	item := previous
+	item.Status = status
+	item.UpdatedAt = now
+	if status == "claimed" {
+		item.ClaimedTime = &now
+	}
+	r.m.items[i] = item
+	return item, r.m.record(statusEvents(previous, item, changedBy)...)
+}
+
+func (r *memoryItems) SetImage(ctx context.Context, id int, imageURL string) (models.Item, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return models.Item{}, ErrNotFound
+	}
+
+	now := time.Now()
+	r.m.images = append(r.m.images, models.Image{ID: r.m.id("images"), ItemID: id, ImageURL: imageURL, Timestamp: &now, CreatedAt: now})
+	r.m.items[i].ImageURL = &imageURL
+	r.m.items[i].UpdatedAt = now
+	return r.m.items[i], r.m.record(pendingEvent{events.ItemUpdated, r.m.items[i]})
+}
+
+// find returns the index of the item, or -1. The caller must hold r.m.mu.
+func (r *memoryItems) find(id int) int {
+	for i, item := range r.m.items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// isOwner reports whether the user reported or found the item
+func isOwner(item models.Item, userID int) bool {
+	return (item.ReporterID != nil && *item.ReporterID == userID) || (item.FinderID != nil && *item.FinderID == userID)
+}
+
+// memoryUsers implements UserRepository
+type memoryUsers struct {
+	m *Memory
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	user.ID = r.m.id("users")
+	r.m.users = append(r.m.users, *user)
+	return nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id int) (models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if i := r.find(id); i >= 0 {
+		return r.m.users[i], nil
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUsers) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, user := range r.m.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUsers) Exists(ctx context.Context, id int) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.find(id) >= 0, nil
+}
+
+func (r *memoryUsers) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	_, err := r.GetByUsername(ctx, username)
+	return err == nil, nil
+}
+
+func (r *memoryUsers) EmailTaken(ctx context.Context, email string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, user := range r.m.users {
+		if user.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryUsers) List(ctx context.Context, filter UserFilter) ([]models.User, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []models.User{}
+	for _, user := range r.m.users {
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Search != "" && !containsFold(user.Username, filter.Search) && !containsFold(user.Email, filter.Search) &&
+			!containsFold(user.FirstName, filter.Search) && !containsFold(user.LastName, filter.Search) {
+			continue
+		}
+		matched = append(matched, user)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), filter.Limit, filter.Offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryUsers) UpdateProfile(ctx context.Context, id int, update ProfileUpdate) error {
+	return r.update(id, func(user *models.User) {
+		user.FirstName, user.LastName, user.Phone, user.Email = update.FirstName, update.LastName, update.Phone, update.Email
+		user.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryUsers) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	return r.update(id, func(user *models.User) {
+		user.PasswordHash = passwordHash
+		user.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryUsers) SetRole(ctx context.Context, id int, role string) error {
+	return r.update(id, func(user *models.User) {
+		user.Role = role
+		user.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryUsers) AddLoginFailure(ctx context.Context, id int) (int, error) {
+	var count int
+	err := r.update(id, func(user *models.User) {
+		user.FailedLoginCount++
+		count = user.FailedLoginCount
+	})
+	return count, err
+}
+
+func (r *memoryUsers) LockUntil(ctx context.Context, id int, until time.Time) error {
+	return r.update(id, func(user *models.User) {
+		if user.LockedUntil == nil || user.LockedUntil.Before(until) {
+			user.LockedUntil = &until
+		}
+	})
+}
+
+func (r *memoryUsers) ResetLoginFailures(ctx context.Context, id int) error {
+	return r.update(id, func(user *models.User) {
+		user.FailedLoginCount, user.LockedUntil = 0, nil
+	})
+}
+
+func (r *memoryUsers) Unlock(ctx context.Context, id int) error {
+	return r.update(id, func(user *models.User) {
+		user.FailedLoginCount, user.LockedUntil = 0, nil
+		user.UpdatedAt = time.Now()
+	})
+}
+
+// update changes a user with fn, or returns ErrNotFound
+func (r *memoryUsers) update(id int, fn func(user *models.User)) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	fn(&r.m.users[i])
+	return nil
+}
+
+// find returns the index of the user, or -1. The caller must hold r.m.mu.
+func (r *memoryUsers) find(id int) int {
+	for i, user := range r.m.users {
+		if user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// username returns a user's username, or "". The caller must hold r.m.mu.
+func (m *Memory) username(id int) string {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user.Username
+		}
+	}
+	return ""
+}
+
+// memoryMessages implements MessageRepository
+type memoryMessages struct {
+	m *Memory
+}
+
+func (r *memoryMessages) Create(ctx context.Context, message *models.Message) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	message.ID = r.m.id("messages")
+	for i := range message.Attachments {
+		message.Attachments[i].ID = r.m.id("message_attachments")
+		message.Attachments[i].MessageID = message.ID
+	}
+	stored := *message
+	stored.Attachments = append([]models.MessageAttachment(nil), message.Attachments...)
+	r.m.messages = append(r.m.messages, stored)
+
+	if message.ConversationID != nil {
+		for i := range r.m.conversations {
+			if r.m.conversations[i].ID == *message.ConversationID {
+				r.m.conversations[i].UpdatedAt = message.CreatedAt
+			}
+		}
+	}
+	return r.m.record(pendingEvent{events.MessageCreated, *message})
+}
+
+func (r *memoryMessages) ListInConversation(ctx context.Context, conversationID, limit, offset int) ([]MessageWithSender, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []MessageWithSender{}
+	for _, message := range r.m.messages {
+		if message.ConversationID != nil && *message.ConversationID == conversationID {
+			matched = append(matched, MessageWithSender{Message: message, SenderUsername: r.m.username(message.SenderID)})
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), limit, offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryMessages) ListBetween(ctx context.Context, userID, otherUserID int, itemID *int, limit, offset int) ([]MessageWithSender, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []MessageWithSender{}
+	for _, message := range r.m.messages {
+		if message.ReceiverID == nil {
+			continue
+		}
+		between := (message.SenderID == userID && *message.ReceiverID == otherUserID) ||
+			(message.SenderID == otherUserID && *message.ReceiverID == userID)
+		if !between || (itemID != nil && (message.ItemID == nil || *message.ItemID != *itemID)) {
+			continue
+		}
+		matched = append(matched, MessageWithSender{Message: message, SenderUsername: r.m.username(message.SenderID)})
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), limit, offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryMessages) UnreadCount(ctx context.Context, userID int) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	count := 0
+	for _, message := range r.m.messages {
+		if message.ConversationID == nil || message.SenderID == userID || r.m.blocked(userID, message.SenderID) {
+			continue
+		}
+		if i := r.m.participant(*message.ConversationID, userID); i >= 0 && unread(message, r.m.participants[i]) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryMessages) MarkRead(ctx context.Context, userID, otherUserID int) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var marked int64
+	for i, message := range r.m.messages {
+		if message.ReceiverID != nil && *message.ReceiverID == userID && message.SenderID == otherUserID && !message.Read {
+			r.m.messages[i].Read = true
+			marked++
+		}
+	}
+
+	// Advance the read position of the conversations shared with the other user
+	now := time.Now()
+	key := participantKey(userID, otherUserID)
+	for _, conversation := range r.m.conversations {
+		if i := r.m.participant(conversation.ID, userID); i >= 0 && conversation.ParticipantKey == key {
+			r.m.participants[i].LastReadAt = &now
+		}
+	}
+	return marked, nil
+}
+
+func (r *memoryMessages) Attachment(ctx context.Context, id int) (models.MessageAttachment, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, message := range r.m.messages {
+		for _, attachment := range message.Attachments {
+			if attachment.ID == id {
+				return attachment, nil
+			}
+		}
+	}
+	return models.MessageAttachment{}, ErrNotFound
+}
+
+func (r *memoryMessages) Attachments(ctx context.Context, messageIDs []int) ([]models.MessageAttachment, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	wanted := map[int]bool{}
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+	attachments := []models.MessageAttachment{}
+	for _, message := range r.m.messages {
+		if wanted[message.ID] {
+			attachments = append(attachments, message.Attachments...)
+		}
+	}
+	sort.SliceStable(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+// unread reports whether a message is newer than the participant's read position
+func unread(message models.Message, participant models.ConversationParticipant) bool {
+	return participant.LastReadAt == nil || message.CreatedAt.After(*participant.LastReadAt)
+}
+
+// memoryReports implements ReportRepository
+type memoryReports struct {
+	m *Memory
+}
+
+func (r *memoryReports) Create(ctx context.Context, report *models.Report) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	report.ID = r.m.id("reports")
+	r.m.reports = append(r.m.reports, *report)
+	return r.m.record(pendingEvent{events.ReportCreated, *report})
+}
+
+func (r *memoryReports) List(ctx context.Context, status string, limit, offset int) ([]ReportWithUsernames, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []ReportWithUsernames{}
+	for _, report := range r.m.reports {
+		if status != "" && report.Status != status {
+			continue
+		}
+		entry := ReportWithUsernames{Report: report, ReportedUsername: r.m.username(report.ReportedID)}
+		if report.ReporterID != nil {
+			entry.ReporterUsername = r.m.username(*report.ReporterID)
+		}
+		matched = append(matched, entry)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), limit, offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryReports) UpdateStatus(ctx context.Context, id int, status, comment string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for i := range r.m.reports {
+		report := &r.m.reports[i]
+		if report.ID != id {
+			continue
+		}
+		report.Status, report.AdminComment, report.UpdatedAt = status, &comment, time.Now()
+		if status == "pending" {
+			return nil
+		}
+		return r.m.record(pendingEvent{events.ReportResolved, ReportResolution{
+			ReportID:   id,
+			ReporterID: report.ReporterID,
+			Status:     status,
+			Comment:    comment,
+		}})
+	}
+	return ErrNotFound
+}
+
+// participant returns the index of the user's participation in a
+// conversation, or -1. The caller must hold m.mu.
+func (m *Memory) participant(conversationID, userID int) int {
+	for i, p := range m.participants {
+		if p.ConversationID == conversationID && p.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// blocked reports whether blockerID has blocked blockedID. The caller must hold m.mu.
+func (m *Memory) blocked(blockerID, blockedID int) bool {
+	for _, block := range m.blocks {
+		if block.BlockerID == blockerID && block.BlockedID == blockedID {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryConversations implements ConversationRepository
+type memoryConversations struct {
+	m *Memory
+}
+
+func (r *memoryConversations) FindOrCreate(ctx context.Context, itemID *int, userID, otherUserID int) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	key := participantKey(userID, otherUserID)
+	for _, conversation := range r.m.conversations {
+		if conversation.ParticipantKey == key && sameItem(conversation.ItemID, itemID) {
+			return conversation.ID, nil
+		}
+	}
+
+	now := time.Now()
+	conversation := models.Conversation{ID: r.m.id("conversations"), ItemID: itemID, ParticipantKey: key, CreatedBy: &userID, CreatedAt: now, UpdatedAt: now}
+	r.m.conversations = append(r.m.conversations, conversation)
+	for _, id := range []int{userID, otherUserID} {
+		r.m.participants = append(r.m.participants, models.ConversationParticipant{ConversationID: conversation.ID, UserID: id, Role: "participant", JoinedAt: now})
+	}
+	return conversation.ID, nil
+}
+
+func (r *memoryConversations) Get(ctx context.Context, id int) (models.Conversation, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, conversation := range r.m.conversations {
+		if conversation.ID == id {
+			return conversation, nil
+		}
+	}
+	return models.Conversation{}, ErrNotFound
+}
+
+func (r *memoryConversations) List(ctx context.Context, filter ConversationFilter) ([]models.ConversationSummary, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	conversations := []models.ConversationSummary{}
+	for _, conversation := range r.m.conversations {
+		if filter.ItemID != nil && !sameItem(conversation.ItemID, filter.ItemID) {
+			continue
+		}
+		p := r.m.participant(conversation.ID, filter.UserID)
+		if p < 0 && !(filter.All && filter.ItemID != nil) {
+			continue
+		}
+		if !filter.All && r.blocksParticipant(filter.UserID, conversation.ID) {
+			continue
+		}
+
+		summary := models.ConversationSummary{ID: conversation.ID, ItemID: conversation.ItemID, UpdatedAt: conversation.UpdatedAt}
+		if conversation.ItemID != nil {
+			if i := (&memoryItems{r.m}).find(*conversation.ItemID); i >= 0 {
+				item := r.m.items[i]
+				summary.ItemTitle, summary.ItemImageURL, summary.ItemStatus = &item.Title, item.ImageURL, &item.Status
+			}
+		}
+		if p >= 0 {
+			role := r.m.participants[p].Role
+			summary.MyRole = &role
+		}
+
+		var latest *models.Message
+		for i, message := range r.m.messages {
+			if message.ConversationID == nil || *message.ConversationID != conversation.ID {
+				continue
+			}
+			if latest == nil || !message.CreatedAt.Before(latest.CreatedAt) {
+				latest = &r.m.messages[i]
+			}
+			if p >= 0 && message.SenderID != filter.UserID && unread(message, r.m.participants[p]) {
+				summary.UnreadCount++
+			}
+		}
+		if latest != nil {
+			summary.LatestMessageID, summary.LatestMessage = &latest.ID, &latest.Content
+			summary.LatestMessageTime, summary.LatestSenderID = &latest.CreatedAt, &latest.SenderID
+		}
+		conversations = append(conversations, summary)
+	}
+
+	sort.SliceStable(conversations, func(i, j int) bool { return conversations[i].UpdatedAt.After(conversations[j].UpdatedAt) })
+	return conversations, nil
+}
+
+func (r *memoryConversations) ParticipantRole(ctx context.Context, conversationID, userID int) (string, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if i := r.m.participant(conversationID, userID); i >= 0 {
+		return r.m.participants[i].Role, nil
+	}
+	return "", ErrNotFound
+}
+
+func (r *memoryConversations) Participants(ctx context.Context, conversationID int) ([]models.ConversationParticipant, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	participants := []models.ConversationParticipant{}
+	for _, p := range r.m.participants {
+		if p.ConversationID == conversationID {
+			p.Username = r.m.username(p.UserID)
+			participants = append(participants, p)
+		}
+	}
+	return participants, nil
+}
+
+func (r *memoryConversations) AddParticipant(ctx context.Context, conversationID, userID int, role string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if r.m.participant(conversationID, userID) < 0 {
+		r.m.participants = append(r.m.participants, models.ConversationParticipant{ConversationID: conversationID, UserID: userID, Role: role, JoinedAt: time.Now()})
+	}
+	return nil
+}
+
+func (r *memoryConversations) MarkRead(ctx context.Context, conversationID, userID int) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	now := time.Now()
+	if i := r.m.participant(conversationID, userID); i >= 0 {
+		r.m.participants[i].LastReadAt = &now
+	}
+
+	var marked int64
+	for i, message := range r.m.messages {
+		if message.ConversationID != nil && *message.ConversationID == conversationID &&
+			message.ReceiverID != nil && *message.ReceiverID == userID && !message.Read {
+			r.m.messages[i].Read = true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (r *memoryConversations) ShareConversation(ctx context.Context, userID, otherUserID int) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, p := range r.m.participants {
+		if p.UserID == userID && r.m.participant(p.ConversationID, otherUserID) >= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryConversations) ContactMasked(ctx context.Context, conversationID int) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	// Claimed and returned items no longer hide contact details
+	for _, conversation := range r.m.conversations {
+		if conversation.ID != conversationID || conversation.ItemID == nil {
+			continue
+		}
+		if i := (&memoryItems{r.m}).find(*conversation.ItemID); i >= 0 && IsClaimed(r.m.items[i].Status) {
+			return false, nil
+		}
+	}
+
+	for _, p := range r.m.participants {
+		if p.ConversationID == conversationID && p.Role == "participant" && r.m.settings[p.UserID].MaskedContact {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// blocksParticipant reports whether the user has blocked another participant
+// of a conversation. The caller must hold r.m.mu.
+func (r *memoryConversations) blocksParticipant(userID, conversationID int) bool {
+	for _, p := range r.m.participants {
+		if p.ConversationID == conversationID && p.Role == "participant" && r.m.blocked(userID, p.UserID) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameItem reports whether two optional item IDs are equal
+func sameItem(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// memoryPrivacy implements PrivacyRepository
+type memoryPrivacy struct {
+	m *Memory
+}
+
+func (r *memoryPrivacy) Blocks(ctx context.Context, blockerID int) ([]BlockWithUsername, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	blocks := []BlockWithUsername{}
+	for _, block := range r.m.blocks {
+		if block.BlockerID == blockerID {
+			blocks = append(blocks, BlockWithUsername{UserBlock: block, BlockedUsername: r.m.username(block.BlockedID)})
+		}
+	}
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].CreatedAt.After(blocks[j].CreatedAt) })
+	return blocks, nil
+}
+
+func (r *memoryPrivacy) Block(ctx context.Context, blockerID, blockedID int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if !r.m.blocked(blockerID, blockedID) {
+		r.m.blocks = append(r.m.blocks, models.UserBlock{BlockerID: blockerID, BlockedID: blockedID, CreatedAt: time.Now()})
+	}
+	return nil
+}
+
+func (r *memoryPrivacy) Unblock(ctx context.Context, blockerID, blockedID int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for i, block := range r.m.blocks {
+		if block.BlockerID == blockerID && block.BlockedID == blockedID {
+			r.m.blocks = append(r.m.blocks[:i], r.m.blocks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryPrivacy) IsBlocked(ctx context.Context, userID, otherUserID int) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.blocked(userID, otherUserID) || r.m.blocked(otherUserID, userID), nil
+}
+
+func (r *memoryPrivacy) Settings(ctx context.Context, userID int) (models.UserSettings, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if settings, ok := r.m.settings[userID]; ok {
+		return settings, nil
+	}
+	return models.UserSettings{}, ErrNotFound
+}
+
+func (r *memoryPrivacy) SaveSettings(ctx context.Context, settings models.UserSettings) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	r.m.settings[settings.UserID] = settings
+	return nil
+}
+
+func (r *memoryPrivacy) EmailFrequency(ctx context.Context, userID int) (string, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if frequency, ok := r.m.emailFrequencies[userID]; ok {
+		return frequency, nil
+	}
+	return "", ErrNotFound
+}
+
+func (r *memoryPrivacy) SetEmailFrequency(ctx context.Context, userID int, frequency string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	r.m.emailFrequencies[userID] = frequency
+	return nil
+}
+
+// memoryNotifications implements NotificationRepository
+type memoryNotifications struct {
+	m *Memory
+}
+
+func (r *memoryNotifications) List(ctx context.Context, userID int, unreadOnly bool, limit, offset int) ([]models.Notification, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []models.Notification{}
+	for _, notification := range r.m.notifications {
+		if notification.UserID == userID && (!unreadOnly || notification.ReadAt == nil) {
+			matched = append(matched, notification)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].ID > matched[j].ID })
+	start, end := page(len(matched), limit, offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryNotifications) UnreadCount(ctx context.Context, userID int) (int, error) {
+	_, count, err := r.List(ctx, userID, true, 0, 0)
+	return count, err
+}
+
+func (r *memoryNotifications) MarkRead(ctx context.Context, id, userID int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for i, notification := range r.m.notifications {
+		if notification.ID == id && notification.UserID == userID {
+			if notification.ReadAt == nil {
+				now := time.Now()
+				r.m.notifications[i].ReadAt = &now
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryNotifications) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	now := time.Now()
+	var marked int64
+	for i, notification := range r.m.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			r.m.notifications[i].ReadAt = &now
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (r *memoryNotifications) Preferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	prefs := []models.NotificationPreference{}
+	for notificationType, enabled := range r.m.notificationPrefs[userID] {
+		prefs = append(prefs, models.NotificationPreference{Type: notificationType, Enabled: enabled})
+	}
+	return prefs, nil
+}
+
+func (r *memoryNotifications) SetPreferences(ctx context.Context, userID int, prefs []models.NotificationPreference) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if r.m.notificationPrefs[userID] == nil {
+		r.m.notificationPrefs[userID] = map[string]bool{}
+	}
+	for _, pref := range prefs {
+		r.m.notificationPrefs[userID][pref.Type] = pref.Enabled
+	}
+	return nil
+}
+
+// memoryAPIKeys implements APIKeyRepository
+type memoryAPIKeys struct {
+	m *Memory
+}
+
+func (r *memoryAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	key.ID = r.m.id("api_keys")
+	r.m.apiKeys = append(r.m.apiKeys, *key)
+	return nil
+}
+
+func (r *memoryAPIKeys) GetByPrefix(ctx context.Context, prefix string) (APIKeyWithOwner, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, key := range r.m.apiKeys {
+		if key.Prefix != prefix {
+			continue
+		}
+		if i := (&memoryUsers{r.m}).find(key.UserID); i >= 0 {
+			return APIKeyWithOwner{APIKey: key, Username: r.m.users[i].Username, Role: r.m.users[i].Role}, nil
+		}
+	}
+	return APIKeyWithOwner{}, ErrNotFound
+}
+
+func (r *memoryAPIKeys) ListForUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	keys, _, err := r.List(ctx, userID, -1, 0)
+	return keys, err
+}
+
+func (r *memoryAPIKeys) List(ctx context.Context, userID, limit, offset int) ([]models.APIKey, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []models.APIKey{}
+	for _, key := range r.m.apiKeys {
+		if userID == 0 || key.UserID == userID {
+			matched = append(matched, key)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), limit, offset)
+	return matched[start:end], len(matched), nil
+}
+
+func (r *memoryAPIKeys) Revoke(ctx context.Context, id, userID int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for i, key := range r.m.apiKeys {
+		if key.ID == id && (userID == 0 || key.UserID == userID) && key.RevokedAt == nil {
+			now := time.Now()
+			r.m.apiKeys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryAPIKeys) Touch(ctx context.Context, id int, at time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for i, key := range r.m.apiKeys {
+		if key.ID == id {
+			r.m.apiKeys[i].LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+// memoryWebhooks implements WebhookRepository. Nothing delivers events, so
+// the delivery log stays empty.
+type memoryWebhooks struct {
+	m *Memory
+}
+
+func (r *memoryWebhooks) Create(ctx context.Context, webhook *models.Webhook) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	webhook.ID = r.m.id("webhooks")
+	r.m.webhooks = append(r.m.webhooks, *webhook)
+	return nil
+}
+
+func (r *memoryWebhooks) Get(ctx context.Context, id int) (models.Webhook, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if i := r.find(id); i >= 0 {
+		return r.m.webhooks[i], nil
+	}
+	return models.Webhook{}, ErrNotFound
+}
+
+func (r *memoryWebhooks) List(ctx context.Context) ([]models.Webhook, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	webhooks := append([]models.Webhook{}, r.m.webhooks...)
+	sort.SliceStable(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt.After(webhooks[j].CreatedAt) })
+	return webhooks, nil
+}
+
+func (r *memoryWebhooks) Update(ctx context.Context, id int, update models.WebhookRequest) (models.Webhook, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return models.Webhook{}, ErrNotFound
+	}
+	webhook := &r.m.webhooks[i]
+	webhook.URL, webhook.Description, webhook.EventTypes = update.URL, update.Description, update.EventTypes
+	if update.Active != nil {
+		webhook.Active = *update.Active
+	}
+	webhook.UpdatedAt = time.Now()
+	return *webhook, nil
+}
+
+func (r *memoryWebhooks) Delete(ctx context.Context, id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.m.webhooks = append(r.m.webhooks[:i], r.m.webhooks[i+1:]...)
+
+	deliveries := r.m.deliveries[:0]
+	for _, delivery := range r.m.deliveries {
+		if delivery.WebhookID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	r.m.deliveries = deliveries
+	return nil
+}
+
+func (r *memoryWebhooks) Deliveries(ctx context.Context, webhookID int, status string, limit, offset int) ([]models.WebhookDelivery, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []models.WebhookDelivery{}
+	for _, delivery := range r.m.deliveries {
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			matched = append(matched, delivery)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].ID > matched[j].ID })
+	start, end := page(len(matched), limit, offset)
+	return matched[start:end], len(matched), nil
+}
+
+// find returns the index of the webhook, or -1. The caller must hold r.m.mu.
+func (r *memoryWebhooks) find(id int) int {
+	for i, webhook := range r.m.webhooks {
+		if webhook.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// memoryLoginAttempts implements LoginAttemptRepository
+type memoryLoginAttempts struct {
+	m *Memory
+}
+
+func (r *memoryLoginAttempts) Create(ctx context.Context, attempt *models.LoginAttempt) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	attempt.ID = r.m.id("login_attempts")
+	r.m.loginAttempts = append(r.m.loginAttempts, *attempt)
+	return nil
+}
+
+func (r *memoryLoginAttempts) Finish(ctx context.Context, id int, userID *int, reason string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for i := range r.m.loginAttempts {
+		attempt := &r.m.loginAttempts[i]
+		if attempt.ID == id {
+			attempt.UserID, attempt.Success, attempt.Reason = userID, reason == "success", reason
+		}
+	}
+	return nil
+}
+
+func (r *memoryLoginAttempts) RecentFailures(ctx context.Context, ip string, since time.Time, beforeID int) (int, *time.Time, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	count := 0
+	var last *time.Time
+	for i, attempt := range r.m.loginAttempts {
+		failed := attempt.Reason == "invalid_password" || attempt.Reason == "unknown_user" || attempt.Reason == "pending"
+		if attempt.IPAddress != ip || !failed || !attempt.CreatedAt.After(since) || attempt.ID >= beforeID {
+			continue
+		}
+		count++
+		if last == nil || attempt.CreatedAt.After(*last) {
+			last = &r.m.loginAttempts[i].CreatedAt
+		}
+	}
+	return count, last, nil
+}
+
+func (r *memoryLoginAttempts) List(ctx context.Context, filter LoginAttemptFilter) ([]models.LoginAttempt, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	matched := []models.LoginAttempt{}
+	for _, attempt := range r.m.loginAttempts {
+		if filter.Username != "" && attempt.Username != filter.Username {
+			continue
+		}
+		if filter.IP != "" && attempt.IPAddress != filter.IP {
+			continue
+		}
+		if filter.Success != nil && attempt.Success != *filter.Success {
+			continue
+		}
+		matched = append(matched, attempt)
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	start, end := page(len(matched), filter.Limit, filter.Offset)
+	return matched[start:end], len(matched), nil
+}
+
+// memoryStats implements StatsRepository
+type memoryStats struct {
+	m *Memory
+}
+
+func (r *memoryStats) Get(ctx context.Context) (Stats, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	stats := Stats{TotalUsers: len(r.m.users), TotalItems: len(r.m.items)}
+	for _, user := range r.m.users {
+		switch user.Role {
+		case "student":
+			stats.StudentCount++
+		case "guard":
+			stats.GuardCount++
+		case "admin":
+			stats.AdminCount++
+		}
+	}
+	for _, item := range r.m.items {
+		switch item.Status {
+		case "lost":
+			stats.LostItems++
+		case "found":
+			stats.FoundItems++
+		case "claimed":
+			stats.ClaimedItems++
+		case "returned":
+			stats.ReturnedItems++
+		}
+	}
+	for _, report := range r.m.reports {
+		if report.Status == "pending" {
+			stats.PendingReports++
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,1116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+// NewPostgres returns repositories backed by the PostgreSQL database
+func NewPostgres(db *sqlx.DB) Repositories {
+	return Repositories{
+		Items:         &postgresItems{db},
+		Users:         &postgresUsers{db},
+		Messages:      &postgresMessages{db},
+		Reports:       &postgresReports{db},
+		Conversations: &postgresConversations{db},
+		Privacy:       &postgresPrivacy{db},
+		Notifications: &postgresNotifications{db},
+		APIKeys:       &postgresAPIKeys{db},
+		Webhooks:      &postgresWebhooks{db},
+		LoginAttempts: &postgresLoginAttempts{db},
+		Stats:         &postgresStats{db},
+	}
+}
+
+// whereBuilder builds a WHERE clause with numbered placeholders
+type whereBuilder struct {
+	clause string
+	args   []interface{}
+}
+
+// add appends a condition, replacing each ? in it with the placeholder for value
+func (w *whereBuilder) add(condition string, value interface{}) {
+	w.args = append(w.args, value)
+	w.clause += " AND " + strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(w.args)))
+}
+
+// page returns the LIMIT and OFFSET clause and the arguments including them
+func (w *whereBuilder) page(limit, offset int) (string, []interface{}) {
+	n := len(w.args)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", n+1, n+2), append(append([]interface{}{}, w.args...), limit, offset)
+}
+
+// recordEvents writes events to the outbox in the transaction
+func recordEvents(tx *sqlx.Tx, pending []pendingEvent) error {
+	for _, event := range pending {
+		if err := events.Record(tx, event.Type, event.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notFound converts sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// postgresItems implements ItemRepository
+type postgresItems struct {
+	db *sqlx.DB
+}
+
+func (r *postgresItems) Create(ctx context.Context, item *models.Item) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, item, `
+		INSERT INTO items (title, description, category, status, location, lost_time, report_time, reporter_id, finder_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING *
+	`, item.Title, item.Description, item.Category, item.Status, item.Location, item.LostTime, item.ReportTime,
+		item.ReporterID, item.FinderID, item.CreatedAt, item.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := events.Record(tx, events.ItemCreated, item); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresItems) Get(ctx context.Context, id int) (models.Item, error) {
+	var item models.Item
+	err := r.db.GetContext(ctx, &item, "SELECT * FROM items WHERE id = $1", id)
+	return item, notFound(err)
+}
+
+func (r *postgresItems) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM items WHERE id = $1)", id)
+	return exists, err
+}
+
+func (r *postgresItems) List(ctx context.Context, filter ItemFilter) ([]models.Item, int, error) {
+	var where whereBuilder
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+	if filter.Category != "" {
+		where.add("category = ?", filter.Category)
+	}
+	if filter.Search != "" {
+		where.add("(title ILIKE ? OR description ILIKE ?)", "%"+filter.Search+"%")
+	}
+	if filter.OwnerID != 0 {
+		where.add("(reporter_id = ? OR finder_id = ?)", filter.OwnerID)
+	}
+
+	pagination, args := where.page(filter.Limit, filter.Offset)
+	items := []models.Item{}
+	err := r.db.SelectContext(ctx, &items, "SELECT * FROM items WHERE 1=1"+where.clause+" ORDER BY created_at DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM items WHERE 1=1"+where.clause, where.args...)
+	return items, total, err
+}
+
+func (r *postgresItems) UpdateStatus(ctx context.Context, id int, status string, changedBy int, authorize func(item models.Item) error) (models.Item, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Item{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the item so the previous status in its events is accurate
+	var previous models.Item
+	if err := tx.GetContext(ctx, &previous, "SELECT * FROM items WHERE id = $1 FOR UPDATE", id); err != nil {
+		return models.Item{}, notFound(err)
+	}
+	if err := authorize(previous); err != nil {
+		return models.Item{}, err
+	}
+
+	// Update the status, and the claimed time if status is "claimed"
+	var item models.Item
+	err = tx.GetContext(ctx, &item, `
+		UPDATE items
+		SET status = $1, updated_at = $2, claimed_time = CASE WHEN $1 = 'claimed' THEN $2 ELSE claimed_time END
+		WHERE id = $3
+		RETURNING *
+	`, status, time.Now(), id)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if err := recordEvents(tx, statusEvents(previous, item, changedBy)); err != nil {
+		return models.Item{}, err
+	}
+	return item, tx.Commit()
+}
+
+func (r *postgresItems) SetImage(ctx context.Context, id int, imageURL string) (models.Item, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Item{}, err
+	}
+	defer tx.Rollback()
+
+	// Extract metadata from the image (this would require additional libraries)
+	// For now, we'll just save the image URL
+	now := time.Now()
+	var item models.Item
+	err = tx.GetContext(ctx, &item, "UPDATE items SET image_url = $1, updated_at = $2 WHERE id = $3 RETURNING *", imageURL, now, id)
+	if err != nil {
+		return models.Item{}, notFound(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO images (item_id, image_url, timestamp, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, id, imageURL, now, now)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if err := events.Record(tx, events.ItemUpdated, item); err != nil {
+		return models.Item{}, err
+	}
+	return item, tx.Commit()
+}
+
+// postgresUsers implements UserRepository
+type postgresUsers struct {
+	db *sqlx.DB
+}
+
+func (r *postgresUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO users (username, email, password_hash, role, first_name, last_name, phone, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, user.Username, user.Email, user.PasswordHash, user.Role, user.FirstName, user.LastName, user.Phone,
+		user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+}
+
+func (r *postgresUsers) Get(ctx context.Context, id int) (models.User, error) {
+	var user models.User
+	err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id = $1", id)
+	return user, notFound(err)
+}
+
+func (r *postgresUsers) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE username = $1", username)
+	return user, notFound(err)
+}
+
+func (r *postgresUsers) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", id)
+	return exists, err
+}
+
+func (r *postgresUsers) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", username)
+	return exists, err
+}
+
+func (r *postgresUsers) EmailTaken(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", email)
+	return exists, err
+}
+
+func (r *postgresUsers) List(ctx context.Context, filter UserFilter) ([]models.User, int, error) {
+	var where whereBuilder
+	if filter.Role != "" {
+		where.add("role = ?", filter.Role)
+	}
+	if filter.Search != "" {
+		where.add("(username ILIKE ? OR email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?)", "%"+filter.Search+"%")
+	}
+
+	pagination, args := where.page(filter.Limit, filter.Offset)
+	users := []models.User{}
+	err := r.db.SelectContext(ctx, &users, `
+		SELECT id, username, email, role, first_name, last_name, phone, created_at, updated_at, failed_login_count, locked_until
+		FROM users WHERE 1=1`+where.clause+" ORDER BY created_at DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users WHERE 1=1"+where.clause, where.args...)
+	return users, total, err
+}
+
+func (r *postgresUsers) UpdateProfile(ctx context.Context, id int, update ProfileUpdate) error {
+	return r.updateOne(ctx, `
+		UPDATE users
+		SET first_name = $1, last_name = $2, phone = $3, email = $4, updated_at = $5
+		WHERE id = $6
+	`, update.FirstName, update.LastName, update.Phone, update.Email, time.Now(), id)
+}
+
+func (r *postgresUsers) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	return r.updateOne(ctx, "UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3", passwordHash, time.Now(), id)
+}
+
+func (r *postgresUsers) SetRole(ctx context.Context, id int, role string) error {
+	return r.updateOne(ctx, "UPDATE users SET role = $1, updated_at = $2 WHERE id = $3", role, time.Now(), id)
+}
+
+func (r *postgresUsers) AddLoginFailure(ctx context.Context, id int) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, "UPDATE users SET failed_login_count = failed_login_count + 1 WHERE id = $1 RETURNING failed_login_count", id)
+	return count, notFound(err)
+}
+
+func (r *postgresUsers) LockUntil(ctx context.Context, id int, until time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users SET locked_until = $1
+		WHERE id = $2 AND (locked_until IS NULL OR locked_until < $1)
+	`, until, id)
+	return err
+}
+
+func (r *postgresUsers) ResetLoginFailures(ctx context.Context, id int) error {
+	return r.updateOne(ctx, "UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = $1", id)
+}
+
+func (r *postgresUsers) Unlock(ctx context.Context, id int) error {
+	return r.updateOne(ctx, "UPDATE users SET failed_login_count = 0, locked_until = NULL, updated_at = $1 WHERE id = $2", time.Now(), id)
+}
+
+// updateOne runs an update and returns ErrNotFound if it matched no user
+func (r *postgresUsers) updateOne(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// postgresMessages implements MessageRepository
+type postgresMessages struct {
+	db *sqlx.DB
+}
+
+func (r *postgresMessages) Create(ctx context.Context, message *models.Message) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO messages (conversation_id, sender_id, receiver_id, item_id, content, created_at, contains_contact_info, contact_info_redacted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, message.ConversationID, message.SenderID, message.ReceiverID, message.ItemID, message.Content, message.CreatedAt,
+		message.ContainsContactInfo, message.ContactInfoRedacted).Scan(&message.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range message.Attachments {
+		attachment := &message.Attachments[i]
+		attachment.MessageID = message.ID
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO message_attachments (message_id, conversation_id, uploader_id, filename, content_type, size_bytes, storage_name, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id
+		`, attachment.MessageID, attachment.ConversationID, attachment.UploaderID, attachment.Filename,
+			attachment.ContentType, attachment.SizeBytes, attachment.StorageName, attachment.CreatedAt).Scan(&attachment.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if message.ConversationID != nil {
+		_, err = tx.ExecContext(ctx, "UPDATE conversations SET updated_at = $1 WHERE id = $2", message.CreatedAt, *message.ConversationID)
+		if err != nil {
+			return err
+		}
+	}
+	if err := events.Record(tx, events.MessageCreated, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresMessages) ListInConversation(ctx context.Context, conversationID, limit, offset int) ([]MessageWithSender, int, error) {
+	messages := []MessageWithSender{}
+	err := r.db.SelectContext(ctx, &messages, `
+		SELECT m.*, u.username as sender_username
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.conversation_id = $1
+		ORDER BY m.created_at DESC LIMIT $2 OFFSET $3
+	`, conversationID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM messages WHERE conversation_id = $1", conversationID)
+	return messages, total, err
+}
+
+func (r *postgresMessages) ListBetween(ctx context.Context, userID, otherUserID int, itemID *int, limit, offset int) ([]MessageWithSender, int, error) {
+	where := whereBuilder{
+		clause: " AND ((m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1))",
+		args:   []interface{}{userID, otherUserID},
+	}
+	if itemID != nil {
+		where.add("m.item_id = ?", *itemID)
+	}
+
+	pagination, args := where.page(limit, offset)
+	messages := []MessageWithSender{}
+	err := r.db.SelectContext(ctx, &messages, `
+		SELECT m.*, u.username as sender_username
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE 1=1`+where.clause+" ORDER BY m.created_at DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM messages m WHERE 1=1"+where.clause, where.args...)
+	return messages, total, err
+}
+
+func (r *postgresMessages) UnreadCount(ctx context.Context, userID int) (int, error) {
+	// Count messages from others newer than the user's read position in each conversation
+	var unreadCount int
+	err := r.db.GetContext(ctx, &unreadCount, `
+		SELECT COUNT(*)
+		FROM messages m
+		JOIN conversation_participants p ON p.conversation_id = m.conversation_id AND p.user_id = $1
+		WHERE m.sender_id <> $1 AND (p.last_read_at IS NULL OR m.created_at > p.last_read_at)
+			AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = m.sender_id)
+	`, userID)
+	return unreadCount, err
+}
+
+func (r *postgresMessages) MarkRead(ctx context.Context, userID, otherUserID int) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE messages
+		SET read = true
+		WHERE receiver_id = $1 AND sender_id = $2 AND read = false
+	`, userID, otherUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Advance the read position of the conversations shared with the other user
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversation_participants
+		SET last_read_at = $1
+		WHERE user_id = $2 AND conversation_id IN (SELECT id FROM conversations WHERE participant_key = $3)
+	`, time.Now(), userID, participantKey(userID, otherUserID))
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows, tx.Commit()
+}
+
+func (r *postgresMessages) Attachment(ctx context.Context, id int) (models.MessageAttachment, error) {
+	var attachment models.MessageAttachment
+	err := r.db.GetContext(ctx, &attachment, "SELECT * FROM message_attachments WHERE id = $1", id)
+	return attachment, notFound(err)
+}
+
+func (r *postgresMessages) Attachments(ctx context.Context, messageIDs []int) ([]models.MessageAttachment, error) {
+	attachments := []models.MessageAttachment{}
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM message_attachments WHERE message_id IN (?) ORDER BY id", messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.SelectContext(ctx, &attachments, r.db.Rebind(query), args...)
+	return attachments, err
+}
+
+// postgresReports implements ReportRepository
+type postgresReports struct {
+	db *sqlx.DB
+}
+
+func (r *postgresReports) Create(ctx context.Context, report *models.Report) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, report, `
+		INSERT INTO reports (reporter_id, reported_id, item_id, reason, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING *
+	`, report.ReporterID, report.ReportedID, report.ItemID, report.Reason, report.Status, report.CreatedAt, report.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := events.Record(tx, events.ReportCreated, report); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresReports) List(ctx context.Context, status string, limit, offset int) ([]ReportWithUsernames, int, error) {
+	var where whereBuilder
+	if status != "" {
+		where.add("r.status = ?", status)
+	}
+
+	pagination, args := where.page(limit, offset)
+	reports := []ReportWithUsernames{}
+	err := r.db.SelectContext(ctx, &reports, `
+		SELECT r.*,
+		   reporter.username as reporter_username,
+		   reported.username as reported_username
+		FROM reports r
+		JOIN users reporter ON r.reporter_id = reporter.id
+		JOIN users reported ON r.reported_id = reported.id
+		WHERE 1=1`+where.clause+" ORDER BY r.created_at DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM reports r WHERE 1=1"+where.clause, where.args...)
+	return reports, total, err
+}
+
+func (r *postgresReports) UpdateStatus(ctx context.Context, id int, status, comment string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var reporterID *int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE reports
+		SET status = $1, updated_at = $2, admin_comment = $3
+		WHERE id = $4
+		RETURNING reporter_id
+	`, status, time.Now(), comment, id).Scan(&reporterID)
+	if err != nil {
+		return notFound(err)
+	}
+
+	// Lets the user who filed the report know the outcome
+	if status != "pending" {
+		err = events.Record(tx, events.ReportResolved, ReportResolution{
+			ReportID:   id,
+			ReporterID: reporterID,
+			Status:     status,
+			Comment:    comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// postgresConversations implements ConversationRepository
+type postgresConversations struct {
+	db *sqlx.DB
+}
+
+func (r *postgresConversations) FindOrCreate(ctx context.Context, itemID *int, userID, otherUserID int) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	key := participantKey(userID, otherUserID)
+	now := time.Now()
+
+	var conversationID int
+	err = tx.GetContext(ctx, &conversationID, `
+		INSERT INTO conversations (item_id, participant_key, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, itemID, key, userID, now)
+	if err == sql.ErrNoRows {
+		// The conversation already exists
+		itemKey := 0
+		if itemID != nil {
+			itemKey = *itemID
+		}
+		err = tx.GetContext(ctx, &conversationID, "SELECT id FROM conversations WHERE COALESCE(item_id, 0) = $1 AND participant_key = $2", itemKey, key)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range []int{userID, otherUserID} {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO conversation_participants (conversation_id, user_id, role, joined_at)
+			VALUES ($1, $2, 'participant', $3)
+			ON CONFLICT DO NOTHING
+		`, conversationID, id, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return conversationID, tx.Commit()
+}
+
+func (r *postgresConversations) Get(ctx context.Context, id int) (models.Conversation, error) {
+	var conversation models.Conversation
+	err := r.db.GetContext(ctx, &conversation, "SELECT * FROM conversations WHERE id = $1", id)
+	return conversation, notFound(err)
+}
+
+func (r *postgresConversations) List(ctx context.Context, filter ConversationFilter) ([]models.ConversationSummary, error) {
+	join := "JOIN"
+	if filter.All && filter.ItemID != nil {
+		join = "LEFT JOIN"
+	}
+
+	query := `
+		SELECT c.id, c.item_id, c.updated_at,
+			i.title AS item_title, i.image_url AS item_image_url, i.status AS item_status,
+			p.role AS my_role,
+			lm.id AS latest_message_id, lm.content AS latest_message,
+			lm.created_at AS latest_message_time, lm.sender_id AS latest_sender_id,
+			CASE WHEN p.user_id IS NULL THEN 0 ELSE (
+				SELECT COUNT(*) FROM messages m
+				WHERE m.conversation_id = c.id AND m.sender_id <> $1
+					AND (p.last_read_at IS NULL OR m.created_at > p.last_read_at)
+			) END AS unread_count
+		FROM conversations c
+		` + join + ` conversation_participants p ON p.conversation_id = c.id AND p.user_id = $1
+		LEFT JOIN items i ON i.id = c.item_id
+		LEFT JOIN messages lm ON lm.id = (
+			SELECT id FROM messages WHERE conversation_id = c.id ORDER BY created_at DESC, id DESC LIMIT 1
+		)
+		WHERE 1=1
+	`
+	args := []interface{}{filter.UserID}
+
+	// Hide conversations with users the user has blocked
+	if !filter.All {
+		query += ` AND NOT EXISTS (
+			SELECT 1 FROM conversation_participants op
+			JOIN user_blocks b ON b.blocker_id = $1 AND b.blocked_id = op.user_id
+			WHERE op.conversation_id = c.id AND op.role = 'participant'
+		)`
+	}
+	if filter.ItemID != nil {
+		query += " AND c.item_id = $2"
+		args = append(args, *filter.ItemID)
+	}
+	query += " ORDER BY c.updated_at DESC"
+
+	conversations := []models.ConversationSummary{}
+	err := r.db.SelectContext(ctx, &conversations, query, args...)
+	return conversations, err
+}
+
+func (r *postgresConversations) ParticipantRole(ctx context.Context, conversationID, userID int) (string, error) {
+	var role string
+	err := r.db.GetContext(ctx, &role, "SELECT role FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2",
+		conversationID, userID)
+	return role, notFound(err)
+}
+
+func (r *postgresConversations) Participants(ctx context.Context, conversationID int) ([]models.ConversationParticipant, error) {
+	participants := []models.ConversationParticipant{}
+	err := r.db.SelectContext(ctx, &participants, `
+		SELECT p.conversation_id, p.user_id, u.username, p.role, p.last_read_at, p.joined_at
+		FROM conversation_participants p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.conversation_id = $1
+		ORDER BY p.joined_at
+	`, conversationID)
+	return participants, err
+}
+
+func (r *postgresConversations) AddParticipant(ctx context.Context, conversationID, userID int, role string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO conversation_participants (conversation_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, conversationID, userID, role, time.Now())
+	return err
+}
+
+func (r *postgresConversations) MarkRead(ctx context.Context, conversationID, userID int) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE conversation_participants SET last_read_at = $1 WHERE conversation_id = $2 AND user_id = $3",
+		time.Now(), conversationID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Keep the per-message read flag in sync for direct messages
+	result, err := tx.ExecContext(ctx, "UPDATE messages SET read = true WHERE conversation_id = $1 AND receiver_id = $2 AND read = false",
+		conversationID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows, tx.Commit()
+}
+
+func (r *postgresConversations) ShareConversation(ctx context.Context, userID, otherUserID int) (bool, error) {
+	var shared bool
+	err := r.db.GetContext(ctx, &shared, `
+		SELECT EXISTS(
+			SELECT 1 FROM conversation_participants a
+			JOIN conversation_participants b ON a.conversation_id = b.conversation_id
+			WHERE a.user_id = $1 AND b.user_id = $2
+		)
+	`, userID, otherUserID)
+	return shared, err
+}
+
+func (r *postgresConversations) ContactMasked(ctx context.Context, conversationID int) (bool, error) {
+	var masked bool
+	err := r.db.GetContext(ctx, &masked, `
+		SELECT EXISTS(
+			SELECT 1 FROM conversation_participants p
+			JOIN user_settings s ON s.user_id = p.user_id
+			JOIN conversations c ON c.id = p.conversation_id
+			LEFT JOIN items i ON i.id = c.item_id
+			WHERE p.conversation_id = $1 AND p.role = 'participant' AND s.masked_contact
+				AND (i.status IS NULL OR i.status NOT IN ('claimed', 'returned'))
+		)
+	`, conversationID)
+	return masked, err
+}
+
+// postgresPrivacy implements PrivacyRepository
+type postgresPrivacy struct {
+	db *sqlx.DB
+}
+
+func (r *postgresPrivacy) Blocks(ctx context.Context, blockerID int) ([]BlockWithUsername, error) {
+	blocks := []BlockWithUsername{}
+	err := r.db.SelectContext(ctx, &blocks, `
+		SELECT b.*, u.username AS blocked_username
+		FROM user_blocks b
+		JOIN users u ON b.blocked_id = u.id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`, blockerID)
+	return blocks, err
+}
+
+func (r *postgresPrivacy) Block(ctx context.Context, blockerID, blockedID int) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, blockerID, blockedID, time.Now())
+	return err
+}
+
+func (r *postgresPrivacy) Unblock(ctx context.Context, blockerID, blockedID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresPrivacy) IsBlocked(ctx context.Context, userID, otherUserID int) (bool, error) {
+	var blocked bool
+	err := r.db.GetContext(ctx, &blocked, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`, userID, otherUserID)
+	return blocked, err
+}
+
+func (r *postgresPrivacy) Settings(ctx context.Context, userID int) (models.UserSettings, error) {
+	var settings models.UserSettings
+	err := r.db.GetContext(ctx, &settings, `
+		SELECT user_id, message_policy, masked_contact, name_visibility, email_visibility, phone_visibility, updated_at
+		FROM user_settings WHERE user_id = $1
+	`, userID)
+	return settings, notFound(err)
+}
+
+func (r *postgresPrivacy) SaveSettings(ctx context.Context, settings models.UserSettings) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_settings (user_id, message_policy, masked_contact, name_visibility, email_visibility, phone_visibility, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+			message_policy = EXCLUDED.message_policy,
+			masked_contact = EXCLUDED.masked_contact,
+			name_visibility = EXCLUDED.name_visibility,
+			email_visibility = EXCLUDED.email_visibility,
+			phone_visibility = EXCLUDED.phone_visibility,
+			updated_at = EXCLUDED.updated_at
+	`, settings.UserID, settings.MessagePolicy, settings.MaskedContact, settings.NameVisibility,
+		settings.EmailVisibility, settings.PhoneVisibility, settings.UpdatedAt)
+	return err
+}
+
+func (r *postgresPrivacy) EmailFrequency(ctx context.Context, userID int) (string, error) {
+	var frequency string
+	err := r.db.GetContext(ctx, &frequency, "SELECT email_frequency FROM user_settings WHERE user_id = $1", userID)
+	return frequency, notFound(err)
+}
+
+func (r *postgresPrivacy) SetEmailFrequency(ctx context.Context, userID int, frequency string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_settings (user_id, email_frequency, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET email_frequency = EXCLUDED.email_frequency, updated_at = EXCLUDED.updated_at
+	`, userID, frequency, time.Now())
+	return err
+}
+
+// postgresNotifications implements NotificationRepository
+type postgresNotifications struct {
+	db *sqlx.DB
+}
+
+func (r *postgresNotifications) List(ctx context.Context, userID int, unreadOnly bool, limit, offset int) ([]models.Notification, int, error) {
+	where := whereBuilder{clause: " AND user_id = $1", args: []interface{}{userID}}
+	if unreadOnly {
+		where.clause += " AND read_at IS NULL"
+	}
+
+	pagination, args := where.page(limit, offset)
+	notifications := []models.Notification{}
+	err := r.db.SelectContext(ctx, &notifications, "SELECT * FROM notifications WHERE 1=1"+where.clause+" ORDER BY created_at DESC, id DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM notifications WHERE 1=1"+where.clause, where.args...)
+	return notifications, total, err
+}
+
+func (r *postgresNotifications) UnreadCount(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID)
+	return count, err
+}
+
+func (r *postgresNotifications) MarkRead(ctx context.Context, id, userID int) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, $1)
+		WHERE id = $2 AND user_id = $3
+	`, time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresNotifications) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL", time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *postgresNotifications) Preferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	prefs := []models.NotificationPreference{}
+	err := r.db.SelectContext(ctx, &prefs, "SELECT type, enabled FROM notification_preferences WHERE user_id = $1", userID)
+	return prefs, err
+}
+
+func (r *postgresNotifications) SetPreferences(ctx context.Context, userID int, prefs []models.NotificationPreference) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, pref := range prefs {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, type, enabled, updated_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = EXCLUDED.updated_at
+		`, userID, pref.Type, pref.Enabled, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// postgresAPIKeys implements APIKeyRepository
+type postgresAPIKeys struct {
+	db *sqlx.DB
+}
+
+func (r *postgresAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, permissions, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Permissions, key.CreatedBy, key.ExpiresAt, key.CreatedAt).Scan(&key.ID)
+}
+
+func (r *postgresAPIKeys) GetByPrefix(ctx context.Context, prefix string) (APIKeyWithOwner, error) {
+	var key APIKeyWithOwner
+	err := r.db.GetContext(ctx, &key, `
+		SELECT k.*, u.username, u.role
+		FROM api_keys k
+		JOIN users u ON k.user_id = u.id
+		WHERE k.prefix = $1
+	`, prefix)
+	return key, notFound(err)
+}
+
+func (r *postgresAPIKeys) ListForUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := r.db.SelectContext(ctx, &keys, "SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	return keys, err
+}
+
+func (r *postgresAPIKeys) List(ctx context.Context, userID, limit, offset int) ([]models.APIKey, int, error) {
+	var where whereBuilder
+	if userID != 0 {
+		where.add("user_id = ?", userID)
+	}
+
+	pagination, args := where.page(limit, offset)
+	keys := []models.APIKey{}
+	err := r.db.SelectContext(ctx, &keys, "SELECT * FROM api_keys WHERE 1=1"+where.clause+" ORDER BY created_at DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM api_keys WHERE 1=1"+where.clause, where.args...)
+	return keys, total, err
+}
+
+func (r *postgresAPIKeys) Revoke(ctx context.Context, id, userID int) error {
+	where := whereBuilder{clause: " AND id = $2 AND revoked_at IS NULL", args: []interface{}{time.Now(), id}}
+	if userID != 0 {
+		where.add("user_id = ?", userID)
+	}
+
+	result, err := r.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = $1 WHERE 1=1"+where.clause, where.args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresAPIKeys) Touch(ctx context.Context, id int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", at, id)
+	return err
+}
+
+// postgresWebhooks implements WebhookRepository
+type postgresWebhooks struct {
+	db *sqlx.DB
+}
+
+func (r *postgresWebhooks) Create(ctx context.Context, webhook *models.Webhook) error {
+	return r.db.GetContext(ctx, webhook, `
+		INSERT INTO webhooks (url, description, secret, event_types, active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING *
+	`, webhook.URL, webhook.Description, webhook.Secret, webhook.EventTypes, webhook.Active, webhook.CreatedBy,
+		webhook.CreatedAt, webhook.UpdatedAt)
+}
+
+func (r *postgresWebhooks) Get(ctx context.Context, id int) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.GetContext(ctx, &webhook, "SELECT * FROM webhooks WHERE id = $1", id)
+	return webhook, notFound(err)
+}
+
+func (r *postgresWebhooks) List(ctx context.Context) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := r.db.SelectContext(ctx, &webhooks, "SELECT * FROM webhooks ORDER BY created_at DESC")
+	return webhooks, err
+}
+
+func (r *postgresWebhooks) Update(ctx context.Context, id int, update models.WebhookRequest) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.GetContext(ctx, &webhook, `
+		UPDATE webhooks
+		SET url = $1, description = $2, event_types = $3, active = COALESCE($4, active), updated_at = $5
+		WHERE id = $6
+		RETURNING *
+	`, update.URL, update.Description, models.StringList(update.EventTypes), update.Active, time.Now(), id)
+	return webhook, notFound(err)
+}
+
+func (r *postgresWebhooks) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresWebhooks) Deliveries(ctx context.Context, webhookID int, status string, limit, offset int) ([]models.WebhookDelivery, int, error) {
+	where := whereBuilder{clause: " AND webhook_id = $1", args: []interface{}{webhookID}}
+	if status != "" {
+		where.add("status = ?", status)
+	}
+
+	pagination, args := where.page(limit, offset)
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.SelectContext(ctx, &deliveries, "SELECT * FROM webhook_deliveries WHERE 1=1"+where.clause+" ORDER BY created_at DESC, id DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM webhook_deliveries WHERE 1=1"+where.clause, where.args...)
+	return deliveries, total, err
+}
+
+// postgresLoginAttempts implements LoginAttemptRepository
+type postgresLoginAttempts struct {
+	db *sqlx.DB
+}
+
+func (r *postgresLoginAttempts) Create(ctx context.Context, attempt *models.LoginAttempt) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (username, user_id, ip_address, user_agent, success, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, attempt.Username, attempt.UserID, attempt.IPAddress, attempt.UserAgent, attempt.Success, attempt.Reason,
+		attempt.CreatedAt).Scan(&attempt.ID)
+}
+
+func (r *postgresLoginAttempts) Finish(ctx context.Context, id int, userID *int, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE login_attempts SET user_id = $1, success = $2, reason = $3 WHERE id = $4
+	`, userID, reason == "success", reason, id)
+	return err
+}
+
+func (r *postgresLoginAttempts) RecentFailures(ctx context.Context, ip string, since time.Time, beforeID int) (int, *time.Time, error) {
+	var failures struct {
+		Count       int        `db:"count"`
+		LastFailure *time.Time `db:"last_failure"`
+	}
+	err := r.db.GetContext(ctx, &failures, `
+		SELECT COUNT(*) AS count, MAX(created_at) AS last_failure
+		FROM login_attempts
+		WHERE ip_address = $1 AND reason IN ('invalid_password', 'unknown_user', 'pending')
+			AND created_at > $2 AND id < $3
+	`, ip, since, beforeID)
+	return failures.Count, failures.LastFailure, err
+}
+
+func (r *postgresLoginAttempts) List(ctx context.Context, filter LoginAttemptFilter) ([]models.LoginAttempt, int, error) {
+	var where whereBuilder
+	if filter.Username != "" {
+		where.add("username = ?", filter.Username)
+	}
+	if filter.IP != "" {
+		where.add("ip_address = ?", filter.IP)
+	}
+	if filter.Success != nil {
+		where.add("success = ?", *filter.Success)
+	}
+
+	pagination, args := where.page(filter.Limit, filter.Offset)
+	attempts := []models.LoginAttempt{}
+	err := r.db.SelectContext(ctx, &attempts, `
+		SELECT id, username, user_id, ip_address, COALESCE(user_agent, '') AS user_agent, success, reason, created_at
+		FROM login_attempts WHERE 1=1`+where.clause+" ORDER BY created_at DESC"+pagination, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM login_attempts WHERE 1=1"+where.clause, where.args...)
+	return attempts, total, err
+}
+
+// postgresStats implements StatsRepository
+type postgresStats struct {
+	db *sqlx.DB
+}
+
+func (r *postgresStats) Get(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := r.db.GetContext(ctx, &stats, `
+		SELECT
+			(SELECT COUNT(*) FROM users) AS total_users,
+			(SELECT COUNT(*) FROM users WHERE role = 'student') AS student_count,
+			(SELECT COUNT(*) FROM users WHERE role = 'guard') AS guard_count,
+			(SELECT COUNT(*) FROM users WHERE role = 'admin') AS admin_count,
+			(SELECT COUNT(*) FROM items) AS total_items,
+			(SELECT COUNT(*) FROM items WHERE status = 'lost') AS lost_items,
+			(SELECT COUNT(*) FROM items WHERE status = 'found') AS found_items,
+			(SELECT COUNT(*) FROM items WHERE status = 'claimed') AS claimed_items,
+			(SELECT COUNT(*) FROM items WHERE status = 'returned') AS returned_items,
+			(SELECT COUNT(*) FROM reports WHERE status = 'pending') AS pending_reports
+	`)
+	return stats, err
+}
@@ -0,0 +1,369 @@
+// Package repository defines the data access used by the HTTP handlers, with
+// a PostgreSQL implementation for the server and an in-memory one for tests.
+// Every method takes the request's context so that queries are traced as
+// part of the request and stop when it is cancelled. Background work such as
+// the outbox, webhook deliveries and the mail queue uses the database directly,
+// since it depends on transactions and row locks a store cannot stand in for.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// Repositories groups the repositories used by the handlers
+type Repositories struct {
+	Items         ItemRepository
+	Users         UserRepository
+	Messages      MessageRepository
+	Reports       ReportRepository
+	Conversations ConversationRepository
+	Privacy       PrivacyRepository
+	Notifications NotificationRepository
+	APIKeys       APIKeyRepository
+	Webhooks      WebhookRepository
+	LoginAttempts LoginAttemptRepository
+	Stats         StatsRepository
+}
+
+// ItemFilter selects items to list. Empty fields match every item.
+type ItemFilter struct {
+	Status   string
+	Category string
+	Search   string // Matches the title or description, ignoring case
+	OwnerID  int    // Matches items the user reported or found
+	Limit    int
+	Offset   int
+}
+
+// ItemRepository stores lost and found items. Changes record their outbox
+// events in the same transaction.
+type ItemRepository interface {
+	// Create saves a new item, filling in its ID, and records item.created
+	Create(ctx context.Context, item *models.Item) error
+	Get(ctx context.Context, id int) (models.Item, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	// List returns a page of items, newest first, and the total number matching
+	List(ctx context.Context, filter ItemFilter) ([]models.Item, int, error)
+	// UpdateStatus locks the item, calls authorize with it, and changes its
+	// status unless authorize returns an error, which is returned unchanged
+	UpdateStatus(ctx context.Context, id int, status string, changedBy int, authorize func(item models.Item) error) (models.Item, error)
+	// SetImage saves an uploaded image of the item and makes it the item's image
+	SetImage(ctx context.Context, id int, imageURL string) (models.Item, error)
+}
+
+// UserFilter selects users to list. Empty fields match every user.
+type UserFilter struct {
+	Role   string
+	Search string // Matches the username, email, first or last name, ignoring case
+	Limit  int
+	Offset int
+}
+
+// ProfileUpdate is the part of a user's profile they can change themselves
+type ProfileUpdate struct {
+	FirstName string
+	LastName  string
+	Phone     string
+	Email     string
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// Create saves a new user, filling in its ID
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id int) (models.User, error)
+	GetByUsername(ctx context.Context, username string) (models.User, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+	EmailTaken(ctx context.Context, email string) (bool, error)
+	// List returns a page of users, newest first, and the total number matching
+	List(ctx context.Context, filter UserFilter) ([]models.User, int, error)
+	UpdateProfile(ctx context.Context, id int, update ProfileUpdate) error
+	SetPassword(ctx context.Context, id int, passwordHash string) error
+	SetRole(ctx context.Context, id int, role string) error
+	// AddLoginFailure atomically increments a user's failed login count and
+	// returns the new count
+	AddLoginFailure(ctx context.Context, id int) (int, error)
+	// LockUntil locks a user out until the given time, unless a later lockout
+	// is already set
+	LockUntil(ctx context.Context, id int, until time.Time) error
+	// ResetLoginFailures clears a user's failed login count and lockout after
+	// a successful login
+	ResetLoginFailures(ctx context.Context, id int) error
+	// Unlock clears a user's failed login count and lockout
+	Unlock(ctx context.Context, id int) error
+}
+
+// MessageWithSender is a message with its sender's username
+type MessageWithSender struct {
+	models.Message
+	SenderUsername string `db:"sender_username" json:"sender_username"`
+}
+
+// MessageRepository stores messages and their attachments
+type MessageRepository interface {
+	// Create saves a new message with its attachments, filling in their IDs,
+	// marks its conversation as active and records message.created, all in
+	// one transaction
+	Create(ctx context.Context, message *models.Message) error
+	// ListInConversation returns a page of a conversation's messages, newest
+	// first, and the total number
+	ListInConversation(ctx context.Context, conversationID, limit, offset int) ([]MessageWithSender, int, error)
+	// ListBetween returns a page of the direct messages between two users,
+	// newest first, and the total number, optionally only about one item
+	ListBetween(ctx context.Context, userID, otherUserID int, itemID *int, limit, offset int) ([]MessageWithSender, int, error)
+	// UnreadCount counts messages the user has not read yet
+	UnreadCount(ctx context.Context, userID int) (int, error)
+	// MarkRead marks the messages from otherUserID to userID as read and
+	// returns how many were unread
+	MarkRead(ctx context.Context, userID, otherUserID int) (int64, error)
+	Attachment(ctx context.Context, id int) (models.MessageAttachment, error)
+	// Attachments returns the attachments of the given messages, oldest first
+	Attachments(ctx context.Context, messageIDs []int) ([]models.MessageAttachment, error)
+}
+
+// ConversationFilter selects conversations to list
+type ConversationFilter struct {
+	UserID int  // The user whose role and unread count are returned
+	ItemID *int // Only conversations about this item
+	All    bool // With ItemID, also conversations the user does not take part in
+}
+
+// ConversationRepository stores conversations and their participants
+type ConversationRepository interface {
+	// FindOrCreate returns the ID of the conversation about an item between
+	// two users, creating it with both as participants if needed
+	FindOrCreate(ctx context.Context, itemID *int, userID, otherUserID int) (int, error)
+	Get(ctx context.Context, id int) (models.Conversation, error)
+	// List returns the conversations matching the filter, most recently
+	// active first. Unless All is set, conversations with a participant the
+	// user has blocked are left out.
+	List(ctx context.Context, filter ConversationFilter) ([]models.ConversationSummary, error)
+	// ParticipantRole returns the user's role in a conversation, or
+	// ErrNotFound if they do not take part in it
+	ParticipantRole(ctx context.Context, conversationID, userID int) (string, error)
+	// Participants returns the participants with their usernames, in the
+	// order they joined
+	Participants(ctx context.Context, conversationID int) ([]models.ConversationParticipant, error)
+	// AddParticipant adds a user to a conversation unless they already take part
+	AddParticipant(ctx context.Context, conversationID, userID int, role string) error
+	// MarkRead advances the user's read position and marks the messages sent
+	// to them as read, returning how many were unread
+	MarkRead(ctx context.Context, conversationID, userID int) (int64, error)
+	// ShareConversation reports whether two users take part in a conversation together
+	ShareConversation(ctx context.Context, userID, otherUserID int) (bool, error)
+	// ContactMasked reports whether a participant of the conversation uses
+	// masked contact mode and its item has not been claimed yet
+	ContactMasked(ctx context.Context, conversationID int) (bool, error)
+}
+
+// BlockWithUsername is a block with the blocked user's username
+type BlockWithUsername struct {
+	models.UserBlock
+	BlockedUsername string `db:"blocked_username" json:"blocked_username"`
+}
+
+// PrivacyRepository stores blocks between users and their privacy settings
+type PrivacyRepository interface {
+	// Blocks returns the blocks created by a user, newest first
+	Blocks(ctx context.Context, blockerID int) ([]BlockWithUsername, error)
+	// Block blocks a user unless they are already blocked
+	Block(ctx context.Context, blockerID, blockedID int) error
+	// Unblock removes a block, or returns ErrNotFound
+	Unblock(ctx context.Context, blockerID, blockedID int) error
+	// IsBlocked reports whether either user has blocked the other
+	IsBlocked(ctx context.Context, userID, otherUserID int) (bool, error)
+	// Settings returns a user's settings, or ErrNotFound if they have never saved any
+	Settings(ctx context.Context, userID int) (models.UserSettings, error)
+	SaveSettings(ctx context.Context, settings models.UserSettings) error
+	// EmailFrequency returns how often a user receives notification emails,
+	// or ErrNotFound if they have never chosen
+	EmailFrequency(ctx context.Context, userID int) (string, error)
+	SetEmailFrequency(ctx context.Context, userID int, frequency string) error
+}
+
+// NotificationRepository reads and updates users' notifications
+type NotificationRepository interface {
+	// List returns a page of a user's notifications, newest first, and the
+	// total number, optionally only unread ones
+	List(ctx context.Context, userID int, unreadOnly bool, limit, offset int) ([]models.Notification, int, error)
+	UnreadCount(ctx context.Context, userID int) (int, error)
+	// MarkRead marks one of the user's notifications as read, or returns ErrNotFound
+	MarkRead(ctx context.Context, id, userID int) error
+	// MarkAllRead marks the user's notifications as read and returns how many were unread
+	MarkAllRead(ctx context.Context, userID int) (int64, error)
+	// Preferences returns the notification types the user has turned on or
+	// off. Types they have never set are on.
+	Preferences(ctx context.Context, userID int) ([]models.NotificationPreference, error)
+	// SetPreferences saves the user's settings for the given notification types
+	SetPreferences(ctx context.Context, userID int, prefs []models.NotificationPreference) error
+}
+
+// APIKeyWithOwner is an API key with its owner's username and role
+type APIKeyWithOwner struct {
+	models.APIKey
+	Username string `db:"username"`
+	Role     string `db:"role"`
+}
+
+// APIKeyRepository stores API keys
+type APIKeyRepository interface {
+	// Create saves a new key, filling in its ID
+	Create(ctx context.Context, key *models.APIKey) error
+	// GetByPrefix returns the key with the prefix and its owner
+	GetByPrefix(ctx context.Context, prefix string) (APIKeyWithOwner, error)
+	// ListForUser returns all of a user's keys, newest first
+	ListForUser(ctx context.Context, userID int) ([]models.APIKey, error)
+	// List returns a page of keys, newest first, and the total number,
+	// optionally only one user's
+	List(ctx context.Context, userID, limit, offset int) ([]models.APIKey, int, error)
+	// Revoke revokes a key that is not revoked yet, or returns ErrNotFound.
+	// Unless userID is 0, the key must belong to that user.
+	Revoke(ctx context.Context, id, userID int) error
+	// Touch records when a key was last used
+	Touch(ctx context.Context, id int, at time.Time) error
+}
+
+// WebhookRepository stores webhooks and reads their delivery log
+type WebhookRepository interface {
+	// Create saves a new webhook, filling in its ID
+	Create(ctx context.Context, webhook *models.Webhook) error
+	Get(ctx context.Context, id int) (models.Webhook, error)
+	// List returns every webhook, newest first
+	List(ctx context.Context) ([]models.Webhook, error)
+	// Update changes a webhook's URL, description and event types, and its
+	// active flag when one is given
+	Update(ctx context.Context, id int, update models.WebhookRequest) (models.Webhook, error)
+	// Delete removes a webhook and its deliveries, or returns ErrNotFound
+	Delete(ctx context.Context, id int) error
+	// Deliveries returns a page of a webhook's deliveries, newest first, and
+	// the total number, optionally only those with a status
+	Deliveries(ctx context.Context, webhookID int, status string, limit, offset int) ([]models.WebhookDelivery, int, error)
+}
+
+// LoginAttemptFilter selects login attempts to list. Empty fields match every attempt.
+type LoginAttemptFilter struct {
+	Username string
+	IP       string
+	Success  *bool
+	Limit    int
+	Offset   int
+}
+
+// LoginAttemptRepository stores the login audit log
+type LoginAttemptRepository interface {
+	// Create saves an attempt, filling in its ID
+	Create(ctx context.Context, attempt *models.LoginAttempt) error
+	// Finish records the outcome of a pending attempt
+	Finish(ctx context.Context, id int, userID *int, reason string) error
+	// RecentFailures counts the failed and pending attempts from an IP
+	// address made after since and before the attempt beforeID, and returns
+	// the time of the latest
+	RecentFailures(ctx context.Context, ip string, since time.Time, beforeID int) (int, *time.Time, error)
+	// List returns a page of attempts, newest first, and the total number matching
+	List(ctx context.Context, filter LoginAttemptFilter) ([]models.LoginAttempt, int, error)
+}
+
+// Stats are the counts shown on the admin dashboard
+type Stats struct {
+	TotalUsers     int `db:"total_users" json:"total_users"`
+	StudentCount   int `db:"student_count" json:"student_count"`
+	GuardCount     int `db:"guard_count" json:"guard_count"`
+	AdminCount     int `db:"admin_count" json:"admin_count"`
+	TotalItems     int `db:"total_items" json:"total_items"`
+	LostItems      int `db:"lost_items" json:"lost_items"`
+	FoundItems     int `db:"found_items" json:"found_items"`
+	ClaimedItems   int `db:"claimed_items" json:"claimed_items"`
+	ReturnedItems  int `db:"returned_items" json:"returned_items"`
+	PendingReports int `db:"pending_reports" json:"pending_reports"`
+}
+
+// StatsRepository counts records for the admin dashboard
+type StatsRepository interface {
+	Get(ctx context.Context) (Stats, error)
+}
+
+// ReportWithUsernames is a report with the usernames of both users involved
+type ReportWithUsernames struct {
+	models.Report
+	ReporterUsername string `db:"reporter_username" json:"reporter_username"`
+	ReportedUsername string `db:"reported_username" json:"reported_username"`
+}
+
+// ReportRepository stores reports of abuse or suspicious activity. Changes
+// record their outbox events in the same transaction.
+type ReportRepository interface {
+	// Create saves a new report, filling in its ID, and records report.created
+	Create(ctx context.Context, report *models.Report) error
+	// List returns a page of reports, newest first, and the total number,
+	// optionally only those with a status
+	List(ctx context.Context, status string, limit, offset int) ([]ReportWithUsernames, int, error)
+	// UpdateStatus changes a report's status and comment, and records
+	// report.resolved unless the report is pending again
+	UpdateStatus(ctx context.Context, id int, status, comment string) error
+}
+
+// ItemStatusChange is the data of an item.status_changed event
+type ItemStatusChange struct {
+	Item           models.Item `json:"item"`
+	PreviousStatus string      `json:"previous_status"`
+	ChangedBy      int         `json:"changed_by"`
+}
+
+// ReportResolution is the data of a report.resolved event
+type ReportResolution struct {
+	ReportID   int    `json:"report_id"`
+	ReporterID *int   `json:"reporter_id"`
+	Status     string `json:"status"`
+	Comment    string `json:"comment"`
+}
+
+// participantKey returns the key of the conversations between two users
+func participantKey(userID, otherUserID int) string {
+	if userID > otherUserID {
+		userID, otherUserID = otherUserID, userID
+	}
+	return fmt.Sprintf("%d:%d", userID, otherUserID)
+}
+
+// IsClaimed reports whether an item status means its owner has it back
+func IsClaimed(status string) bool {
+	return status == "claimed" || status == "returned"
+}
+
+// pendingEvent is an event to record along with a change
+type pendingEvent struct {
+	Type string
+	Data interface{}
+}
+
+// statusEvents returns item.updated, item.status_changed when the status
+// changed, and claim.approved when the item has just been claimed or returned
+func statusEvents(previous, item models.Item, changedBy int) []pendingEvent {
+	pending := []pendingEvent{{events.ItemUpdated, item}}
+	if previous.Status == item.Status {
+		return pending
+	}
+
+	pending = append(pending, pendingEvent{events.ItemStatusChanged, ItemStatusChange{
+		Item:           item,
+		PreviousStatus: previous.Status,
+		ChangedBy:      changedBy,
+	}})
+	if IsClaimed(item.Status) && !IsClaimed(previous.Status) {
+		pending = append(pending, pendingEvent{events.ClaimApproved, map[string]interface{}{
+			"item":        item,
+			"approved_by": changedBy,
+		}})
+	}
+	return pending
+}
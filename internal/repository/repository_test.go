@@ -0,0 +1,372 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/repository"
+)
+
+// forEachStore runs a test against the in-memory store and against the
+// Postgres repositories on a migrated in-memory SQLite database, so that both
+// behave the same
+func forEachStore(t *testing.T, test func(t *testing.T, repos repository.Repositories)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repository.NewMemory().Repositories())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, repository.NewPostgres(databasetest.Open(t)))
+	})
+}
+
+// createUser saves a student and returns its ID
+func createUser(t *testing.T, repos repository.Repositories, username string) int {
+	t.Helper()
+
+	user := models.User{
+		Username:     username,
+		Email:        username + "@example.edu",
+		PasswordHash: "unused",
+		Role:         "student",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user.ID
+}
+
+// createItem saves an item reported by a user and returns it
+func createItem(t *testing.T, repos repository.Repositories, title, status string, reporterID int) models.Item {
+	t.Helper()
+
+	now := time.Now()
+	item := models.Item{
+		Title:      title,
+		Category:   "misc",
+		Status:     status,
+		Location:   "Library",
+		ReportTime: now,
+		ReporterID: &reporterID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := repos.Items.Create(context.Background(), &item); err != nil {
+		t.Fatalf("creating item %s: %v", title, err)
+	}
+	return item
+}
+
+// sendMessage saves a message in a conversation about an item and returns it
+func sendMessage(t *testing.T, repos repository.Repositories, conversationID, itemID, senderID, receiverID int, content string) models.Message {
+	t.Helper()
+
+	message := models.Message{
+		ConversationID: &conversationID,
+		SenderID:       senderID,
+		ReceiverID:     &receiverID,
+		ItemID:         &itemID,
+		Content:        content,
+		CreatedAt:      time.Now(),
+	}
+	if err := repos.Messages.Create(context.Background(), &message); err != nil {
+		t.Fatalf("creating message: %v", err)
+	}
+	return message
+}
+
+func TestItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		alice := createUser(t, repos, "alice")
+		bob := createUser(t, repos, "bob")
+
+		umbrella := createItem(t, repos, "Blue umbrella", "lost", alice)
+		createItem(t, repos, "Red umbrella", "found", bob)
+		createItem(t, repos, "Student card", "found", bob)
+
+		got, err := repos.Items.Get(ctx, umbrella.ID)
+		if err != nil || got.Title != "Blue umbrella" {
+			t.Fatalf("Get = %q, %v", got.Title, err)
+		}
+		if _, err := repos.Items.Get(ctx, 99); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Get missing item: %v, want ErrNotFound", err)
+		}
+
+		tests := []struct {
+			name   string
+			filter repository.ItemFilter
+			total  int
+		}{
+			{"all", repository.ItemFilter{Limit: 10}, 3},
+			{"status", repository.ItemFilter{Status: "found", Limit: 10}, 2},
+			{"search ignores case", repository.ItemFilter{Search: "UMBRELLA", Limit: 10}, 2},
+			{"owner", repository.ItemFilter{OwnerID: bob, Limit: 10}, 2},
+			{"page", repository.ItemFilter{Limit: 2, Offset: 2}, 3},
+		}
+		for _, tt := range tests {
+			items, total, err := repos.Items.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if total != tt.total || len(items) != min(tt.total-tt.filter.Offset, tt.filter.Limit) {
+				t.Errorf("%s: got %d items of %d, want %d in total", tt.name, len(items), total, tt.total)
+			}
+		}
+
+		// authorize can refuse the change, which leaves the item alone
+		refused := errors.New("refused")
+		_, err = repos.Items.UpdateStatus(ctx, umbrella.ID, "claimed", bob, func(models.Item) error { return refused })
+		if !errors.Is(err, refused) {
+			t.Errorf("refused UpdateStatus: %v, want %v", err, refused)
+		}
+		updated, err := repos.Items.UpdateStatus(ctx, umbrella.ID, "claimed", alice, func(models.Item) error { return nil })
+		if err != nil || updated.Status != "claimed" || updated.ClaimedTime == nil {
+			t.Errorf("UpdateStatus = %q claimed at %v, %v", updated.Status, updated.ClaimedTime, err)
+		}
+		if _, err := repos.Items.UpdateStatus(ctx, 99, "claimed", alice, func(models.Item) error { return nil }); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("UpdateStatus missing item: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestConversationsAndMessages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		alice := createUser(t, repos, "alice")
+		bob := createUser(t, repos, "bob")
+		carol := createUser(t, repos, "carol")
+		item := createItem(t, repos, "Wallet", "found", bob)
+
+		conversationID, err := repos.Conversations.FindOrCreate(ctx, &item.ID, alice, bob)
+		if err != nil {
+			t.Fatalf("FindOrCreate: %v", err)
+		}
+		again, err := repos.Conversations.FindOrCreate(ctx, &item.ID, bob, alice)
+		if err != nil || again != conversationID {
+			t.Errorf("FindOrCreate for the other user = %d, %v, want %d", again, err, conversationID)
+		}
+		direct, err := repos.Conversations.FindOrCreate(ctx, nil, alice, bob)
+		if err != nil || direct == conversationID {
+			t.Errorf("FindOrCreate without an item = %d, %v, want a new conversation", direct, err)
+		}
+
+		if role, err := repos.Conversations.ParticipantRole(ctx, conversationID, alice); err != nil || role != "participant" {
+			t.Errorf("ParticipantRole = %q, %v", role, err)
+		}
+		if _, err := repos.Conversations.ParticipantRole(ctx, conversationID, carol); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("ParticipantRole of an outsider: %v, want ErrNotFound", err)
+		}
+		if err := repos.Conversations.AddParticipant(ctx, conversationID, carol, "mediator"); err != nil {
+			t.Fatalf("AddParticipant: %v", err)
+		}
+		participants, err := repos.Conversations.Participants(ctx, conversationID)
+		if err != nil || len(participants) != 3 || participants[2].Role != "mediator" || participants[0].Username != "alice" {
+			t.Errorf("Participants = %+v, %v", participants, err)
+		}
+
+		first := sendMessage(t, repos, conversationID, item.ID, alice, bob, "Is this my wallet?")
+		sendMessage(t, repos, conversationID, item.ID, alice, bob, "It is brown")
+		sendMessage(t, repos, conversationID, item.ID, bob, alice, "Come to the front desk")
+
+		messages, total, err := repos.Messages.ListInConversation(ctx, conversationID, 2, 0)
+		if err != nil || total != 3 || len(messages) != 2 || messages[0].SenderUsername != "bob" {
+			t.Errorf("ListInConversation = %d of %d, %v", len(messages), total, err)
+		}
+		between, total, err := repos.Messages.ListBetween(ctx, bob, alice, &item.ID, 10, 0)
+		if err != nil || total != 3 || between[len(between)-1].ID != first.ID {
+			t.Errorf("ListBetween = %d of %d, %v", len(between), total, err)
+		}
+
+		if unread, err := repos.Messages.UnreadCount(ctx, bob); err != nil || unread != 2 {
+			t.Errorf("UnreadCount = %d, %v, want 2", unread, err)
+		}
+		if read, err := repos.Conversations.MarkRead(ctx, conversationID, bob); err != nil || read != 2 {
+			t.Errorf("MarkRead = %d, %v, want 2", read, err)
+		}
+		if unread, err := repos.Messages.UnreadCount(ctx, bob); err != nil || unread != 0 {
+			t.Errorf("UnreadCount after reading = %d, %v, want 0", unread, err)
+		}
+		if read, err := repos.Messages.MarkRead(ctx, alice, bob); err != nil || read != 1 {
+			t.Errorf("Messages.MarkRead = %d, %v, want 1", read, err)
+		}
+
+		summaries, err := repos.Conversations.List(ctx, repository.ConversationFilter{UserID: alice})
+		if err != nil || len(summaries) != 2 || summaries[0].ID != conversationID || summaries[1].ID != direct {
+			t.Errorf("List = %+v, %v, want both conversations, most recently active first", summaries, err)
+		}
+
+		if shared, err := repos.Conversations.ShareConversation(ctx, bob, carol); err != nil || !shared {
+			t.Errorf("ShareConversation = %v, %v", shared, err)
+		}
+	})
+}
+
+func TestPrivacy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		alice := createUser(t, repos, "alice")
+		bob := createUser(t, repos, "bob")
+
+		if err := repos.Privacy.Block(ctx, alice, bob); err != nil {
+			t.Fatalf("Block: %v", err)
+		}
+		if err := repos.Privacy.Block(ctx, alice, bob); err != nil {
+			t.Errorf("blocking twice: %v", err)
+		}
+		if blocked, err := repos.Privacy.IsBlocked(ctx, bob, alice); err != nil || !blocked {
+			t.Errorf("IsBlocked from the other side = %v, %v", blocked, err)
+		}
+		blocks, err := repos.Privacy.Blocks(ctx, alice)
+		if err != nil || len(blocks) != 1 || blocks[0].BlockedUsername != "bob" {
+			t.Errorf("Blocks = %+v, %v", blocks, err)
+		}
+		if err := repos.Privacy.Unblock(ctx, alice, bob); err != nil {
+			t.Errorf("Unblock: %v", err)
+		}
+		if err := repos.Privacy.Unblock(ctx, alice, bob); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("unblocking twice: %v, want ErrNotFound", err)
+		}
+
+		if _, err := repos.Privacy.Settings(ctx, alice); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Settings before saving: %v, want ErrNotFound", err)
+		}
+		settings := models.UserSettings{
+			UserID:          alice,
+			MessagePolicy:   "item_related",
+			MaskedContact:   true,
+			NameVisibility:  "everyone",
+			EmailVisibility: "nobody",
+			PhoneVisibility: "nobody",
+			UpdatedAt:       time.Now(),
+		}
+		if err := repos.Privacy.SaveSettings(ctx, settings); err != nil {
+			t.Fatalf("SaveSettings: %v", err)
+		}
+		if got, err := repos.Privacy.Settings(ctx, alice); err != nil || got.MessagePolicy != "item_related" || !got.MaskedContact {
+			t.Errorf("Settings = %+v, %v", got, err)
+		}
+
+		// The email frequency is kept with the settings without replacing them
+		if _, err := repos.Privacy.EmailFrequency(ctx, bob); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("EmailFrequency before choosing: %v, want ErrNotFound", err)
+		}
+		if err := repos.Privacy.SetEmailFrequency(ctx, alice, "daily"); err != nil {
+			t.Fatalf("SetEmailFrequency: %v", err)
+		}
+		if frequency, err := repos.Privacy.EmailFrequency(ctx, alice); err != nil || frequency != "daily" {
+			t.Errorf("EmailFrequency = %q, %v", frequency, err)
+		}
+		if got, err := repos.Privacy.Settings(ctx, alice); err != nil || got.MessagePolicy != "item_related" {
+			t.Errorf("Settings after SetEmailFrequency = %+v, %v", got, err)
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		alice := createUser(t, repos, "alice")
+		bob := createUser(t, repos, "bob")
+
+		key := models.APIKey{
+			UserID:      alice,
+			Name:        "kiosk",
+			Prefix:      "abcd1234",
+			KeyHash:     "hash",
+			Permissions: models.StringList{"items:create"},
+			CreatedBy:   &alice,
+			CreatedAt:   time.Now(),
+		}
+		if err := repos.APIKeys.Create(ctx, &key); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		owned, err := repos.APIKeys.GetByPrefix(ctx, "abcd1234")
+		if err != nil || owned.ID != key.ID || owned.Username != "alice" || owned.Role != "student" {
+			t.Errorf("GetByPrefix = %+v, %v", owned, err)
+		}
+		if keys, total, err := repos.APIKeys.List(ctx, bob, 10, 0); err != nil || total != 0 || len(keys) != 0 {
+			t.Errorf("List for another user = %d of %d, %v", len(keys), total, err)
+		}
+
+		// Only the owner, or anyone with userID 0, can revoke a key, and only once
+		if err := repos.APIKeys.Revoke(ctx, key.ID, bob); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Revoke by another user: %v, want ErrNotFound", err)
+		}
+		if err := repos.APIKeys.Revoke(ctx, key.ID, 0); err != nil {
+			t.Errorf("Revoke: %v", err)
+		}
+		if err := repos.APIKeys.Revoke(ctx, key.ID, alice); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("revoking twice: %v, want ErrNotFound", err)
+		}
+		keys, err := repos.APIKeys.ListForUser(ctx, alice)
+		if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+			t.Errorf("ListForUser = %+v, %v, want the revoked key", keys, err)
+		}
+	})
+}
+
+func TestLoginAttempts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		ctx := context.Background()
+		alice := createUser(t, repos, "alice")
+		start := time.Now().Add(-time.Minute)
+
+		var ids []int
+		for i, reason := range []string{"invalid_password", "unknown_user", "success", "pending"} {
+			attempt := models.LoginAttempt{
+				Username:  "alice",
+				IPAddress: "10.0.0.1",
+				Reason:    "pending",
+				CreatedAt: start.Add(time.Duration(i) * time.Second),
+			}
+			if err := repos.LoginAttempts.Create(ctx, &attempt); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if reason != "pending" {
+				if err := repos.LoginAttempts.Finish(ctx, attempt.ID, &alice, reason); err != nil {
+					t.Fatalf("Finish: %v", err)
+				}
+			}
+			ids = append(ids, attempt.ID)
+		}
+
+		// Failed and pending attempts made before the current one count
+		failures, last, err := repos.LoginAttempts.RecentFailures(ctx, "10.0.0.1", start.Add(-time.Second), ids[3]+1)
+		if err != nil || failures != 3 || last == nil {
+			t.Errorf("RecentFailures = %d, %v, %v, want 3", failures, last, err)
+		}
+		if failures, _, err := repos.LoginAttempts.RecentFailures(ctx, "10.0.0.2", start, ids[3]+1); err != nil || failures != 0 {
+			t.Errorf("RecentFailures from another IP = %d, %v", failures, err)
+		}
+
+		succeeded := true
+		attempts, total, err := repos.LoginAttempts.List(ctx, repository.LoginAttemptFilter{Success: &succeeded, Limit: 10})
+		if err != nil || total != 1 || attempts[0].Reason != "success" || attempts[0].UserID == nil {
+			t.Errorf("List successful = %+v, %v", attempts, err)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, repos repository.Repositories) {
+		alice := createUser(t, repos, "alice")
+		createItem(t, repos, "Wallet", "lost", alice)
+		createItem(t, repos, "Keys", "found", alice)
+
+		stats, err := repos.Stats.Get(context.Background())
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		want := repository.Stats{TotalUsers: 1, StudentCount: 1, TotalItems: 2, LostItems: 1, FoundItems: 1}
+		if stats != want {
+			t.Errorf("Get = %+v, want %+v", stats, want)
+		}
+	})
+}
@@ -2,8 +2,13 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/omniflare/campus-lostandfound/internal/config"
 	"github.com/omniflare/campus-lostandfound/internal/controller"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
 	"github.com/omniflare/campus-lostandfound/internal/middleware"
+	"github.com/omniflare/campus-lostandfound/internal/openapi"
+	"github.com/omniflare/campus-lostandfound/internal/permissions"
+	"github.com/omniflare/campus-lostandfound/internal/ratelimit"
 )
 
 // SetupRoutes configures all the routes for the application
@@ -16,49 +21,118 @@ func SetupRoutes(app *fiber.App) {
 		})
 	})
 
+	// Liveness and readiness probes
+	app.Get("/health/live", controller.Live)
+	app.Get("/health/ready", controller.Ready(config.Get().Metrics.Token))
+
+	// Prometheus metrics, optionally behind METRICS_TOKEN
+	app.Get("/metrics", metrics.Handler(config.Get().Metrics.Token))
+
+	// Rate limits: per IP on public routes, per user on writes, shared by the routes using them.
+	// Public routes do not run Auth, so no role is known there and no one is exempt.
+	limits := config.Get().RateLimit
+	publicLimit := middleware.RateLimit("public", ratelimit.PerMinute(limits.Public, limits.PublicBurst), nil)
+	writeLimit := middleware.RateLimit("writes", ratelimit.PerMinute(limits.Writes, limits.WritesBurst), limits.ExemptRoles)
+
+	// Retries of writes sent with an Idempotency-Key get the first response, without spending a token
+	idempotent := middleware.Idempotency()
+
 	// API routes
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
 
+	// OpenAPI document and its interactive documentation
+	v1.Get("/openapi.json", openapi.Handler())
+	v1.Get("/docs", openapi.DocsHandler())
+
 	// Auth routes - no authentication required
 	auth := v1.Group("/auth")
-	auth.Post("/register", controller.RegisterUser)
-	auth.Post("/login", controller.LoginUser)
+	auth.Post("/register", publicLimit, controller.RegisterUser)
+	auth.Post("/login", publicLimit, controller.LoginUser)
+
+	// Email unsubscribe links - authenticated by a signed token. GET only shows a
+	// confirmation page; the form and RFC 8058 one-click clients unsubscribe with POST
+	v1.Get("/unsubscribe", controller.UnsubscribePage)
+	v1.Post("/unsubscribe", controller.Unsubscribe)
 
 	// User routes - authentication required
 	user := v1.Group("/user", middleware.Auth())
-	user.Get("/profile", controller.GetUserProfile)
-	user.Put("/profile", controller.UpdateUserProfile)
-	user.Put("/password", controller.ChangePassword)
-	user.Get("/items", controller.GetUserItems)
-	user.Get("/messages/unread", controller.GetUnreadMessageCount)
-	user.Get("/messages/conversations", controller.GetConversations)
-	user.Get("/messages/:id", controller.GetMessages)
-	user.Post("/messages", controller.SendMessage)
-	user.Post("/reports", controller.CreateReport)
+	user.Get("/profile", middleware.Require(permissions.ProfileManage), controller.GetUserProfile)
+	user.Put("/profile", middleware.Require(permissions.ProfileManage), controller.UpdateUserProfile)
+	user.Put("/password", middleware.Require(permissions.ProfileManage), controller.ChangePassword)
+	user.Get("/items", middleware.Require(permissions.ProfileManage), controller.GetUserItems)
+	user.Get("/messages/unread", middleware.Require(permissions.MessagesSend), controller.GetUnreadMessageCount)
+	user.Get("/messages/conversations", middleware.Require(permissions.MessagesSend), controller.GetConversations)
+	user.Get("/messages/:id", middleware.Require(permissions.MessagesSend), controller.GetMessages)
+	user.Post("/messages", middleware.Require(permissions.MessagesSend), idempotent, writeLimit, controller.SendMessage)
+	user.Get("/conversations/:id/messages", middleware.Require(permissions.MessagesSend), controller.GetConversationMessages)
+	user.Post("/conversations/:id/messages", middleware.Require(permissions.MessagesSend), idempotent, writeLimit, controller.SendConversationMessage)
+	user.Post("/conversations/:id/participants", middleware.Require(permissions.MessagesSend), controller.AddConversationParticipant)
+	user.Post("/conversations/:id/attachments", middleware.Require(permissions.MessagesSend), idempotent, writeLimit, controller.UploadMessageAttachment)
+	user.Get("/attachments/:id", middleware.Require(permissions.MessagesSend), controller.GetMessageAttachment)
+	user.Get("/blocks", middleware.Require(permissions.MessagesSend), controller.GetBlockedUsers)
+	user.Post("/blocks", middleware.Require(permissions.MessagesSend), controller.BlockUser)
+	user.Delete("/blocks/:id", middleware.Require(permissions.MessagesSend), controller.UnblockUser)
+	user.Get("/settings", middleware.Require(permissions.ProfileManage), controller.GetUserSettings)
+	user.Put("/settings", middleware.Require(permissions.ProfileManage), controller.UpdateUserSettings)
+	user.Get("/notifications", middleware.Require(permissions.ProfileManage), controller.GetNotifications)
+	user.Get("/notifications/unread", middleware.Require(permissions.ProfileManage), controller.GetUnreadNotificationCount)
+	user.Put("/notifications/read", middleware.Require(permissions.ProfileManage), controller.MarkAllNotificationsRead)
+	user.Put("/notifications/:id/read", middleware.Require(permissions.ProfileManage), controller.MarkNotificationRead)
+	user.Get("/notification-preferences", middleware.Require(permissions.ProfileManage), controller.GetNotificationPreferences)
+	user.Put("/notification-preferences", middleware.Require(permissions.ProfileManage), controller.UpdateNotificationPreferences)
+	user.Post("/reports", middleware.Require(permissions.ReportsCreate), idempotent, writeLimit, controller.CreateReport)
+	user.Get("/api-keys", middleware.Require(permissions.APIKeysCreate), controller.GetAPIKeys)
+	user.Post("/api-keys", middleware.Require(permissions.APIKeysCreate), controller.CreateAPIKey)
+	user.Delete("/api-keys/:id", middleware.Require(permissions.APIKeysCreate), controller.RevokeAPIKey)
+
+	// Realtime messaging - JWT checked during the websocket handshake
+	v1.Get("/ws", controller.WebSocketAuth, controller.MessagesSocket)
+
+	// Public profiles - authentication required, fields limited by privacy settings
+	users := v1.Group("/users", middleware.Auth())
+	users.Get("/:id", controller.GetPublicProfile)
 
 	// Item routes
 	items := v1.Group("/items")
-	items.Get("", controller.GetItems)           // Public - no auth required
-	items.Get("/search", controller.SearchItems) // Public - no auth required
-	items.Get("/:id", controller.GetItemDetails) // Public - no auth required
+	items.Get("", publicLimit, controller.GetItems)           // Public - no auth required
+	items.Get("/search", publicLimit, controller.SearchItems) // Public - no auth required
+	items.Get("/:id", publicLimit, controller.GetItemDetails) // Public - no auth required
 
 	// Protected item routes - authentication required
 	itemsAuth := v1.Group("/items", middleware.Auth())
-	itemsAuth.Post("/lost", controller.ReportLostItem)
-	itemsAuth.Post("/found", controller.ReportFoundItem)
-	itemsAuth.Put("/:id/status", controller.UpdateItemStatus)
-	itemsAuth.Post("/:id/image", controller.UploadItemImage)
-
-	// Guard routes - guard and admin only
-	guard := v1.Group("/guard", middleware.GuardAndAdmin())
-	guard.Get("/items", controller.GetItems) // Reusing the controller but with guard middleware
-
-	// Admin routes - admin only
-	admin := v1.Group("/admin", middleware.AdminOnly())
-	admin.Get("/users", controller.GetUsers)
-	admin.Put("/users/:id/role", controller.UpdateUserRole)
-	admin.Get("/reports", controller.GetReports)
-	admin.Put("/reports/:id/status", controller.UpdateReportStatus)
-	admin.Get("/stats", controller.GetStats)
+	itemsAuth.Post("/lost", middleware.Require(permissions.ItemsCreate), idempotent, writeLimit, controller.ReportLostItem)
+	itemsAuth.Post("/found", middleware.Require(permissions.ItemsCreate), idempotent, writeLimit, controller.ReportFoundItem)
+	itemsAuth.Put("/:id/status", controller.UpdateItemStatus) // Ownership and permissions checked in the controller
+	itemsAuth.Post("/:id/image", middleware.Require(permissions.ItemsCreate), idempotent, writeLimit, controller.UploadItemImage)
+	itemsAuth.Get("/:id/conversations", middleware.Require(permissions.MessagesSend), controller.GetItemConversations)
+
+	// Live item feed for the security desk - registered before the guard group
+	// so the JWT may be passed as ?token= by EventSource clients
+	v1.Get("/guard/items/stream", middleware.StreamAuth(), middleware.Require(permissions.ItemsViewAll), controller.StreamItems)
+
+	// Guard routes
+	guard := v1.Group("/guard", middleware.Auth())
+	guard.Get("/items", middleware.Require(permissions.ItemsViewAll), controller.GetItems) // Reusing the controller but with guard permission
+
+	// Admin routes
+	admin := v1.Group("/admin", middleware.Auth())
+	admin.Get("/users", middleware.Require(permissions.UsersView), controller.GetUsers)
+	admin.Put("/users/:id/role", middleware.Require(permissions.UsersManageRoles), controller.UpdateUserRole)
+	admin.Put("/users/:id/unlock", middleware.Require(permissions.UsersUnlock), controller.UnlockUser)
+	admin.Get("/login-attempts", middleware.Require(permissions.AuditView), controller.GetLoginAttempts)
+	admin.Get("/reports", middleware.Require(permissions.ReportsView), controller.GetReports)
+	admin.Put("/reports/:id/status", middleware.Require(permissions.ReportsResolve), controller.UpdateReportStatus)
+	admin.Get("/stats", middleware.Require(permissions.StatsView), controller.GetStats)
+	admin.Get("/permissions", middleware.Require(permissions.PermissionsManage), controller.GetPermissions)
+	admin.Put("/roles/:role/permissions", middleware.Require(permissions.PermissionsManage), controller.UpdateRolePermissions)
+	admin.Get("/webhooks", middleware.Require(permissions.WebhooksManage), controller.GetWebhooks)
+	admin.Post("/webhooks", middleware.Require(permissions.WebhooksManage), controller.CreateWebhook)
+	admin.Put("/webhooks/:id", middleware.Require(permissions.WebhooksManage), controller.UpdateWebhook)
+	admin.Delete("/webhooks/:id", middleware.Require(permissions.WebhooksManage), controller.DeleteWebhook)
+	admin.Post("/webhooks/:id/test", middleware.Require(permissions.WebhooksManage), controller.SendTestWebhook)
+	admin.Get("/webhooks/:id/deliveries", middleware.Require(permissions.WebhooksManage), controller.GetWebhookDeliveries)
+	admin.Get("/api-keys", middleware.Require(permissions.APIKeysManage), controller.AdminGetAPIKeys)
+	admin.Post("/users/:id/api-keys", middleware.Require(permissions.APIKeysManage), controller.AdminCreateAPIKey)
+	admin.Delete("/api-keys/:id", middleware.Require(permissions.APIKeysManage), controller.AdminRevokeAPIKey)
 }
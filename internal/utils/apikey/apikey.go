@@ -0,0 +1,53 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// keyPrefix marks a string as one of our API keys
+const keyPrefix = "lfk_"
+
+// Generate creates a new API key. It returns the full key, which is shown to
+// the user exactly once, the public prefix used to look the key up, and the
+// hash that is stored in the database.
+func Generate() (key, prefix, hash string, err error) {
+	prefixBytes := make([]byte, 4)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return "", "", "", err
+	}
+	secretBytes := make([]byte, 24)
+	if _, err = rand.Read(secretBytes); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = keyPrefix + prefix + "_" + hex.EncodeToString(secretBytes)
+	return key, prefix, Hash(key), nil
+}
+
+// Prefix extracts the public prefix from a key
+func Prefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", false
+	}
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(key, keyPrefix), "_")
+	if !ok || len(prefix) != 8 {
+		return "", false
+	}
+	return prefix, true
+}
+
+// Hash returns the hex encoded SHA-256 hash of a key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports whether key hashes to the stored hash in constant time
+func Matches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
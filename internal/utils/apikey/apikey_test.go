@@ -0,0 +1,80 @@
+package apikey
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	format := regexp.MustCompile(`^lfk_[0-9a-f]{8}_[0-9a-f]{48}$`)
+
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !format.MatchString(key) {
+		t.Errorf("key %q does not match %s", key, format)
+	}
+	if parsed, ok := Prefix(key); !ok || parsed != prefix {
+		t.Errorf("Prefix(key) = %q, %v, want %q", parsed, ok, prefix)
+	}
+	if hash != Hash(key) || !Matches(key, hash) {
+		t.Error("the returned hash does not match the key")
+	}
+
+	other, otherPrefix, otherHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key || otherPrefix == prefix || otherHash == hash {
+		t.Error("two generated keys share a key, prefix or hash")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"lfk_0a1b2c3d_secret", "0a1b2c3d", true},
+		{"lfk_0a1b2c3d_", "0a1b2c3d", true},
+		{"lfk_0a1b2c3d", "", false},      // No secret separator
+		{"lfk_0a1b2c_secret", "", false}, // Prefix too short
+		{"lfk_0a1b2c3d4e_secret", "", false},
+		{"xyz_0a1b2c3d_secret", "", false},
+		{"0a1b2c3d_secret", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		prefix, ok := Prefix(tt.key)
+		if prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("Prefix(%q) = %q, %v, want %q, %v", tt.key, prefix, ok, tt.prefix, tt.ok)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	key := "lfk_0a1b2c3d_secret"
+	hash := Hash(key)
+
+	if len(hash) != 64 || hash != Hash(key) {
+		t.Fatalf("Hash(%q) = %q, want a stable hex SHA-256", key, hash)
+	}
+	tests := []struct {
+		key, hash string
+		want      bool
+	}{
+		{key, hash, true},
+		{"lfk_0a1b2c3d_secreT", hash, false},
+		{"lfk_0a1b2c3d_secret ", hash, false},
+		{key, hash[:63], false},
+		{key, "", false},
+		{"", Hash(""), true},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.key, tt.hash); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.key, tt.hash, got, tt.want)
+		}
+	}
+}
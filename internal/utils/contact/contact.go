@@ -0,0 +1,43 @@
+package contact
+
+import "regexp"
+
+// Placeholder replaces redacted contact details
+const Placeholder = "[contact info hidden]"
+
+const (
+	// emailLocal is the part of an email address before the at
+	emailLocal = `[a-z0-9._%+\-]+`
+	// emailDot is a dot, "dot" in brackets such as [dot], or the word "dot"
+	emailDot = `(?:\s*(?:\.|[(\[{]\s*dot\s*[)\]}])\s*|\s+dot\s+)`
+	// emailDomain is the labels of a domain separated by emailDot
+	emailDomain = `[a-z0-9\-]+(?:` + emailDot + `[a-z0-9\-]+)*` + emailDot
+)
+
+var (
+	// Email addresses with an @ or "at" in brackets, such as name [at] domain [dot] com
+	emailPattern = regexp.MustCompile(`(?i)` + emailLocal + `\s*(?:@|[(\[{]\s*at\s*[)\]}])\s*` + emailDomain + `[a-z]{2,}\b`)
+
+	// Email addresses spelled out as "name at domain dot com". Since "at" and
+	// "dot" are ordinary words, they only count with a common top-level domain.
+	spelledEmailPattern = regexp.MustCompile(`(?i)` + emailLocal + `\s+at\s+` + emailDomain + `(?:com|net|org|edu|gov|io|info|biz|uk|us|ca|au|de|fr|eu)\b`)
+
+	// Phone numbers are runs of at least 7 digits, optionally with a leading +
+	// and spaces, dots, dashes or brackets between them
+	phonePattern = regexp.MustCompile(`\+?\(?\d(?:[\s.\-()]*\d){6,}`)
+)
+
+// Detect reports whether text appears to contain an email address or phone number
+func Detect(text string) bool {
+	return emailPattern.MatchString(text) || spelledEmailPattern.MatchString(text) || phonePattern.MatchString(text)
+}
+
+// Redact replaces email addresses and phone numbers in text with Placeholder
+// and reports whether anything was replaced
+func Redact(text string) (string, bool) {
+	// Addresses with an @ go first, so that "at" before one is not read as spelled out
+	redacted := emailPattern.ReplaceAllString(text, Placeholder)
+	redacted = spelledEmailPattern.ReplaceAllString(redacted, Placeholder)
+	redacted = phonePattern.ReplaceAllString(redacted, Placeholder)
+	return redacted, redacted != text
+}
@@ -0,0 +1,56 @@
+package contact
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		// Email addresses
+		{"email", "Mail me at jane.doe@example.edu please", "Mail me at " + Placeholder + " please"},
+		{"email with subdomain", "jane+lost@mail.example.co.uk", Placeholder},
+		{"email with spaces", "jane @ example . com", Placeholder},
+		{"bracketed at and dot", "jane[at]example[dot]com", Placeholder},
+		{"parenthesized at and dot", "jane (at) example (dot) com", Placeholder},
+		{"braced at and dot", "jane {at} example {dot} com", Placeholder},
+		{"spelled out", "write to jane at example dot com", "write to " + Placeholder},
+		{"spelled out in capitals", "JANE AT EXAMPLE DOT COM", Placeholder},
+		{"spelled out with several dots", "jane at mail dot example dot edu", Placeholder},
+		{"spelled out at with a real dot", "jane at example.com", Placeholder},
+
+		// Phone numbers
+		{"phone", "Call 5551234567", "Call " + Placeholder},
+		{"spaced phone", "call 555 123 4567 tonight", "call " + Placeholder + " tonight"},
+		{"dashed phone", "555-123-4567", Placeholder},
+		{"dotted phone", "555.123.4567", Placeholder},
+		{"international phone", "+44 20 7946 0958", Placeholder},
+		{"phone with area code in brackets", "(555) 123-4567", Placeholder},
+		{"phone with spaced dashes", "555 - 123 - 4567", Placeholder},
+		{"digits spaced out", "5 5 5 1 2 3 4", Placeholder},
+
+		// Text that is not contact information
+		{"plain text", "I lost my blue umbrella in the library", "I lost my blue umbrella in the library"},
+		{"room number", "Left it in room 1204", "Left it in room 1204"},
+		{"time", "Meet at 10:30 at the gym", "Meet at 10:30 at the gym"},
+		{"short number", "Locker 123-45", "Locker 123-45"},
+		{"at without a domain", "I was at the canteen", "I was at the canteen"},
+		{"at and dot without a domain", "look at the dot on the map", "look at the dot on the map"},
+		{"sentence after at", "I am at home.Come over", "I am at home.Come over"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, redacted := Redact(tt.text)
+			if got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if redacted != (tt.want != tt.text) {
+				t.Errorf("Redact(%q) reported redacted = %v", tt.text, redacted)
+			}
+			if Detect(tt.text) != redacted {
+				t.Errorf("Detect(%q) = %v, but Redact reported %v", tt.text, Detect(tt.text), redacted)
+			}
+		})
+	}
+}
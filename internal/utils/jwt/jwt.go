@@ -2,10 +2,10 @@ package jwt
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/omniflare/campus-lostandfound/internal/config"
 	"github.com/omniflare/campus-lostandfound/internal/models"
 )
 
@@ -19,11 +19,10 @@ type Claims struct {
 
 // Generate generates a new JWT token for a user
 func Generate(user models.User) (string, error) {
-	// Get the JWT secret from environment variable or use a default one
-	secret := getEnv("JWT_SECRET", "your_default_secret_key")
+	auth := config.Get().Auth
 
-	// Create claims with 24-hour expiration time
-	expirationTime := time.Now().Add(24 * time.Hour)
+	// Create claims that expire after the configured token lifetime
+	expirationTime := time.Now().Add(auth.TokenTTL)
 	claims := &Claims{
 		UserID:   user.ID,
 		Username: user.Username,
@@ -38,7 +37,7 @@ func Generate(user models.User) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := token.SignedString([]byte(auth.JWTSecret))
 	if err != nil {
 		return "", err
 	}
@@ -48,8 +47,7 @@ func Generate(user models.User) (string, error) {
 
 // Validate validates a JWT token and returns the claims if valid
 func Validate(tokenString string) (*Claims, error) {
-	// Get the JWT secret from environment variable or use a default one
-	secret := getEnv("JWT_SECRET", "your_default_secret_key")
+	secret := config.Get().Auth.JWTSecret
 
 	// Parse the token
 	claims := &Claims{}
@@ -71,12 +69,3 @@ func Validate(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
-
-// getEnv gets the environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	return value
-}
@@ -0,0 +1,62 @@
+package lockout
+
+import "time"
+
+const (
+	// MaxAccountFailures is the number of consecutive failed logins an account
+	// may have before it is temporarily locked
+	MaxAccountFailures = 5
+
+	// MaxIPFailures is the number of failed logins a single IP address may make
+	// within IPWindow before it is throttled
+	MaxIPFailures = 20
+
+	// IPWindow is the period over which failed logins from an IP are counted
+	IPWindow = 15 * time.Minute
+
+	// BaseDelay is the lockout applied once a limit is first reached
+	BaseDelay = time.Minute
+
+	// MaxDelay caps the exponential backoff
+	MaxDelay = time.Hour
+)
+
+// Backoff returns the lockout duration for the given number of failures past
+// a limit. The delay doubles with every additional failure up to MaxDelay.
+func Backoff(excess int) time.Duration {
+	if excess < 0 {
+		return 0
+	}
+
+	delay := BaseDelay
+	for i := 0; i < excess; i++ {
+		delay *= 2
+		if delay >= MaxDelay {
+			return MaxDelay
+		}
+	}
+	return delay
+}
+
+// AccountLockedUntil returns when an account with the given number of
+// consecutive failures should be unlocked, or nil if it should not be locked
+func AccountLockedUntil(failures int, now time.Time) *time.Time {
+	if failures < MaxAccountFailures {
+		return nil
+	}
+	until := now.Add(Backoff(failures - MaxAccountFailures))
+	return &until
+}
+
+// IPRetryAfter returns how long an IP address with the given number of recent
+// failures, the latest at lastFailure, must wait before trying again
+func IPRetryAfter(failures int, lastFailure, now time.Time) time.Duration {
+	if failures < MaxIPFailures {
+		return 0
+	}
+	wait := lastFailure.Add(Backoff(failures - MaxIPFailures)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
@@ -0,0 +1,76 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		excess int
+		want   time.Duration
+	}{
+		{-1, 0},
+		{0, BaseDelay},
+		{1, 2 * BaseDelay},
+		{2, 4 * BaseDelay},
+		{5, 32 * BaseDelay},
+		{6, MaxDelay}, // 64 minutes is capped
+		{1000, MaxDelay},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.excess); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.excess, got, tt.want)
+		}
+	}
+}
+
+func TestAccountLockedUntil(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		failures int
+		want     time.Duration // 0 when the account is not locked
+	}{
+		{0, 0},
+		{MaxAccountFailures - 1, 0},
+		{MaxAccountFailures, BaseDelay},
+		{MaxAccountFailures + 1, 2 * BaseDelay},
+		{MaxAccountFailures + 100, MaxDelay},
+	}
+	for _, tt := range tests {
+		until := AccountLockedUntil(tt.failures, now)
+		switch {
+		case tt.want == 0 && until != nil:
+			t.Errorf("%d failures: locked until %v, want unlocked", tt.failures, until)
+		case tt.want != 0 && until == nil:
+			t.Errorf("%d failures: unlocked, want locked for %v", tt.failures, tt.want)
+		case tt.want != 0 && until.Sub(now) != tt.want:
+			t.Errorf("%d failures: locked for %v, want %v", tt.failures, until.Sub(now), tt.want)
+		}
+	}
+}
+
+func TestIPRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		failures    int
+		lastFailure time.Time
+		want        time.Duration
+	}{
+		{"below the limit", MaxIPFailures - 1, now, 0},
+		{"at the limit", MaxIPFailures, now, BaseDelay},
+		{"past the limit", MaxIPFailures + 2, now, 4 * BaseDelay},
+		{"partly waited", MaxIPFailures, now.Add(-20 * time.Second), 40 * time.Second},
+		{"fully waited", MaxIPFailures, now.Add(-BaseDelay), 0},
+		{"long ago", MaxIPFailures + 1, now.Add(-time.Hour), 0},
+		{"capped", MaxIPFailures + 100, now, MaxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IPRetryAfter(tt.failures, tt.lastFailure, now); got != tt.want {
+				t.Errorf("IPRetryAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/omniflare/campus-lostandfound/internal/database"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/metrics"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+	"github.com/omniflare/campus-lostandfound/internal/tracing"
+	"github.com/omniflare/campus-lostandfound/internal/worker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// TestEvent is the event type sent by the "send test event" action
+const TestEvent = "webhook.test"
+
+// EventTypes lists the events a webhook can subscribe to
+var EventTypes = []string{events.ItemCreated, events.ItemStatusChanged, events.ClaimApproved, events.ReportCreated}
+
+// Delivery tuning
+const (
+	MaxAttempts     = 6
+	BaseRetry       = 30 * time.Second
+	MaxRetry        = time.Hour
+	requestTimeout  = 10 * time.Second
+	pollInterval    = 5 * time.Second
+	batchSize       = 20
+	maxResponseBody = 2048
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrInvalidSignature is returned by Verify for payloads that were not signed with the secret
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Payload is the JSON body posted to webhook endpoints
+type Payload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// client does not follow redirects, so that a delivery only ever reaches the
+// configured URL. A redirect response counts as a failed delivery.
+var client = &http.Client{
+	Timeout: requestTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// ValidEventType reports whether webhooks can subscribe to the event type
+func ValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random signing secret for a webhook
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a payload sent at the timestamp.
+// The signed content is "<timestamp>.<body>" so that a captured request cannot
+// be replayed later with a new timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a received payload.
+// Receivers should reject timestamps older than the tolerance.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(ts, 0)); tolerance > 0 && math.Abs(float64(age)) > float64(tolerance) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RegisterHandler records a delivery for every subscribed webhook when an
+// outbox event is dispatched
+func RegisterHandler() {
+	events.Handle(func(tx *events.Tx, event events.Event) error {
+		return enqueue(tx, event)
+	}, EventTypes...)
+}
+
+// RunDeliveries sends pending deliveries until ctx is cancelled
+func RunDeliveries(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		worker.Beat(ctx, pollInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processQueue()
+		}
+	}
+}
+
+// SendTest sends a test event to the webhook straight away and returns the delivery
+func SendTest(ctx context.Context, webhook models.Webhook) (models.WebhookDelivery, error) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"message":    "This is a test event from Campus Lost & Found",
+		"webhook_id": webhook.ID,
+	})
+	payload, err := json.Marshal(Payload{ID: events.NewID(), Type: TestEvent, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	// The delivery is inserted already claimed, so that the queue leaves it to
+	// this request. A test is only tried once so that it does not linger in
+	// the retry queue.
+	now := time.Now()
+	var delivery models.WebhookDelivery
+	err = database.DB.GetContext(ctx, &delivery, `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, 'pending', 1, $5, $6)
+		RETURNING *
+	`, webhook.ID, events.NewID(), TestEvent, string(payload), now.Add(RetryDelay(1)), now)
+	if err != nil {
+		return delivery, err
+	}
+	return attempt(ctx, delivery, webhook, 1)
+}
+
+// enqueue records a pending delivery of the event for each active webhook
+// subscribed to it. Subscriptions are compared in Go rather than with LIKE, so
+// that characters such as _ in an event type are not read as wildcards.
+func enqueue(q sqlx.Ext, event events.Event) error {
+	payload, err := json.Marshal(Payload{ID: event.ID, Type: event.Type, CreatedAt: event.Time, Data: event.Data})
+	if err != nil {
+		return err
+	}
+
+	var subscribed []models.Webhook
+	if err := sqlx.Select(q, &subscribed, "SELECT id, event_types FROM webhooks WHERE active"); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, webhook := range subscribed {
+		if !slices.Contains(webhook.EventTypes, event.Type) {
+			continue
+		}
+		_, err := q.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, 'pending', $5, $5)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING
+		`, webhook.ID, event.ID, event.Type, string(payload), now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processQueue sends up to one batch of due deliveries
+func processQueue() {
+	defer metrics.ObserveJob("webhook-deliveries", time.Now())
+	for i := 0; i < batchSize; i++ {
+		sent, err := deliverNext()
+		if err != nil {
+			slog.Error("Error processing webhook deliveries", "error", err)
+			return
+		}
+		if !sent {
+			return
+		}
+	}
+}
+
+// deliverNext claims the next due delivery and attempts it. It reports whether
+// a delivery was found. Claiming counts the attempt and schedules the retry in
+// a transaction that commits before the request is sent, so that several
+// instances can share the queue without holding a lock during delivery, and a
+// delivery whose sender dies is retried.
+func deliverNext() (bool, error) {
+	delivery, webhook, err := claimNext()
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := attempt(context.Background(), delivery, webhook, MaxAttempts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// claimNext locks the next due delivery, counts the attempt and moves its next
+// attempt to when it would be retried, then commits. It returns sql.ErrNoRows
+// when no delivery is due.
+func claimNext() (models.WebhookDelivery, models.Webhook, error) {
+	var delivery models.WebhookDelivery
+	var webhook models.Webhook
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return delivery, webhook, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	err = tx.Get(&delivery, `
+		SELECT * FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, now)
+	if err != nil {
+		return delivery, webhook, err
+	}
+	if err := tx.Get(&webhook, "SELECT * FROM webhooks WHERE id = $1", delivery.WebhookID); err != nil {
+		return delivery, webhook, err
+	}
+
+	delivery.Attempts++
+	delivery.NextAttemptAt = now.Add(RetryDelay(delivery.Attempts))
+	_, err = tx.Exec("UPDATE webhook_deliveries SET attempts = $1, next_attempt_at = $2 WHERE id = $3",
+		delivery.Attempts, delivery.NextAttemptAt, delivery.ID)
+	if err != nil {
+		return delivery, webhook, err
+	}
+	return delivery, webhook, tx.Commit()
+}
+
+// attempt posts a claimed delivery's payload to the webhook and records the
+// outcome. A failed delivery keeps the retry set when it was claimed, until
+// maxAttempts is reached. The outcome is not recorded if the claim expired
+// and the delivery was claimed again.
+func attempt(ctx context.Context, delivery models.WebhookDelivery, webhook models.Webhook, maxAttempts int) (models.WebhookDelivery, error) {
+	delivery.ResponseStatus, delivery.ResponseBody, delivery.LastError, delivery.DurationMS = nil, nil, nil, nil
+
+	var sendErr error
+	if webhook.Active || delivery.EventType == TestEvent {
+		start := time.Now()
+		var status int
+		var body string
+		status, body, sendErr = send(ctx, webhook, delivery)
+		elapsed := int(time.Since(start).Milliseconds())
+		delivery.DurationMS = &elapsed
+		if status != 0 {
+			delivery.ResponseStatus = &status
+			delivery.ResponseBody = &body
+		}
+	} else {
+		// Deliveries queued before the webhook was disabled are dropped
+		sendErr = errors.New("webhook disabled")
+		maxAttempts = 0
+	}
+
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		delivery.Status = "succeeded"
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = "failed"
+	}
+	if sendErr != nil {
+		msg := sendErr.Error()
+		delivery.LastError = &msg
+	}
+
+	// Record the outcome even if the request that sent a test has gone away
+	_, err := database.DB.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE webhook_deliveries
+		SET status = $1, response_status = $2, response_body = $3, last_error = $4, duration_ms = $5, delivered_at = $6
+		WHERE id = $7 AND attempts = $8
+	`, delivery.Status, delivery.ResponseStatus, delivery.ResponseBody, delivery.LastError, delivery.DurationMS,
+		delivery.DeliveredAt, delivery.ID, delivery.Attempts)
+	return delivery, err
+}
+
+// send posts a signed payload and returns the response status and the start
+// of its body. The trace context is sent along so receivers can join the trace.
+func send(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) (status int, respBody string, err error) {
+	ctx, span := tracing.Start(ctx, "webhook "+delivery.EventType,
+		attribute.Int("webhook.id", webhook.ID),
+		attribute.Int("webhook.delivery_id", delivery.ID),
+		attribute.Int("webhook.attempt", delivery.Attempts))
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		tracing.End(span, err)
+	}()
+
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CampusLostAndFound-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderID, delivery.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	limited, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(limited), fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(limited), nil
+}
+
+// RetryDelay doubles the wait after each failed attempt, up to MaxRetry
+func RetryDelay(attempts int) time.Duration {
+	delay := BaseRetry
+	for i := 1; i < attempts && delay < MaxRetry; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetry {
+		delay = MaxRetry
+	}
+	return delay
+}
+
+// ValidURL reports whether the address is an absolute HTTP or HTTPS URL
+func ValidURL(address string) bool {
+	u, err := url.Parse(address)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,130 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/omniflare/campus-lostandfound/internal/database/databasetest"
+	"github.com/omniflare/campus-lostandfound/internal/events"
+	"github.com/omniflare/campus-lostandfound/internal/models"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"item.created"}`)
+	now := time.Now().Unix()
+	signature := Sign(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		timestamp string
+		body      []byte
+		tolerance time.Duration
+		ok        bool
+	}{
+		{"valid", secret, signature, strconv.FormatInt(now, 10), body, 5 * time.Minute, true},
+		{"wrong secret", "whsec_other", signature, strconv.FormatInt(now, 10), body, 5 * time.Minute, false},
+		{"altered body", secret, signature, strconv.FormatInt(now, 10), []byte(`{"type":"item.deleted"}`), 5 * time.Minute, false},
+		{"altered timestamp", secret, signature, strconv.FormatInt(now+1, 10), body, 5 * time.Minute, false},
+		{"missing signature", secret, "", strconv.FormatInt(now, 10), body, 5 * time.Minute, false},
+		{"malformed timestamp", secret, signature, "yesterday", body, 5 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.signature, tt.timestamp, tt.body, tt.tolerance)
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{}`)
+
+	tests := []struct {
+		name      string
+		age       time.Duration
+		tolerance time.Duration
+		ok        bool
+	}{
+		{"within tolerance", 4 * time.Minute, 5 * time.Minute, true},
+		{"too old", 6 * time.Minute, 5 * time.Minute, false},
+		{"too far in the future", -6 * time.Minute, 5 * time.Minute, false},
+		{"no tolerance", 24 * time.Hour, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := time.Now().Add(-tt.age).Unix()
+			err := Verify(secret, Sign(secret, ts, body), strconv.FormatInt(ts, 10), body, tt.tolerance)
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEnqueueMatchesEventTypesExactly(t *testing.T) {
+	db := databasetest.Open(t)
+
+	// An _ in a subscription must not match any character, as it would with LIKE
+	var subscribed, lookalike, inactive int
+	insert := "INSERT INTO webhooks (url, secret, event_types, active) VALUES ('https://example.edu/hook', 'whsec_test', $1, $2) RETURNING id"
+	if err := db.Get(&subscribed, insert, "item.created,item.status_changed", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&lookalike, insert, "item.status.changed,item.status_changed2", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&inactive, insert, "item.status_changed", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.MustBegin()
+	event := events.Event{ID: events.NewID(), Type: events.ItemStatusChanged, Time: time.Now(), Data: []byte(`{}`)}
+	if err := enqueue(tx, event); err != nil {
+		t.Fatal(err)
+	}
+	// Dispatching an event again does not add deliveries
+	if err := enqueue(tx, event); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var webhookIDs []int
+	if err := db.Select(&webhookIDs, "SELECT webhook_id FROM webhook_deliveries"); err != nil {
+		t.Fatal(err)
+	}
+	if len(webhookIDs) != 1 || webhookIDs[0] != subscribed {
+		t.Errorf("deliveries for webhooks %v, want only %d", webhookIDs, subscribed)
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	followed := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	webhook := models.Webhook{ID: 1, URL: redirect.URL, Secret: "whsec_test", Active: true}
+	delivery := models.WebhookDelivery{ID: 1, WebhookID: 1, EventID: "event", EventType: TestEvent, Payload: "{}"}
+	status, _, err := send(context.Background(), webhook, delivery)
+	if err == nil || status != http.StatusTemporaryRedirect {
+		t.Errorf("send() = %d, %v, want a failed %d", status, err, http.StatusTemporaryRedirect)
+	}
+	if followed {
+		t.Error("the redirect was followed")
+	}
+}
@@ -0,0 +1,208 @@
+// Package worker runs the API's background jobs, restarting any that panic
+// and stopping them all together on shutdown.
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Restart backoff for workers that panic
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+	// A worker that ran this long before panicking is restarted after minBackoff again
+	stableRun = 5 * time.Minute
+)
+
+// A worker is stale when it has not beaten for staleFactor times its interval
+// plus staleGrace, which allows for a slow batch
+const (
+	staleFactor = 3
+	staleGrace  = 2 * time.Minute
+)
+
+// Func is a background job. It should return once ctx is cancelled.
+type Func func(ctx context.Context)
+
+// Supervisor runs workers until it is stopped
+type Supervisor struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	draining    context.Context
+	cancelDrain context.CancelFunc
+	wg          sync.WaitGroup
+
+	mu      sync.Mutex
+	workers []*state
+}
+
+// Status describes a worker for health checks
+type Status struct {
+	Name     string    `json:"name"`
+	Running  bool      `json:"running"` // False while waiting to restart after a panic
+	LastBeat time.Time `json:"last_beat"`
+	Restarts int       `json:"restarts"`
+	Healthy  bool      `json:"healthy"`
+}
+
+// state is what the supervisor knows about one worker
+type state struct {
+	name     string
+	running  bool
+	lastBeat time.Time
+	interval time.Duration
+	restarts int
+}
+
+// stateKey is the context key under which a worker finds its state
+type stateKey struct{}
+
+// NewSupervisor returns a supervisor whose workers stop when Stop is called
+func NewSupervisor() *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	draining, cancelDrain := context.WithCancel(ctx)
+	return &Supervisor{ctx: ctx, cancel: cancel, draining: draining, cancelDrain: cancelDrain}
+}
+
+// Context is cancelled when the supervisor stops, for work that is not a
+// worker but should end with them, such as database listeners
+func (s *Supervisor) Context() context.Context {
+	return s.ctx
+}
+
+// Draining is cancelled by Drain, when shutdown begins and before requests
+// are drained, or by Stop. Long-lived requests such as event streams end with
+// it so that they do not hold up the shutdown.
+func (s *Supervisor) Draining() context.Context {
+	return s.draining
+}
+
+// Drain cancels the Draining context
+func (s *Supervisor) Drain() {
+	s.cancelDrain()
+}
+
+// Go runs fn in the background, restarting it with exponential backoff if it panics
+func (s *Supervisor) Go(name string, fn Func) {
+	st := &state{name: name}
+	s.mu.Lock()
+	s.workers = append(s.workers, st)
+	s.mu.Unlock()
+	ctx := context.WithValue(s.ctx, stateKey{}, &beater{s, st})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		backoff := minBackoff
+		for {
+			started := time.Now()
+			s.setRunning(st, true)
+			panicked := run(ctx, name, fn)
+			s.setRunning(st, false)
+			if !panicked || s.ctx.Err() != nil {
+				return
+			}
+
+			if time.Since(started) >= stableRun {
+				backoff = minBackoff
+			}
+			slog.Info("Restarting worker", "worker", name, "backoff", backoff.String())
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+
+			s.mu.Lock()
+			st.restarts++
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// Statuses reports each worker's heartbeat. A worker is healthy while it runs
+// and, once it has called Beat, keeps beating about as often as it said it would.
+func (s *Supervisor) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.workers))
+	for _, st := range s.workers {
+		healthy := st.running
+		if healthy && st.interval > 0 {
+			healthy = time.Since(st.lastBeat) <= staleFactor*st.interval+staleGrace
+		}
+		statuses = append(statuses, Status{
+			Name:     st.name,
+			Running:  st.running,
+			LastBeat: st.lastBeat,
+			Restarts: st.restarts,
+			Healthy:  healthy,
+		})
+	}
+	return statuses
+}
+
+// Beat records that the worker running with ctx is alive and will beat again
+// within interval. Workers call it each time they wake up.
+func Beat(ctx context.Context, interval time.Duration) {
+	if b, ok := ctx.Value(stateKey{}).(*beater); ok {
+		b.s.mu.Lock()
+		b.st.lastBeat, b.st.interval = time.Now(), interval
+		b.s.mu.Unlock()
+	}
+}
+
+// beater lets Beat update a worker's state under its supervisor's lock
+type beater struct {
+	s  *Supervisor
+	st *state
+}
+
+func (s *Supervisor) setRunning(st *state, running bool) {
+	s.mu.Lock()
+	st.running = running
+	if running {
+		// Give a (re)started worker a full interval before it counts as stale
+		st.lastBeat = time.Now()
+	}
+	s.mu.Unlock()
+}
+
+// Stop cancels the workers' context and waits for them to return, or until
+// ctx is done
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run calls fn and reports whether it panicked
+func run(ctx context.Context, name string, fn Func) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Worker panicked", "worker", name, "panic", r, "stack", string(debug.Stack()))
+			panicked = true
+		}
+	}()
+
+	fn(ctx)
+	return false
+}
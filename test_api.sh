@@ -58,6 +58,8 @@ run_test() {
 
 # Test health check endpoint
 run_test "GET" "/health" "" "" "Health Check"
+run_test "GET" "/health/live" "" "" "Liveness Check"
+run_test "GET" "/health/ready" "" "" "Readiness Check"
 
 # Test public endpoints
 run_test "GET" "/api/v1/items" "" "" "Get All Items (Public)"